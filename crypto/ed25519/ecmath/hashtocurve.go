@@ -0,0 +1,164 @@
+package ecmath
+
+import (
+	"crypto/sha512"
+	"errors"
+	"math/big"
+)
+
+// This file implements the edwards25519_XMD:SHA-512_ELL2_RO_ suite of
+// RFC 9380, "Hashing to Elliptic Curves." Field arithmetic uses
+// math/big and is not constant-time; it is meant for hashing public
+// data, such as VRF inputs.
+
+// ErrDSTSize is returned by HashToCurve when the domain separation
+// tag is empty or longer than 255 bytes.
+var ErrDSTSize = errors.New("bad domain separation tag length")
+
+var (
+	fieldP = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+	// montJ is the coefficient J of curve25519 in Montgomery form,
+	// v^2 = u^3 + J*u^2 + u.
+	montJ = big.NewInt(486662)
+
+	// ell2Z is the non-square Z used by the Elligator 2 map.
+	ell2Z = big.NewInt(2)
+
+	// sqrtNeg486664 is the square root of -486664 (that is, -(J+2))
+	// with sgn0 equal to 0, used by the rational map from curve25519
+	// to edwards25519.
+	sqrtNeg486664 = func() *big.Int {
+		r := new(big.Int).ModSqrt(new(big.Int).Sub(fieldP, big.NewInt(486664)), fieldP)
+		if r.Bit(0) == 1 {
+			r.Sub(fieldP, r)
+		}
+		return r
+	}()
+)
+
+// HashToCurve hashes msg to a point on the ed25519 curve in the prime
+// order subgroup, using the domain separation tag dst, as specified by
+// the edwards25519_XMD:SHA-512_ELL2_RO_ suite of RFC 9380. Dst must be
+// 1 to 255 bytes long.
+func HashToCurve(msg, dst []byte) (*Point, error) {
+	if len(dst) == 0 || len(dst) > 255 {
+		return nil, ErrDSTSize
+	}
+	uniform := expandMessageXMD(msg, dst, 96)
+	var q0, q1 Point
+	mapToCurve(&q0, fieldElement(uniform[:48]))
+	mapToCurve(&q1, fieldElement(uniform[48:]))
+	p := new(Point).Add(&q0, &q1)
+	return p.ScMulCofactor(p), nil
+}
+
+// expandMessageXMD implements expand_message_xmd from RFC 9380,
+// section 5.3.1, with SHA-512. N must be at most 255*64.
+func expandMessageXMD(msg, dst []byte, n int) []byte {
+	dstPrime := append(append([]byte{}, dst...), byte(len(dst)))
+
+	h := sha512.New()
+	h.Write(make([]byte, h.BlockSize()))
+	h.Write(msg)
+	h.Write([]byte{byte(n >> 8), byte(n), 0})
+	h.Write(dstPrime)
+	b0 := h.Sum(nil)
+
+	var (
+		out []byte
+		bi  = make([]byte, len(b0))
+	)
+	for i := 1; len(out) < n; i++ {
+		for j := range bi {
+			bi[j] ^= b0[j]
+		}
+		h.Reset()
+		h.Write(bi)
+		h.Write([]byte{byte(i)})
+		h.Write(dstPrime)
+		bi = h.Sum(bi[:0])
+		out = append(out, bi...)
+	}
+	return out[:n]
+}
+
+// fieldElement interprets b as a big-endian integer and reduces it
+// modulo the field prime.
+func fieldElement(b []byte) *big.Int {
+	x := new(big.Int).SetBytes(b)
+	return x.Mod(x, fieldP)
+}
+
+// mapToCurve sets z to the image of u under the Elligator 2 map to
+// curve25519 (RFC 9380, section 6.7.1) followed by the rational map
+// to edwards25519 (appendix D.1).
+func mapToCurve(z *Point, u *big.Int) {
+	// x1 = -J / (1 + Z*u^2), or -J if the denominator is zero.
+	d := new(big.Int).Mul(u, u)
+	d.Mul(d, ell2Z)
+	d.Add(d, big.NewInt(1))
+	d.Mod(d, fieldP)
+	x1 := new(big.Int).Neg(montJ)
+	if d.Sign() != 0 {
+		x1.Mul(x1, d.ModInverse(d, fieldP))
+	}
+	x1.Mod(x1, fieldP)
+
+	x := x1
+	y, ok := montgomeryY(x1)
+	if ok {
+		if y.Bit(0) == 0 {
+			y.Sub(fieldP, y).Mod(y, fieldP)
+		}
+	} else {
+		// x2 = -x1 - J
+		x = new(big.Int).Neg(x1)
+		x.Sub(x, montJ)
+		x.Mod(x, fieldP)
+		y, _ = montgomeryY(x)
+		if y.Bit(0) == 1 {
+			y.Sub(fieldP, y)
+		}
+	}
+
+	// Map the Montgomery point (x, y) to edwards25519:
+	//   ex = sqrt(-486664) * x / y
+	//   ey = (x - 1) / (x + 1)
+	// with points where either denominator is zero sent to the
+	// identity.
+	xPlus1 := new(big.Int).Add(x, big.NewInt(1))
+	xPlus1.Mod(xPlus1, fieldP)
+	if y.Sign() == 0 || xPlus1.Sign() == 0 {
+		*z = ZeroPoint
+		return
+	}
+	ex := new(big.Int).Mul(sqrtNeg486664, x)
+	ex.Mul(ex, new(big.Int).ModInverse(y, fieldP))
+	ex.Mod(ex, fieldP)
+	ey := new(big.Int).Sub(x, big.NewInt(1))
+	ey.Mul(ey, xPlus1.ModInverse(xPlus1, fieldP))
+	ey.Mod(ey, fieldP)
+
+	// Encode the affine point and decode it into z. Decoding cannot
+	// fail, since the point is on the curve.
+	var e [32]byte
+	ey.FillBytes(e[:])
+	for i := 0; i < 16; i++ {
+		e[i], e[31-i] = e[31-i], e[i]
+	}
+	e[31] |= byte(ex.Bit(0)) << 7
+	z.Decode(e)
+}
+
+// montgomeryY returns a square root of x^3 + J*x^2 + x, reporting
+// whether one exists.
+func montgomeryY(x *big.Int) (*big.Int, bool) {
+	gx := new(big.Int).Add(x, montJ)
+	gx.Mul(gx, x)
+	gx.Add(gx, big.NewInt(1))
+	gx.Mul(gx, x)
+	gx.Mod(gx, fieldP)
+	y := new(big.Int).ModSqrt(gx, fieldP)
+	return y, y != nil
+}
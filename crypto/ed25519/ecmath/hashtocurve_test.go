@@ -0,0 +1,68 @@
+package ecmath
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// Test vectors from RFC 9380, appendix J.5.1.
+func TestHashToCurve(t *testing.T) {
+	dst := []byte("QUUX-V01-CS02-with-edwards25519_XMD:SHA-512_ELL2_RO_")
+	cases := []struct {
+		msg  string
+		x, y string
+	}{
+		{
+			msg: "",
+			x:   "3c3da6925a3c3c268448dcabb47ccde5439559d9599646a8260e47b1e4822fc6",
+			y:   "09a6c8561a0b22bef63124c588ce4c62ea83a3c899763af26d795302e115dc21",
+		},
+		{
+			msg: "abc",
+			x:   "608040b42285cc0d72cbb3985c6b04c935370c7361f4b7fbdb1ae7f8c1a8ecad",
+			y:   "1a8395b88338f22e435bbd301183e7f20a5f9de643f11882fb237f88268a5531",
+		},
+		{
+			msg: "abcdef0123456789",
+			x:   "6d7fabf47a2dc03fe7d47f7dddd21082c5fb8f86743cd020f3fb147d57161472",
+			y:   "53060a3d140e7fbcda641ed3cf42c88a75411e648a1add71217f70ea8ec561a6",
+		},
+	}
+	for _, c := range cases {
+		p, err := HashToCurve([]byte(c.msg), dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := p.Encode()
+		want := encodeAffine(t, c.x, c.y)
+		if got != want {
+			t.Errorf("HashToCurve(%q) = %x, want %x", c.msg, got[:], want[:])
+		}
+	}
+
+	for _, n := range []int{0, 256} {
+		_, err := HashToCurve(nil, make([]byte, n))
+		if err != ErrDSTSize {
+			t.Errorf("HashToCurve with %d-byte dst: got error %v, want %v", n, err, ErrDSTSize)
+		}
+	}
+}
+
+// encodeAffine returns the standard encoding of the point with the
+// given big-endian hex coordinates.
+func encodeAffine(t *testing.T, xhex, yhex string) (e [32]byte) {
+	xb, err := hex.DecodeString(xhex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yb, err := hex.DecodeString(yhex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range yb {
+		e[i] = yb[len(yb)-1-i]
+	}
+	e[31] |= byte(new(big.Int).SetBytes(xb).Bit(0)) << 7
+	return e
+}
@@ -98,7 +98,30 @@ func Sign(privateKey PrivateKey, message []byte) []byte {
 	if l := len(privateKey); l != PrivateKeySize {
 		panic("ed25519: bad private key length: " + strconv.Itoa(l))
 	}
+	return sign(privateKey, nil, message)
+}
+
+// SignPrehashed signs prehash, the SHA-512 digest of a message, with
+// privateKey using Ed25519ph with an empty context, as defined in RFC
+// 8032, and returns a signature. It will panic if len(privateKey) is
+// not PrivateKeySize or len(prehash) is not sha512.Size.
+func SignPrehashed(privateKey PrivateKey, prehash []byte) []byte {
+	if l := len(privateKey); l != PrivateKeySize {
+		panic("ed25519: bad private key length: " + strconv.Itoa(l))
+	}
+	if l := len(prehash); l != sha512.Size {
+		panic("ed25519: bad prehash length: " + strconv.Itoa(l))
+	}
+	return sign(privateKey, phDomain, prehash)
+}
+
+// phDomain is dom2(1, "") from RFC 8032: the prefix that separates
+// Ed25519ph signatures (with an empty context) from Ed25519 ones.
+var phDomain = []byte("SigEd25519 no Ed25519 collisions\x01\x00")
 
+// sign produces a signature of message, hashing dom in front of each
+// hash input that includes the message.
+func sign(privateKey PrivateKey, dom, message []byte) []byte {
 	h := sha512.New()
 	h.Write(privateKey[:32])
 
@@ -111,6 +134,7 @@ func Sign(privateKey PrivateKey, message []byte) []byte {
 	expandedSecretKey[31] |= 64
 
 	h.Reset()
+	h.Write(dom)
 	h.Write(digest1[32:])
 	h.Write(message)
 	h.Sum(messageDigest[:0])
@@ -124,6 +148,7 @@ func Sign(privateKey PrivateKey, message []byte) []byte {
 	R.ToBytes(&encodedR)
 
 	h.Reset()
+	h.Write(dom)
 	h.Write(encodedR[:])
 	h.Write(privateKey[32:])
 	h.Write(message)
@@ -147,7 +172,24 @@ func Verify(publicKey PublicKey, message, sig []byte) bool {
 	if l := len(publicKey); l != PublicKeySize {
 		panic("ed25519: bad public key length: " + strconv.Itoa(l))
 	}
+	return verify(publicKey, nil, message, sig)
+}
+
+// VerifyPrehashed reports whether sig is a valid Ed25519ph signature,
+// with an empty context, of prehash by publicKey. Prehash is the
+// SHA-512 digest of the signed message. It will panic if
+// len(publicKey) is not PublicKeySize.
+func VerifyPrehashed(publicKey PublicKey, prehash, sig []byte) bool {
+	if l := len(publicKey); l != PublicKeySize {
+		panic("ed25519: bad public key length: " + strconv.Itoa(l))
+	}
+	if len(prehash) != sha512.Size {
+		return false
+	}
+	return verify(publicKey, phDomain, prehash, sig)
+}
 
+func verify(publicKey PublicKey, dom, message, sig []byte) bool {
 	if len(sig) != SignatureSize || sig[63]&224 != 0 {
 		return false
 	}
@@ -162,6 +204,7 @@ func Verify(publicKey PublicKey, message, sig []byte) bool {
 	edwards25519.FeNeg(&A.T, &A.T)
 
 	h := sha512.New()
+	h.Write(dom)
 	h.Write(sig[:32])
 	h.Write(publicKey[:])
 	h.Write(message)
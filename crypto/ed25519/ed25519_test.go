@@ -11,6 +11,7 @@ import (
 	"compress/gzip"
 	"crypto"
 	"crypto/rand"
+	"crypto/sha512"
 	"encoding/hex"
 	"os"
 	"strings"
@@ -62,6 +63,39 @@ func TestSignVerify(t *testing.T) {
 	}
 }
 
+func TestPrehashed(t *testing.T) {
+	// Test vector from RFC 8032, section 7.3 (Ed25519ph, message "abc").
+	seed, _ := hex.DecodeString("833fe62409237b9d62ec77587520911e9a759cec1d19755b7da901b96dca3d42")
+	public, _ := hex.DecodeString("ec172b93ad5e563bf4932c70e1245034c35467ef2efd4d64ebf819683467e2bf")
+	want, _ := hex.DecodeString("98a70222f0b8121aa9d30f813d683f809e462b469c7ff87639499bb94e6dae4131f85042463c2a355a2003d062adf5aaa10b8c61e636062aaad11c2a26083406")
+	private := PrivateKey(append(seed, public...))
+	prehash := sha512.Sum512([]byte("abc"))
+
+	sig := SignPrehashed(private, prehash[:])
+	if !bytes.Equal(sig, want) {
+		t.Errorf("SignPrehashed = %x, want %x", sig, want)
+	}
+	if !VerifyPrehashed(public, prehash[:], want) {
+		t.Error("valid prehashed signature rejected")
+	}
+
+	// Ed25519ph and Ed25519 signatures are not interchangeable.
+	if Verify(public, prehash[:], want) {
+		t.Error("prehashed signature accepted as plain signature")
+	}
+	if VerifyPrehashed(public, prehash[:], Sign(private, prehash[:])) {
+		t.Error("plain signature accepted as prehashed signature")
+	}
+
+	wrong := sha512.Sum512([]byte("abd"))
+	if VerifyPrehashed(public, wrong[:], want) {
+		t.Error("signature of different prehash accepted")
+	}
+	if VerifyPrehashed(public, prehash[:32], want) {
+		t.Error("short prehash accepted")
+	}
+}
+
 func TestCryptoSigner(t *testing.T) {
 	var zero zeroReader
 	public, private, _ := GenerateKey(zero)
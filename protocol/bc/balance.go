@@ -0,0 +1,146 @@
+package bc
+
+import (
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/math/checked"
+	"github.com/chain/txvm/protocol/txvm"
+)
+
+// AssetDelta returns, for each asset, the net change in the amount
+// held by outstanding outputs caused by tx: the total amount in its
+// outputs minus the total amount in its inputs, counting values held
+// by nested contracts. Assets with no net change are omitted.
+//
+// In a valid transaction, the result for each asset equals the
+// amount issued minus the amount retired; see IssuanceDelta.
+func (tx *Tx) AssetDelta() (map[Hash]int64, error) {
+	delta := make(map[Hash]int64)
+	for _, out := range tx.Outputs {
+		err := addStackValues(delta, out.Stack, 1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "output %x", out.ID.Bytes())
+		}
+	}
+	for _, in := range tx.Inputs {
+		err := addStackValues(delta, in.Stack, -1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "input %x", in.ID.Bytes())
+		}
+	}
+	return prune(delta), nil
+}
+
+// IssuanceDelta returns, for each asset, the amount issued by tx
+// minus the amount retired. Assets with no net change are omitted.
+func (tx *Tx) IssuanceDelta() (map[Hash]int64, error) {
+	delta := make(map[Hash]int64)
+	for _, iss := range tx.Issuances {
+		err := addAmount(delta, iss.AssetID, iss.Amount, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, ret := range tx.Retirements {
+		err := addAmount(delta, ret.AssetID, ret.Amount, -1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return prune(delta), nil
+}
+
+// AssetDelta returns the sum of AssetDelta over the block's
+// transactions. For a valid block it equals IssuanceDelta.
+func (b *Block) AssetDelta() (map[Hash]int64, error) {
+	return sumDeltas(b.Transactions, (*Tx).AssetDelta)
+}
+
+// IssuanceDelta returns the sum of IssuanceDelta over the block's
+// transactions.
+func (b *Block) IssuanceDelta() (map[Hash]int64, error) {
+	return sumDeltas(b.Transactions, (*Tx).IssuanceDelta)
+}
+
+func sumDeltas(txs []*Tx, f func(*Tx) (map[Hash]int64, error)) (map[Hash]int64, error) {
+	total := make(map[Hash]int64)
+	for _, tx := range txs {
+		delta, err := f(tx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "tx %x", tx.ID.Bytes())
+		}
+		for assetID, amount := range delta {
+			err = addAmount(total, assetID, amount, 1)
+			if err != nil {
+				return nil, errors.Wrapf(err, "tx %x", tx.ID.Bytes())
+			}
+		}
+	}
+	return prune(total), nil
+}
+
+// addStackValues adds sign times the amount of each value in stack,
+// an inspected contract stack, to delta.
+func addStackValues(delta map[Hash]int64, stack []txvm.Data, sign int64) error {
+	for _, item := range stack {
+		t, ok := item.(txvm.Tuple)
+		if !ok || len(t) == 0 {
+			continue
+		}
+		code, ok := t[0].(txvm.Bytes)
+		if !ok || len(code) != 1 {
+			continue
+		}
+		switch code[0] {
+		case txvm.ValueCode:
+			if len(t) != 4 {
+				return errors.WithDetail(txvm.ErrFields, "value")
+			}
+			amount, ok := t[1].(txvm.Int)
+			if !ok {
+				return errors.WithDetail(txvm.ErrFields, "value amount")
+			}
+			assetID, ok := t[2].(txvm.Bytes)
+			if !ok {
+				return errors.WithDetail(txvm.ErrFields, "value asset ID")
+			}
+			err := addAmount(delta, HashFromBytes(assetID), int64(amount), sign)
+			if err != nil {
+				return err
+			}
+		case txvm.ContractCode, txvm.WrappedContractCode:
+			if len(t) < 3 {
+				return errors.WithDetail(txvm.ErrFields, "contract")
+			}
+			err := addStackValues(delta, t[3:], sign)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func addAmount(delta map[Hash]int64, assetID Hash, amount, sign int64) error {
+	ok := true
+	if sign < 0 {
+		amount, ok = checked.NegateInt64(amount)
+	}
+	var sum int64
+	if ok {
+		sum, ok = checked.AddInt64(delta[assetID], amount)
+	}
+	if !ok {
+		return errors.WithDetailf(txvm.ErrIntOverflow, "asset %x", assetID.Bytes())
+	}
+	delta[assetID] = sum
+	return nil
+}
+
+func prune(delta map[Hash]int64) map[Hash]int64 {
+	for assetID, amount := range delta {
+		if amount == 0 {
+			delete(delta, assetID)
+		}
+	}
+	return delta
+}
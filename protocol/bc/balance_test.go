@@ -0,0 +1,84 @@
+package bc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/asm"
+	"github.com/chain/txvm/protocol/txvm/txvmtest"
+	"github.com/chain/txvm/testutil"
+)
+
+func TestAssetDelta(t *testing.T) {
+	var txs []*Tx
+	for _, src := range []string{
+		txvmtest.Issuance,
+		txvmtest.Retirement,
+		txvmtest.SimplePayment,
+		txvmtest.SplitPayment,
+		txvmtest.MergePayment,
+	} {
+		prog, err := asm.Assemble(src)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		tx, err := NewTx(prog, 3, 100000)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		txs = append(txs, tx)
+	}
+
+	dollar := mustDecodeHash("d073785d7dffc98c69ef62bbc6c8efde78a3286a848f570f8028695048a8f62d")
+	issued := txs[0].Issuances[0].AssetID
+
+	// Plain transfers leave outstanding amounts unchanged.
+	for _, tx := range txs[2:] {
+		delta, err := tx.AssetDelta()
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(delta) != 0 {
+			t.Errorf("transfer %x: got delta %v, want none", tx.ID.Bytes(), delta)
+		}
+	}
+
+	b := &Block{Transactions: txs}
+	got, err := b.AssetDelta()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	want := map[Hash]int64{issued: 10, dollar: -10}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("block AssetDelta = %v, want %v", got, want)
+	}
+	iss, err := b.IssuanceDelta()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !reflect.DeepEqual(iss, got) {
+		t.Errorf("block IssuanceDelta = %v, want %v", iss, got)
+	}
+}
+
+func TestAssetDeltaNested(t *testing.T) {
+	asset := Hash{}
+	value := txvm.Tuple{txvm.Bytes{txvm.ValueCode}, txvm.Int(7), txvm.Bytes(asset.Bytes()), txvm.Bytes("anchor")}
+	tx := &Tx{
+		Outputs: []Output{{
+			Stack: []txvm.Data{
+				value,
+				txvm.Tuple{txvm.Bytes{txvm.WrappedContractCode}, txvm.Bytes("seed"), txvm.Bytes("prog"), value},
+				txvm.Tuple{txvm.Bytes{txvm.TupleCode}, value},
+			},
+		}},
+	}
+	got, err := tx.AssetDelta()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if want := map[Hash]int64{asset: 14}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AssetDelta = %v, want %v", got, want)
+	}
+}
@@ -2,16 +2,28 @@ package bc
 
 import (
 	"database/sql/driver"
+	"encoding/binary"
 	"encoding/hex"
+	"io"
 
 	"golang.org/x/sync/errgroup"
 
 	"github.com/golang/protobuf/proto"
 
+	"github.com/chain/txvm/crypto/ed25519"
 	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/txvm"
 )
 
+// ErrBlockSignatures is returned by Block.Signatures and Block.Signers
+// when a block's arguments are not signatures for a version-1
+// (multisig) block predicate.
+var ErrBlockSignatures = errors.New("invalid block signatures")
+
+// ErrDecodeLimit is returned by Block.FromBytesLimited when a block's
+// encoding exceeds its DecodeLimits.
+var ErrDecodeLimit = errors.New("block exceeds decode limits")
+
 // Block describes a complete block, including its header
 // and the transactions it contains.
 type Block struct {
@@ -20,6 +32,37 @@ type Block struct {
 	Arguments    []interface{}
 }
 
+// BlockSummary is the header information of a block, for monitoring
+// and for export as JSON, with hashes as hex strings.
+type BlockSummary struct {
+	Height      uint64 `json:"height"`
+	ID          Hash   `json:"id"`
+	PreviousID  *Hash  `json:"previous_id,omitempty"` // nil for the initial block
+	TimestampMS uint64 `json:"timestamp_ms"`
+	TxCount     int    `json:"tx_count"`
+
+	// Runlimit is the total runlimit the block declares for its
+	// transactions.
+	Runlimit int64 `json:"runlimit"`
+}
+
+// Summary returns a summary of b. It does not examine b's
+// transactions beyond counting them.
+func (b *Block) Summary() *BlockSummary {
+	s := &BlockSummary{
+		Height:      b.Height,
+		ID:          b.Hash(),
+		TimestampMS: b.TimestampMs,
+		TxCount:     len(b.Transactions),
+		Runlimit:    b.Runlimit,
+	}
+	if b.PreviousBlockId != nil {
+		prev := *b.PreviousBlockId
+		s.PreviousID = &prev
+	}
+	return s
+}
+
 // MarshalText fulfills the json.Marshaler interface.
 // This guarantees that blocks will get deserialized correctly
 // when being parsed from HTTP requests.
@@ -103,6 +146,101 @@ func (b *Block) FromBytes(bits []byte) error {
 	return nil
 }
 
+// DecodeLimits bounds the size of a block that FromBytesLimited
+// will decode. A zero field imposes no limit.
+type DecodeLimits struct {
+	// MaxBytes is the maximum length of the whole encoding.
+	MaxBytes int
+
+	// MaxTxs is the maximum number of transactions.
+	MaxTxs int
+
+	// MaxFieldLen is the maximum length of any length-delimited
+	// field of the block or of one of its transactions, such as a
+	// transaction program.
+	MaxFieldLen int
+}
+
+// FromBytesLimited is like FromBytes, for bytes from an untrusted
+// source. Before decoding anything, it scans the encoding and
+// rejects it with ErrDecodeLimit if it exceeds lim, or if it
+// declares a field longer than the bytes remaining.
+func (b *Block) FromBytesLimited(bits []byte, lim DecodeLimits) error {
+	if lim.MaxBytes > 0 && len(bits) > lim.MaxBytes {
+		return errors.WithDetailf(ErrDecodeLimit, "block of %d bytes exceeds limit %d", len(bits), lim.MaxBytes)
+	}
+	var ntx int
+	err := scanFields(bits, lim.MaxFieldLen, func(field uint64, data []byte) error {
+		if field != 2 { // RawBlock.transactions
+			return nil
+		}
+		ntx++
+		if lim.MaxTxs > 0 && ntx > lim.MaxTxs {
+			return errors.WithDetailf(ErrDecodeLimit, "more than %d transactions", lim.MaxTxs)
+		}
+		return scanFields(data, lim.MaxFieldLen, nil)
+	})
+	if err != nil {
+		return err
+	}
+	return b.FromBytes(bits)
+}
+
+// scanFields walks the protobuf wire encoding of a message in bits
+// without allocating, calling fn, if not nil, on each
+// length-delimited field. It fails if a length-delimited field is
+// longer than maxLen (when positive) or than the remaining input.
+func scanFields(bits []byte, maxLen int, fn func(field uint64, data []byte) error) error {
+	for len(bits) > 0 {
+		key, n := binary.Uvarint(bits)
+		if n <= 0 {
+			return errors.Wrap(io.ErrUnexpectedEOF, "reading field key")
+		}
+		bits = bits[n:]
+		field := key >> 3
+		switch key & 7 {
+		case 0: // varint
+			_, n = binary.Uvarint(bits)
+			if n <= 0 {
+				return errors.Wrapf(io.ErrUnexpectedEOF, "reading field %d", field)
+			}
+			bits = bits[n:]
+		case 1: // fixed64
+			if len(bits) < 8 {
+				return errors.Wrapf(io.ErrUnexpectedEOF, "reading field %d", field)
+			}
+			bits = bits[8:]
+		case 5: // fixed32
+			if len(bits) < 4 {
+				return errors.Wrapf(io.ErrUnexpectedEOF, "reading field %d", field)
+			}
+			bits = bits[4:]
+		case 2: // length-delimited
+			l, n := binary.Uvarint(bits)
+			if n <= 0 {
+				return errors.Wrapf(io.ErrUnexpectedEOF, "reading length of field %d", field)
+			}
+			bits = bits[n:]
+			if l > uint64(len(bits)) {
+				return errors.WithDetailf(ErrDecodeLimit, "field %d declares %d bytes, %d remain", field, l, len(bits))
+			}
+			if maxLen > 0 && l > uint64(maxLen) {
+				return errors.WithDetailf(ErrDecodeLimit, "field %d of %d bytes exceeds limit %d", field, l, maxLen)
+			}
+			if fn != nil {
+				err := fn(field, bits[:l])
+				if err != nil {
+					return err
+				}
+			}
+			bits = bits[l:]
+		default:
+			return errors.WithDetailf(ErrDecodeLimit, "field %d has unsupported wire type %d", field, key&7)
+		}
+	}
+	return nil
+}
+
 // Bytes encodes the Block as a byte slice, by converting it to a
 // RawBlock protobuf and marshaling that.
 func (b *Block) Bytes() ([]byte, error) {
@@ -132,3 +270,48 @@ func (b *Block) Bytes() ([]byte, error) {
 	}
 	return proto.Marshal(rb)
 }
+
+// Signatures returns b's arguments as the signatures satisfying a
+// version-1 (multisig) block predicate. They are in the order of the
+// predicate's public keys, with an empty signature for each key that
+// did not sign.
+func (b *Block) Signatures() ([][]byte, error) {
+	sigs := make([][]byte, 0, len(b.Arguments))
+	for i, arg := range b.Arguments {
+		sig, ok := arg.([]byte)
+		if !ok {
+			return nil, errors.WithDetailf(ErrBlockSignatures, "argument %d is %T, not a signature", i, arg)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// Signers returns the members of pubkeys that signed b. Pubkeys must
+// be the public keys of the predicate b satisfies (the NextPredicate
+// of the previous block), in order. Signers verifies each non-empty
+// signature, and returns ErrBlockSignatures if one fails or if the
+// number of signatures does not match the number of keys.
+func (b *Block) Signers(pubkeys [][]byte) ([][]byte, error) {
+	sigs, err := b.Signatures()
+	if err != nil {
+		return nil, err
+	}
+	if len(sigs) != len(pubkeys) {
+		return nil, errors.WithDetailf(ErrBlockSignatures, "%d signatures for %d public keys", len(sigs), len(pubkeys))
+	}
+	var (
+		signers [][]byte
+		hash    = b.Hash()
+	)
+	for i, sig := range sigs {
+		if len(sig) == 0 {
+			continue
+		}
+		if len(pubkeys[i]) != ed25519.PublicKeySize || !ed25519.Verify(pubkeys[i], hash.Bytes(), sig) {
+			return nil, errors.WithDetailf(ErrBlockSignatures, "signature %d does not verify for public key %x", i, pubkeys[i])
+		}
+		signers = append(signers, pubkeys[i])
+	}
+	return signers, nil
+}
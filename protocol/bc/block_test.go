@@ -3,8 +3,13 @@ package bc
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
 	"testing"
 
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/txvm/asm"
 	"github.com/chain/txvm/protocol/txvm/txvmtest"
 	"github.com/chain/txvm/testutil"
@@ -100,6 +105,118 @@ func TestBlockBytes(t *testing.T) {
 	}
 }
 
+func TestBlockFromBytesLimited(t *testing.T) {
+	twoTxs := testBlock
+	twoTxs.Transactions = []*Tx{testBlock.Transactions[0], testBlock.Transactions[0]}
+	twoTxsBytes, err := twoTxs.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	progLen := len(testBlock.Transactions[0].WitnessProg)
+
+	cases := []struct {
+		name    string
+		bits    []byte
+		lim     DecodeLimits
+		wantErr error
+	}{
+		{
+			name: "no limits",
+			bits: testBlockBytes,
+		},
+		{
+			name: "within limits",
+			bits: twoTxsBytes,
+			lim:  DecodeLimits{MaxBytes: len(twoTxsBytes), MaxTxs: 2, MaxFieldLen: len(twoTxsBytes)},
+		},
+		{
+			name:    "too many bytes",
+			bits:    testBlockBytes,
+			lim:     DecodeLimits{MaxBytes: len(testBlockBytes) - 1},
+			wantErr: ErrDecodeLimit,
+		},
+		{
+			name:    "too many txs",
+			bits:    twoTxsBytes,
+			lim:     DecodeLimits{MaxTxs: 1},
+			wantErr: ErrDecodeLimit,
+		},
+		{
+			name:    "tx too long",
+			bits:    testBlockBytes,
+			lim:     DecodeLimits{MaxFieldLen: progLen},
+			wantErr: ErrDecodeLimit,
+		},
+		{
+			name:    "huge tx length",
+			bits:    mustDecodeHex("12ffffffffffffffff7f"),
+			wantErr: ErrDecodeLimit,
+		},
+		{
+			name:    "huge program length",
+			bits:    mustDecodeHex("120b1affffffffffffffff7f"),
+			wantErr: ErrDecodeLimit,
+		},
+		{
+			name:    "huge header length",
+			bits:    mustDecodeHex("0a8080808008"),
+			lim:     DecodeLimits{MaxBytes: 1 << 20},
+			wantErr: ErrDecodeLimit,
+		},
+		{
+			name:    "bad wire type",
+			bits:    mustDecodeHex("0b"),
+			wantErr: ErrDecodeLimit,
+		},
+		{
+			name:    "truncated length",
+			bits:    mustDecodeHex("12ff"),
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var b Block
+			err := b.FromBytesLimited(c.bits, c.lim)
+			if errors.Root(err) != c.wantErr {
+				t.Fatalf("got error %v, want %v", err, c.wantErr)
+			}
+			if err == nil && len(b.Transactions) == 0 {
+				t.Error("decoded block has no transactions")
+			}
+		})
+	}
+}
+
+func TestBlockSummary(t *testing.T) {
+	got := testBlock.Summary()
+	want := &BlockSummary{
+		Height:      1,
+		ID:          testBlock.Hash(),
+		PreviousID:  hashPtr(NewHash([32]byte{1})),
+		TimestampMS: 1000,
+		TxCount:     1,
+		Runlimit:    50000,
+	}
+	if !testutil.DeepEqual(got, want) {
+		t.Errorf("Summary = %+v, want %+v", got, want)
+	}
+
+	bits, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON := fmt.Sprintf(`{"height":1,"id":"%x","previous_id":"%x","timestamp_ms":1000,"tx_count":1,"runlimit":50000}`, want.ID.Bytes(), want.PreviousID.Bytes())
+	if string(bits) != wantJSON {
+		t.Errorf("JSON = %s, want %s", bits, wantJSON)
+	}
+
+	initial := &Block{BlockHeader: &BlockHeader{Height: 1, NextPredicate: &Predicate{}}}
+	if s := initial.Summary(); s.PreviousID != nil || s.TxCount != 0 {
+		t.Errorf("initial block summary %+v, want no previous ID and no transactions", s)
+	}
+}
+
 func TestBlockMarshal(t *testing.T) {
 	block := new(Block)
 	*block = testBlock
@@ -162,3 +279,74 @@ func TestBlockScan(t *testing.T) {
 		t.Errorf("Scan(%x):\ngot:  %v\n\twant: %v", wantBytes, gotBlock, block)
 	}
 }
+
+func TestBlockSignatures(t *testing.T) {
+	var (
+		pubkeys [][]byte
+		privs   []ed25519.PrivateKey
+	)
+	for i := 0; i < 3; i++ {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubkeys = append(pubkeys, pub)
+		privs = append(privs, priv)
+	}
+
+	block := &Block{BlockHeader: &BlockHeader{
+		Version:       3,
+		Height:        2,
+		TimestampMs:   1000,
+		NextPredicate: &Predicate{Version: 1},
+	}}
+	hash := block.Hash()
+	sig0 := ed25519.Sign(privs[0], hash.Bytes())
+	sig2 := ed25519.Sign(privs[2], hash.Bytes())
+	block.Arguments = []interface{}{sig0, []byte{}, sig2}
+
+	// Extract signatures from the serialized block.
+	bits, err := block.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(Block)
+	err = decoded.FromBytes(bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sigs, err := decoded.Signatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 3 || !bytes.Equal(sigs[0], sig0) || len(sigs[1]) != 0 || !bytes.Equal(sigs[2], sig2) {
+		t.Errorf("Signatures() = %x, want [%x, , %x]", sigs, sig0, sig2)
+	}
+
+	signers, err := decoded.Signers(pubkeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signers) != 2 || !bytes.Equal(signers[0], pubkeys[0]) || !bytes.Equal(signers[1], pubkeys[2]) {
+		t.Errorf("Signers() = %x, want [%x %x]", signers, pubkeys[0], pubkeys[2])
+	}
+
+	// Keys in the wrong order fail to verify.
+	_, err = decoded.Signers([][]byte{pubkeys[2], pubkeys[1], pubkeys[0]})
+	if errors.Root(err) != ErrBlockSignatures {
+		t.Errorf("Signers(misordered keys): got error %v, want %v", err, ErrBlockSignatures)
+	}
+
+	// So does the wrong number of keys.
+	_, err = decoded.Signers(pubkeys[:2])
+	if errors.Root(err) != ErrBlockSignatures {
+		t.Errorf("Signers(too few keys): got error %v, want %v", err, ErrBlockSignatures)
+	}
+
+	// Non-signature arguments are rejected.
+	_, err = testBlock.Signatures()
+	if errors.Root(err) != ErrBlockSignatures {
+		t.Errorf("Signatures(non-signature arguments): got error %v, want %v", err, ErrBlockSignatures)
+	}
+}
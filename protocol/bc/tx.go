@@ -226,16 +226,23 @@ func (tx *Tx) WriteWitnessCommitmentTo(w io.Writer) (int, error) {
 	return int(n) + n2, nil
 }
 
-// The only errors returned are those from w.
-func (tx *Tx) writeWitnessHashTo(w io.Writer) (int, error) {
+// WitnessHash returns the hash of tx's witness: its version,
+// runlimit, and program. Unlike the ID, it differs between two
+// witnesses producing the same transaction.
+func (tx *Tx) WitnessHash() Hash {
 	// See $CHAIN/docs/future/protocol/specifications/txvm.md#transaction-witness
-	// for the definition of the transaction witness and
-	// $CHAIN/docs/future/protocol/specifications/blockchain.md#transaction-witness-commitment
-	// for the definition of the transaction witness commitment.
-	h := txvm.VMHash("WitnessHash", txvm.Encode(txvm.Tuple{
+	// for the definition of the transaction witness.
+	return NewHash(txvm.VMHash("WitnessHash", txvm.Encode(txvm.Tuple{
 		txvm.Int(tx.Version),
 		txvm.Int(tx.Runlimit),
 		txvm.Bytes(tx.WitnessProg),
-	}))
-	return w.Write(h[:])
+	})))
+}
+
+// The only errors returned are those from w.
+func (tx *Tx) writeWitnessHashTo(w io.Writer) (int, error) {
+	// See $CHAIN/docs/future/protocol/specifications/blockchain.md#transaction-witness-commitment
+	// for the definition of the transaction witness commitment.
+	h := tx.WitnessHash()
+	return w.Write(h.Bytes())
 }
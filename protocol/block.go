@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"fmt"
@@ -13,6 +14,8 @@ import (
 	"github.com/chain/txvm/protocol/bc"
 	"github.com/chain/txvm/protocol/patricia"
 	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/validation"
 )
 
 // maxBlockTxs limits the number of transactions
@@ -31,12 +34,201 @@ var (
 	// ErrBadNoncesRoot is returned when the computed nonces merkle root
 	// disagrees with the one declared in a block header.
 	ErrBadNoncesRoot = errors.New("invalid nonces merkle root")
+
+	// ErrBlockVersion is returned, with the WithMaxVersionAt option,
+	// when a block's version is greater than the maximum allowed at
+	// its height.
+	ErrBlockVersion = errors.New("block version not allowed at height")
+
+	// ErrBlockWindow is returned when a block's timestamp is further
+	// past its predecessor's than the Chain's MaxBlockWindow.
+	ErrBlockWindow = errors.New("block timestamp too far past previous block")
+
+	// ErrFutureBlock is returned when a block's timestamp is further
+	// ahead of the local clock than the Chain's MaxFutureBlockTime.
+	// The block is not stored, and may be committed again once the
+	// local clock catches up.
+	ErrFutureBlock = errors.New("block timestamp too far in future")
+
+	// ErrNonContiguousBlock is returned by CommitAppliedBlock when
+	// the block does not follow the Chain's current state.
+	ErrNonContiguousBlock = errors.New("non-contiguous block")
+
+	// ErrSnapshotMismatch is returned by CommitVerifiedBlock when
+	// the snapshot is not for the block being committed.
+	ErrSnapshotMismatch = errors.New("snapshot does not match block")
 )
 
 // GetBlock returns the block at the given height, if there is one,
 // otherwise it returns an error.
 func (c *Chain) GetBlock(ctx context.Context, height uint64) (*bc.Block, error) {
-	return c.store.GetBlock(ctx, height)
+	return c.getStore().GetBlock(ctx, height)
+}
+
+// EachBlock calls fn on each committed block in turn, from the block
+// at height from (or 1, if from is 0) up to the block at c's height
+// when EachBlock was called. Blocks are fetched from the Store one
+// at a time, as they are needed.
+//
+// EachBlock stops and returns the error, if any, from fn, from the
+// Store, or from ctx. If the Store has discarded a block in the
+// range, the error's root is ErrPruned.
+func (c *Chain) EachBlock(ctx context.Context, from uint64, fn func(*bc.Block) error) error {
+	if from == 0 {
+		from = 1
+	}
+	height := c.Height()
+	for h := from; h <= height; h++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b, err := c.getStore().GetBlock(ctx, h)
+		if err != nil {
+			return errors.Wrapf(err, "getting block %d", h)
+		}
+		if b == nil {
+			return errors.WithDetailf(ErrPruned, "no block at height %d", h)
+		}
+		err = fn(b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EachUnspentOutput calls fn on each output that is unspent in c's
+// current state (see State), in the order the outputs were created.
+// If program is non-nil, it skips outputs whose contract program is
+// not equal to program.
+//
+// The state tree holds only output IDs, so the outputs' contents
+// (including their values, on their contract stacks) come from the
+// blocks that created them. EachUnspentOutput reads those blocks from
+// the Store with EachBlock, one at a time, and returns the same
+// errors; in particular, it fails with ErrPruned if the Store has
+// discarded any of them.
+func (c *Chain) EachUnspentOutput(ctx context.Context, program []byte, fn func(*bc.Output) error) error {
+	snapshot := c.State()
+	return c.EachBlock(ctx, 1, func(b *bc.Block) error {
+		for _, tx := range b.Transactions {
+			for i := range tx.Outputs {
+				out := &tx.Outputs[i]
+				if program != nil && !bytes.Equal(out.Program, program) {
+					continue
+				}
+				if !snapshot.ContractsTree.Contains(out.ID.Bytes()) {
+					continue
+				}
+				err := fn(out)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// BlockOption is an option for ValidateBlock, CommitBlocks, and
+// GenerateBlock.
+type BlockOption func(*blockOptions)
+
+type blockOptions struct {
+	canonicalTxOrder bool
+	maxVersionAt     func(height uint64) uint64
+}
+
+// WithCanonicalTxOrder is a BlockOption requiring a block's
+// transactions to be in canonical order (see validation.TxOrder).
+// ValidateBlock and CommitBlocks reject a block with transactions out
+// of order, and
+// GenerateBlock sorts the transactions it is given into order before
+// choosing which to include. A transaction spending an output created
+// by a transaction ordered after it is then left out.
+func WithCanonicalTxOrder() BlockOption {
+	return func(o *blockOptions) {
+		o.canonicalTxOrder = true
+	}
+}
+
+// WithMaxVersionAt is a BlockOption that makes ValidateBlock and
+// CommitBlocks reject, with ErrBlockVersion, a block whose version is
+// greater than maxVersion(height) for its height. It lets a network
+// refuse blocks of a new version until an agreed activation height:
+//
+//	protocol.WithMaxVersionAt(func(height uint64) uint64 {
+//		if height < activation {
+//			return 3
+//		}
+//		return 4
+//	})
+//
+// GenerateBlock ignores it.
+func WithMaxVersionAt(maxVersion func(height uint64) uint64) BlockOption {
+	return func(o *blockOptions) {
+		o.maxVersionAt = maxVersion
+	}
+}
+
+func newBlockOptions(opts []BlockOption) blockOptions {
+	var o blockOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Circulation returns the total amount of each asset held in outputs
+// that are unspent in c's current state, keyed by asset ID. It counts
+// each value on an output's contract stack.
+//
+// Like EachUnspentOutput, which it uses, Circulation reads every
+// block in the Store, so it is O(n) in the size of the blockchain
+// and fails with ErrPruned if any block has been discarded. Callers
+// needing it often should cache the result with the height of the
+// state it describes, and update it from the transactions of later
+// blocks. If an asset's total exceeds the range of int64, the error's
+// root is checked.ErrOverflow.
+func (c *Chain) Circulation(ctx context.Context) (map[bc.Hash]int64, error) {
+	totals := make(map[bc.Hash]int64)
+	err := c.EachUnspentOutput(ctx, nil, func(out *bc.Output) error {
+		for _, item := range out.Stack {
+			amount, assetID, ok := outputValue(item)
+			if !ok {
+				continue
+			}
+			sum, ok := checked.AddInt64(totals[assetID], amount)
+			if !ok {
+				return errors.WithDetailf(checked.ErrOverflow, "circulation of asset %x", assetID.Bytes())
+			}
+			totals[assetID] = sum
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+// outputValue reports whether item, from an output's contract stack,
+// is a value, and if so its amount and asset ID.
+func outputValue(item txvm.Data) (amount int64, assetID bc.Hash, ok bool) {
+	t, isTuple := item.(txvm.Tuple)
+	if !isTuple || len(t) != 4 {
+		return 0, bc.Hash{}, false
+	}
+	code, isBytes := t[0].(txvm.Bytes)
+	if !isBytes || len(code) != 1 || code[0] != txvm.ValueCode {
+		return 0, bc.Hash{}, false
+	}
+	n, isInt := t[1].(txvm.Int)
+	id, isBytes := t[2].(txvm.Bytes)
+	if !isInt || !isBytes || len(id) != 32 {
+		return 0, bc.Hash{}, false
+	}
+	return int64(n), bc.HashFromBytes(id), true
 }
 
 // GenerateBlock generates a valid, but unsigned, candidate block from
@@ -45,7 +237,7 @@ func (c *Chain) GetBlock(ctx context.Context, height uint64) (*bc.Block, error)
 //
 // After generating the block, the pending transaction pool will be
 // empty.
-func (c *Chain) GenerateBlock(ctx context.Context, snapshot *state.Snapshot, timestampMS uint64, txs []*bc.Tx) (*bc.Block, *state.Snapshot, error) {
+func (c *Chain) GenerateBlock(ctx context.Context, snapshot *state.Snapshot, timestampMS uint64, txs []*bc.Tx, opts ...BlockOption) (*bc.Block, *state.Snapshot, error) {
 	// TODO(kr): move this into a lower-level package (e.g. chain/protocol/bc)
 	// so that other packages (e.g. chain/protocol/validation) unit tests can
 	// call this function.
@@ -54,6 +246,10 @@ func (c *Chain) GenerateBlock(ctx context.Context, snapshot *state.Snapshot, tim
 	if timestampMS <= prev.TimestampMs {
 		return nil, nil, fmt.Errorf("timestamp %d is not greater than prevblock timestamp %d", timestampMS, prev.TimestampMs)
 	}
+	err := c.checkBlockWindow(timestampMS, prev)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Make a copy of the snapshot that we can apply our changes to.
 	newSnapshot := state.Copy(c.state.snapshot)
@@ -76,6 +272,11 @@ func (c *Chain) GenerateBlock(ctx context.Context, snapshot *state.Snapshot, tim
 		},
 	}
 
+	if newBlockOptions(opts).canonicalTxOrder {
+		txs = append([]*bc.Tx(nil), txs...)
+		validation.SortTxs(txs)
+	}
+
 	for _, tx := range txs {
 		if len(b.Transactions) >= maxBlockTxs {
 			break
@@ -113,7 +314,7 @@ func (c *Chain) GenerateBlock(ctx context.Context, snapshot *state.Snapshot, tim
 	nonceRoot := bc.NewHash(newSnapshot.NonceTree.RootHash())
 	b.NoncesRoot = &nonceRoot
 
-	err := newSnapshot.ApplyBlockHeader(b.BlockHeader)
+	err = newSnapshot.ApplyBlockHeader(b.BlockHeader)
 
 	return b, newSnapshot, err
 }
@@ -121,45 +322,237 @@ func (c *Chain) GenerateBlock(ctx context.Context, snapshot *state.Snapshot, tim
 // CommitAppliedBlock takes a block, commits it to persistent storage and
 // sets c's state. Unlike CommitBlock, it accepts an already applied
 // snapshot. CommitAppliedBlock is idempotent.
+//
+// The block must be the one following c's current state, and snapshot
+// must be the state after it, or the block must already be committed.
+// Otherwise CommitAppliedBlock returns ErrNonContiguousBlock and
+// stores nothing.
 func (c *Chain) CommitAppliedBlock(ctx context.Context, block *bc.Block, snapshot *state.Snapshot) error {
-	err := c.store.SaveBlock(ctx, block)
-	if err != nil {
-		return errors.Wrap(err, "storing block")
-	}
-	curState := c.State()
+	curHeight := c.State().Height()
 
 	// CommitAppliedBlock needs to be idempotent. If block's height is less than or
-	// equal to c's current block, then it was already applied. Because
-	// SaveBlock didn't error with a conflict, we know it's not a different
-	// block at the same height.
-	if block.Height <= curState.Height() {
+	// equal to c's current block, then it must already have been applied.
+	// It is rejected only if the Store has a different block at that
+	// height; if the Store has pruned it, there is nothing to compare.
+	if block.Height <= curHeight {
+		existing, err := c.getStore().GetBlock(ctx, block.Height)
+		if errors.Root(err) == ErrPruned {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "getting committed block %d", block.Height)
+		}
+		if existing != nil && existing.Hash() != block.Hash() {
+			return errors.WithDetailf(ErrNonContiguousBlock, "block %x differs from committed block %x at height %d", block.Hash().Bytes(), existing.Hash().Bytes(), block.Height)
+		}
 		return nil
 	}
-	return c.finalizeCommitState(ctx, snapshot)
+	if block.Height != curHeight+1 {
+		return errors.WithDetailf(ErrNonContiguousBlock, "expected height %d, got %d", curHeight+1, block.Height)
+	}
+	if snapshot.Height() != block.Height {
+		return errors.WithDetailf(ErrNonContiguousBlock, "snapshot height %d for block at height %d", snapshot.Height(), block.Height)
+	}
+
+	return c.commitAppliedBlock(ctx, block, snapshot)
+}
+
+// CommitVerifiedBlock is like CommitAppliedBlock, for a snapshot that
+// c did not compute itself but that has already been verified as the
+// result of applying block, such as one computed while assembling the
+// block. It does not apply block again. Instead it makes a cheap check
+// that snapshot is block's: that its header is block's header and its
+// contracts and nonces roots are the ones block declares. On a
+// mismatch it returns ErrSnapshotMismatch, ErrBadContractsRoot, or
+// ErrBadNoncesRoot, and commits nothing.
+func (c *Chain) CommitVerifiedBlock(ctx context.Context, block *bc.Block, snapshot *state.Snapshot) error {
+	if snapshot.Header == nil || snapshot.Header.Hash() != block.Hash() {
+		return errors.WithDetailf(ErrSnapshotMismatch, "snapshot height %d for block at height %d", snapshot.Height(), block.Height)
+	}
+	if block.ContractsRoot.Byte32() != snapshot.ContractsTree.RootHash() {
+		return ErrBadContractsRoot
+	}
+	if block.NoncesRoot.Byte32() != snapshot.NonceTree.RootHash() {
+		return ErrBadNoncesRoot
+	}
+	return c.CommitAppliedBlock(ctx, block, snapshot)
+}
+
+// commitAppliedBlock is CommitAppliedBlock without the contiguity
+// checks, for use by Recover, which may advance c's state by several
+// blocks at once.
+func (c *Chain) commitAppliedBlock(ctx context.Context, block *bc.Block, snapshot *state.Snapshot) error {
+	return c.commit(ctx, func() ([]*bc.Block, error) {
+		err := c.saveBlock(ctx, block)
+		if err != nil {
+			return nil, errors.Wrap(err, "storing block")
+		}
+		if block.Height <= c.State().Height() {
+			return nil, nil
+		}
+		return c.finalizeCommitState(ctx, snapshot, block)
+	})
 }
 
 // CommitBlock takes a block, commits it to persistent storage and applies
 // it to c. CommitBlock is idempotent. A duplicate call with a previously
 // committed block will succeed.
+//
+// If c.MaxFutureBlockTime is nonzero, a block dated further than that
+// ahead of the local clock is rejected with ErrFutureBlock. If
+// c.MaxBlockWindow is nonzero, a block dated more than that many
+// milliseconds past c's current block is rejected with ErrBlockWindow.
+//
+// If block is the one most recently passed to ValidateBlock, and c's
+// state hasn't changed since, CommitBlock commits the snapshot
+// ValidateBlock computed instead of applying block again.
 func (c *Chain) CommitBlock(ctx context.Context, block *bc.Block) error {
-	err := c.store.SaveBlock(ctx, block)
+	err := c.checkFutureBlock(block)
 	if err != nil {
-		return errors.Wrap(err, "storing block")
+		return err
+	}
+	return c.commit(ctx, func() ([]*bc.Block, error) {
+		curSnapshot := c.State()
+		if block.Height == curSnapshot.Height()+1 {
+			err := c.checkBlockWindow(block.TimestampMs, curSnapshot.Header)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err := c.saveBlock(ctx, block)
+		if err != nil {
+			return nil, errors.Wrap(err, "storing block")
+		}
+
+		// CommitBlock needs to be idempotent. If block's height is less than or
+		// equal to c's current block, then it was already applied. Because
+		// SaveBlock didn't error with a conflict, we know it's not a different
+		// block at the same height.
+		if block.Height <= curSnapshot.Height() {
+			return nil, nil
+		}
+
+		if snapshot := c.takeValidated(curSnapshot, block); snapshot != nil {
+			return c.finalizeCommitState(ctx, snapshot, block)
+		}
+		snapshot := state.Copy(curSnapshot)
+		err = snapshot.ApplyBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		if block.ContractsRoot.Byte32() != snapshot.ContractsTree.RootHash() {
+			return nil, ErrBadContractsRoot
+		}
+		if block.NoncesRoot.Byte32() != snapshot.NonceTree.RootHash() {
+			return nil, ErrBadNoncesRoot
+		}
+		return c.finalizeCommitState(ctx, snapshot, block)
+	})
+}
+
+// ValidateBlock validates block against c's current state, including
+// its predecessor's predicate, and returns the state that results from
+// applying it. c's state is unchanged. The result may be passed, with
+// block, to CommitAppliedBlock, to avoid applying the block twice.
+// CommitBlock does the same for the most recently validated block.
+func (c *Chain) ValidateBlock(block *bc.Block, opts ...BlockOption) (*state.Snapshot, error) {
+	prev := c.State()
+	snapshot := state.Copy(prev)
+	err := c.checkBlockWindow(block.TimestampMs, snapshot.Header)
+	if err != nil {
+		return nil, err
+	}
+	err = validateAndApply(snapshot, block, newBlockOptions(opts))
+	if err != nil {
+		return nil, err
 	}
-	curSnapshot := c.State()
 
-	// CommitBlock needs to be idempotent. If block's height is less than or
-	// equal to c's current block, then it was already applied. Because
-	// SaveBlock didn't error with a conflict, we know it's not a different
-	// block at the same height.
-	if block.Height <= curSnapshot.Height() {
+	c.validated.mu.Lock()
+	c.validated.prev = prev
+	c.validated.blockID = block.Hash()
+	c.validated.snapshot = snapshot
+	c.validated.mu.Unlock()
+	return snapshot, nil
+}
+
+// takeValidated returns the snapshot ValidateBlock most recently
+// computed, if it was for block applied to cur, and forgets it.
+// Otherwise it returns nil.
+func (c *Chain) takeValidated(cur *state.Snapshot, block *bc.Block) *state.Snapshot {
+	c.validated.mu.Lock()
+	defer c.validated.mu.Unlock()
+
+	snapshot := c.validated.snapshot
+	if snapshot == nil || c.validated.prev != cur || c.validated.blockID != block.Hash() {
 		return nil
 	}
+	c.validated.prev, c.validated.snapshot = nil, nil
+	return snapshot
+}
 
-	snapshot := state.Copy(curSnapshot)
+// ValidateBlockStateless performs the parts of ValidateBlock that
+// do not need the blockchain state, for nodes, such as monitors, that
+// follow blocks without keeping state. It checks that block is valid
+// as the successor of prev (nil for the initial block), including
+// prev's predicate, and that each transaction's program runs to
+// completion and produces the transaction's ID.
+//
+// It does not check spends or nonces, or the block's contracts and
+// nonces roots, and it produces no snapshot. A block it accepts may
+// still be rejected by ValidateBlock.
+func ValidateBlockStateless(block *bc.Block, prev *bc.BlockHeader) error {
+	err := validation.Block(block, prev)
+	if err != nil {
+		return errors.Wrap(err, "validating block")
+	}
+	if prev != nil {
+		err = validation.BlockSig(block, prev.NextPredicate)
+		if err != nil {
+			return errors.Wrap(err, "validating block")
+		}
+	}
+	for i, tx := range block.Transactions {
+		vtx, err := bc.NewTx(tx.WitnessProg, tx.Version, tx.Runlimit)
+		if err != nil {
+			return errors.WithDetailf(ErrBadTx, "transaction %d: %s", i, err)
+		}
+		if vtx.ID != tx.ID {
+			return errors.WithDetailf(ErrBadTx, "transaction %d program produces ID %x, want %x", i, vtx.ID.Bytes(), tx.ID.Bytes())
+		}
+	}
+	return nil
+}
+
+// validateAndApply validates block as the successor of snapshot's
+// header, subject to o, then applies it to snapshot in place and
+// checks the resulting state against the block's roots. On error,
+// snapshot may be left partially updated.
+func validateAndApply(snapshot *state.Snapshot, block *bc.Block, o blockOptions) error {
+	if o.maxVersionAt != nil {
+		if max := o.maxVersionAt(block.Height); block.Version > max {
+			return errors.WithDetailf(ErrBlockVersion, "block version %d, maximum at height %d is %d", block.Version, block.Height, max)
+		}
+	}
+	if o.canonicalTxOrder {
+		err := validation.TxOrder(block)
+		if err != nil {
+			return errors.Wrap(err, "validating block")
+		}
+	}
+	prev := snapshot.Header
+	err := validation.Block(block, prev)
+	if err != nil {
+		return errors.Wrap(err, "validating block")
+	}
+	if prev != nil {
+		err = validation.BlockSig(block, prev.NextPredicate)
+		if err != nil {
+			return errors.Wrap(err, "validating block")
+		}
+	}
 	err = snapshot.ApplyBlock(block)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "applying block")
 	}
 	if block.ContractsRoot.Byte32() != snapshot.ContractsTree.RootHash() {
 		return ErrBadContractsRoot
@@ -167,10 +560,114 @@ func (c *Chain) CommitBlock(ctx context.Context, block *bc.Block) error {
 	if block.NoncesRoot.Byte32() != snapshot.NonceTree.RootHash() {
 		return ErrBadNoncesRoot
 	}
-	return c.finalizeCommitState(ctx, snapshot)
+	return nil
+}
+
+// CommitBlocks validates and applies a contiguous run of blocks,
+// commits them to persistent storage, and sets c's state. It is meant
+// for syncing many blocks at once: c's state and height are updated,
+// and a snapshot considered for storage, only once, after the last
+// block.
+//
+// Each block is checked against its predecessor and its predecessor's
+// predicate, and as required by opts. Blocks at or below c's current height are skipped, as
+// with CommitBlock. If any block is invalid, CommitBlocks returns an
+// error without storing any of the blocks or changing c's state. If
+// storing a block fails, blocks before it may have been stored, but
+// c's state is unchanged; committing them again is harmless.
+func (c *Chain) CommitBlocks(ctx context.Context, blocks []*bc.Block, opts ...BlockOption) error {
+	o := newBlockOptions(opts)
+	for _, block := range blocks {
+		err := c.checkFutureBlock(block)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.commit(ctx, func() ([]*bc.Block, error) {
+		curSnapshot := c.State()
+		for len(blocks) > 0 && blocks[0].Height <= curSnapshot.Height() {
+			err := c.saveBlock(ctx, blocks[0])
+			if err != nil {
+				return nil, errors.Wrapf(err, "storing block %d", blocks[0].Height)
+			}
+			blocks = blocks[1:]
+		}
+		if len(blocks) == 0 {
+			return nil, nil
+		}
+
+		snapshot := state.Copy(curSnapshot)
+		for _, block := range blocks {
+			err := c.checkBlockWindow(block.TimestampMs, snapshot.Header)
+			if err == nil {
+				err = validateAndApply(snapshot, block, o)
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "block %d", block.Height)
+			}
+		}
+
+		for _, block := range blocks {
+			err := c.saveBlock(ctx, block)
+			if err != nil {
+				return nil, errors.Wrapf(err, "storing block %d", block.Height)
+			}
+		}
+		return c.finalizeCommitState(ctx, snapshot, blocks...)
+	})
+}
+
+// checkFutureBlock returns ErrFutureBlock if block's timestamp is more
+// than c.MaxFutureBlockTime ahead of the local clock.
+func (c *Chain) checkFutureBlock(block *bc.Block) error {
+	if c.MaxFutureBlockTime == 0 {
+		return nil
+	}
+	limit := bc.Millis(time.Now().Add(c.MaxFutureBlockTime))
+	if block.TimestampMs > limit {
+		return errors.WithDetailf(ErrFutureBlock, "block %d timestamp %d exceeds limit %d", block.Height, block.TimestampMs, limit)
+	}
+	return nil
 }
 
-func (c *Chain) finalizeCommitState(ctx context.Context, snapshot *state.Snapshot) error {
+// checkBlockWindow returns ErrBlockWindow if timestampMS is more
+// than c.MaxBlockWindow milliseconds past prev's timestamp. There is
+// no limit for the initial block, whose prev is nil.
+func (c *Chain) checkBlockWindow(timestampMS uint64, prev *bc.BlockHeader) error {
+	if c.MaxBlockWindow == 0 || prev == nil {
+		return nil
+	}
+	if timestampMS > prev.TimestampMs && timestampMS-prev.TimestampMs > c.MaxBlockWindow {
+		return errors.WithDetailf(ErrBlockWindow, "block %d timestamp %d is more than %dms past %d", prev.Height+1, timestampMS, c.MaxBlockWindow, prev.TimestampMs)
+	}
+	return nil
+}
+
+// commit runs f, which saves blocks to the Store and sets c's state,
+// holding c.commitMu so that SwapStore can't replace the Store in
+// between. Then, with no locks held, it reports the transactions of
+// the blocks f returns to c.committedTx.
+func (c *Chain) commit(ctx context.Context, f func() ([]*bc.Block, error)) error {
+	c.commitMu.Lock()
+	committed, err := f()
+	c.commitMu.Unlock()
+
+	if c.committedTx != nil {
+		for _, b := range committed {
+			for _, tx := range b.Transactions {
+				c.committedTx(ctx, b.Height, tx)
+			}
+		}
+	}
+	return err
+}
+
+// finalizeCommitState sets c's state to snapshot, the state after
+// blocks, which must already be saved to the Store. It returns the
+// blocks whose transactions are to be reported: those above the
+// height of the state it replaced.
+func (c *Chain) finalizeCommitState(ctx context.Context, snapshot *state.Snapshot, blocks ...*bc.Block) ([]*bc.Block, error) {
 	// Save the blockchain state tree snapshot to persistent storage
 	// if we haven't done it recently.
 	if snapshot.TimestampMS() > c.lastQueuedSnapshotMS+saveSnapshotFrequencyMS {
@@ -178,14 +675,27 @@ func (c *Chain) finalizeCommitState(ctx context.Context, snapshot *state.Snapsho
 	}
 	// setState will update c's current block and snapshot, or no-op
 	// if another goroutine has already updated the state.
-	c.setState(snapshot)
+	prev := c.setState(snapshot)
 
 	// The below FinalizeHeight will notify other cored processes that
 	// the a new block has been committed. It may result in a duplicate
 	// attempt to update c's height but setState and setHeight safely
 	// ignore duplicate heights.
-	err := c.store.FinalizeHeight(ctx, snapshot.Height())
-	return errors.Wrap(err, "finalizing block")
+	err := c.getStore().FinalizeHeight(ctx, snapshot.Height())
+	if err == nil {
+		c.setFinalizedHeight(snapshot.Height())
+	}
+
+	// The blocks are durably committed and c's state can't go back
+	// to before them, so report their transactions even if
+	// FinalizeHeight failed; a retry would skip them.
+	var committed []*bc.Block
+	for _, b := range blocks {
+		if b.Height > prev {
+			committed = append(committed, b)
+		}
+	}
+	return committed, errors.Wrap(err, "finalizing block")
 }
 
 func (c *Chain) queueSnapshot(ctx context.Context, s *state.Snapshot) {
@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"reflect"
 	"sync"
@@ -10,11 +11,16 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 
+	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/bc"
 	"github.com/chain/txvm/protocol/bc/bctest"
 	"github.com/chain/txvm/protocol/patricia"
 	"github.com/chain/txvm/protocol/prottest/memstore"
 	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/asm"
+	"github.com/chain/txvm/protocol/txvm/op"
+	"github.com/chain/txvm/protocol/validation"
 	"github.com/chain/txvm/testutil"
 )
 
@@ -281,6 +287,859 @@ func TestCommitBlockIdempotence(t *testing.T) {
 	}
 }
 
+func TestCommitBlocks(t *testing.T) {
+	const numOfBlocks = 5
+	ctx := context.Background()
+
+	now := time.Now()
+	src, b1 := newTestChain(t, now)
+	blocks := []*bc.Block{b1}
+	for i := 0; i < numOfBlocks; i++ {
+		curState := src.State()
+		txs := []*bc.Tx{bctest.EmptyTx(t, b1.Hash(), now.Add(time.Minute))}
+		b, s, err := src.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(b.Transactions) != 1 {
+			t.Fatalf("block %d has %d transactions, want 1", b.Height, len(b.Transactions))
+		}
+		err = src.CommitAppliedBlock(ctx, b, s)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	store := memstore.New()
+	c, err := NewChain(ctx, b1, store, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// A bad block mid-run leaves the store and state untouched.
+	bad := *blocks[3]
+	badHeader := *bad.BlockHeader
+	badRoot := bc.NewHash([32]byte{1})
+	badHeader.ContractsRoot = &badRoot
+	bad.BlockHeader = &badHeader
+	run := append([]*bc.Block{}, blocks...)
+	run[3] = &bad
+	err = c.CommitBlocks(ctx, run)
+	if errors.Root(err) != ErrBadContractsRoot {
+		t.Errorf("CommitBlocks with bad block: got error %v, want %v", err, ErrBadContractsRoot)
+	}
+	if h := c.Height(); h != 0 {
+		t.Errorf("height after failed CommitBlocks = %d, want 0", h)
+	}
+	if h, _ := store.Height(ctx); h != 0 {
+		t.Errorf("store height after failed CommitBlocks = %d, want 0", h)
+	}
+
+	err = c.CommitBlocks(ctx, blocks[:3])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if h := c.Height(); h != 3 {
+		t.Errorf("height after CommitBlocks = %d, want 3", h)
+	}
+
+	// Overlapping the committed blocks is fine.
+	err = c.CommitBlocks(ctx, blocks[1:])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if h := c.Height(); h != uint64(len(blocks)) {
+		t.Errorf("height after CommitBlocks = %d, want %d", h, len(blocks))
+	}
+	if got, want := c.State(), src.State(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got snapshot:\n%swant snapshot:\n%s", spew.Sdump(got), spew.Sdump(want))
+	}
+	for _, b := range blocks {
+		got, err := store.GetBlock(ctx, b.Height)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if got.Hash() != b.Hash() {
+			t.Errorf("stored block %d has hash %x, want %x", b.Height, got.Hash().Bytes(), b.Hash().Bytes())
+		}
+	}
+
+	// A gap is rejected.
+	err = c.CommitBlocks(ctx, []*bc.Block{{BlockHeader: &bc.BlockHeader{Height: uint64(len(blocks)) + 2}}})
+	if err == nil {
+		t.Error("CommitBlocks with a gap succeeded, want error")
+	}
+}
+
+func TestOnCommittedTx(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	src, b1 := newTestChain(t, now)
+	blocks := []*bc.Block{b1}
+	for i := 0; i < 5; i++ {
+		curState := src.State()
+		var txs []*bc.Tx
+		for j := 0; j < i%3; j++ {
+			txs = append(txs, bctest.EmptyTx(t, b1.Hash(), now.Add(time.Minute)))
+		}
+		b, s, err := src.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = src.CommitAppliedBlock(ctx, b, s)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	type committed struct {
+		height uint64
+		txid   bc.Hash
+	}
+	var want []committed
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			want = append(want, committed{b.Height, tx.ID})
+		}
+	}
+
+	var (
+		c   *Chain
+		got []committed
+	)
+	c, err := NewChain(ctx, b1, memstore.New(), nil, OnCommittedTx(func(ctx context.Context, height uint64, tx *bc.Tx) {
+		// The callback runs outside c's locks, after the block is stored.
+		if h := c.Height(); h < height {
+			t.Errorf("callback for height %d with chain at height %d", height, h)
+		}
+		got = append(got, committed{height, tx.ID})
+	}))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Commit the blocks each of the ways a Chain can, including
+	// recommitting some, which must not report them again.
+	err = c.CommitBlocks(ctx, blocks[:3])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitBlock(ctx, blocks[3])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitBlock(ctx, blocks[2])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	s, err := c.ValidateBlock(blocks[4])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, blocks[4], s)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitBlocks(ctx, blocks[3:])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("committed txs:\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestWithMaxVersionAt(t *testing.T) {
+	ctx := context.Background()
+
+	const activation = 3
+	maxVersion := WithMaxVersionAt(func(height uint64) uint64 {
+		if height < activation {
+			return 3
+		}
+		return 4
+	})
+
+	c, _ := newTestChain(t, time.Now())
+	withVersion := func(version uint64) *bc.Block {
+		curState := c.State()
+		b, _, err := c.GenerateBlock(ctx, curState, curState.TimestampMS()+1, nil)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		b.Version = version
+		return b
+	}
+
+	cases := []struct {
+		version uint64
+		wantErr error
+		commit  bool
+	}{
+		// Height 2, before activation.
+		{4, ErrBlockVersion, false},
+		{3, nil, true},
+		// Height 3, at activation.
+		{5, ErrBlockVersion, false},
+		{3, nil, false},
+		{4, nil, true},
+	}
+	for _, tc := range cases {
+		b := withVersion(tc.version)
+		s, err := c.ValidateBlock(b, maxVersion)
+		if errors.Root(err) != tc.wantErr {
+			t.Fatalf("version %d at height %d: got error %v, want %v", tc.version, b.Height, err, tc.wantErr)
+		}
+		if err != nil {
+			// Without the option, the block is valid.
+			_, err = c.ValidateBlock(b)
+			if err != nil {
+				t.Errorf("version %d at height %d without WithMaxVersionAt: got error %v", tc.version, b.Height, err)
+			}
+			err = c.CommitBlocks(ctx, []*bc.Block{b}, maxVersion)
+			if errors.Root(err) != tc.wantErr {
+				t.Errorf("CommitBlocks version %d at height %d: got error %v, want %v", tc.version, b.Height, err, tc.wantErr)
+			}
+		}
+		if tc.commit {
+			err = c.CommitAppliedBlock(ctx, b, s)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+		}
+	}
+	if h := c.Height(); h != activation {
+		t.Errorf("height = %d, want %d", h, activation)
+	}
+}
+
+func TestOnCommittedTxOnce(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	src, b1 := newTestChain(t, now)
+	var blocks []*bc.Block
+	for i := 0; i < 4; i++ {
+		curState := src.State()
+		txs := []*bc.Tx{bctest.EmptyTx(t, b1.Hash(), now.Add(time.Minute))}
+		b, s, err := src.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = src.CommitAppliedBlock(ctx, b, s)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	var (
+		mu     sync.Mutex
+		counts = make(map[bc.Hash]int)
+	)
+	c, err := NewChain(ctx, b1, memstore.New(), nil, OnCommittedTx(func(ctx context.Context, height uint64, tx *bc.Tx) {
+		mu.Lock()
+		counts[tx.ID]++
+		mu.Unlock()
+	}))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	st := state.Empty()
+	err = st.ApplyBlock(b1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, b1, st)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Another process finalizing the blocks first doesn't stop c
+	// from reporting them when it commits them.
+	c.setHeight(blocks[len(blocks)-1].Height)
+
+	// Several goroutines commit the same blocks concurrently, in
+	// batches and one at a time.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			err := c.CommitBlocks(ctx, blocks)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for _, b := range blocks {
+				err := c.CommitBlock(ctx, b)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			if n := counts[tx.ID]; n != 1 {
+				t.Errorf("block %d tx %x reported %d times, want 1", b.Height, tx.ID.Bytes(), n)
+			}
+		}
+	}
+}
+
+func TestValidateBlock(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	src, b1 := newTestChain(t, now)
+	curState := src.State()
+	txs := []*bc.Tx{bctest.EmptyTx(t, b1.Hash(), now.Add(time.Minute))}
+	b2, _, err := src.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	c, err := NewChain(ctx, b1, memstore.New(), nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	st := state.Empty()
+	err = st.ApplyBlock(b1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, b1, st)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	got, err := c.ValidateBlock(b2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if h := c.State().Height(); h != 1 {
+		t.Errorf("ValidateBlock changed chain height to %d", h)
+	}
+
+	want := state.Copy(c.State())
+	err = want.ApplyBlock(b2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got snapshot:\n%swant snapshot:\n%s", spew.Sdump(got), spew.Sdump(want))
+	}
+
+	// A block with a bad root is rejected.
+	bad := *b2
+	badHeader := *bad.BlockHeader
+	badRoot := bc.NewHash([32]byte{1})
+	badHeader.NoncesRoot = &badRoot
+	bad.BlockHeader = &badHeader
+	_, err = c.ValidateBlock(&bad)
+	if errors.Root(err) != ErrBadNoncesRoot {
+		t.Errorf("ValidateBlock with bad root: got error %v, want %v", err, ErrBadNoncesRoot)
+	}
+
+	err = c.CommitAppliedBlock(ctx, b2, got)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if h := c.Height(); h != 2 {
+		t.Errorf("height after commit = %d, want 2", h)
+	}
+}
+
+func TestCommitBlockReusesValidated(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	src, b1 := newTestChain(t, now)
+	var blocks []*bc.Block
+	for i := 0; i < 2; i++ {
+		curState := src.State()
+		txs := []*bc.Tx{bctest.EmptyTx(t, b1.Hash(), now.Add(time.Minute))}
+		b, s, err := src.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = src.CommitAppliedBlock(ctx, b, s)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	c, _ := newTestChain(t, now)
+
+	// A different block validated in between is not committed in
+	// place of the one passed to CommitBlock.
+	curState := c.State()
+	other, _, err := c.GenerateBlock(ctx, curState, curState.TimestampMS()+2, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = c.ValidateBlock(blocks[0])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	otherState, err := c.ValidateBlock(other)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitBlock(ctx, blocks[0])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if c.State() == otherState {
+		t.Error("CommitBlock committed the snapshot of a different block")
+	}
+	if got, want := c.State().Header.Hash(), blocks[0].Hash(); got != want {
+		t.Errorf("state header = %x, want %x", got.Bytes(), want.Bytes())
+	}
+
+	validated, err := c.ValidateBlock(blocks[1])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitBlock(ctx, blocks[1])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if c.State() != validated {
+		t.Error("CommitBlock applied the validated block again")
+	}
+	if got, want := c.State().ContractsTree.RootHash(), src.State().ContractsTree.RootHash(); got != want {
+		t.Errorf("contracts root = %x, want %x", got[:], want[:])
+	}
+}
+
+func TestCanonicalTxOrder(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c, b1 := newTestChain(t, now)
+
+	var txs []*bc.Tx
+	for i := 0; i < 5; i++ {
+		txs = append(txs, bctest.EmptyTx(t, b1.Hash(), now.Add(time.Minute)))
+	}
+	sorted := append([]*bc.Tx(nil), txs...)
+	validation.SortTxs(sorted)
+	shuffled := append([]*bc.Tx(nil), sorted...)
+	shuffled[0], shuffled[4] = shuffled[4], shuffled[0]
+
+	curState := c.State()
+	inOrder, _, err := c.GenerateBlock(ctx, curState, curState.TimestampMS()+1, shuffled, WithCanonicalTxOrder())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !reflect.DeepEqual(inOrder.Transactions, sorted) {
+		t.Error("GenerateBlock with WithCanonicalTxOrder did not sort transactions")
+	}
+	if shuffled[0] != sorted[4] {
+		t.Error("GenerateBlock reordered its argument")
+	}
+	outOfOrder, _, err := c.GenerateBlock(ctx, curState, curState.TimestampMS()+1, shuffled)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !reflect.DeepEqual(outOfOrder.Transactions, shuffled) {
+		t.Error("GenerateBlock without WithCanonicalTxOrder reordered transactions")
+	}
+
+	_, err = c.ValidateBlock(inOrder, WithCanonicalTxOrder())
+	if err != nil {
+		t.Errorf("in-order block: %v", err)
+	}
+	_, err = c.ValidateBlock(outOfOrder, WithCanonicalTxOrder())
+	if errors.Root(err) != validation.ErrTxOrder {
+		t.Errorf("shuffled block: got error %v, want %v", err, validation.ErrTxOrder)
+	}
+	_, err = c.ValidateBlock(outOfOrder)
+	if err != nil {
+		t.Errorf("shuffled block without option: %v", err)
+	}
+}
+
+func TestValidateBlockStateless(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	c, b1 := newTestChain(t, now)
+	curState := c.State()
+	txs := []*bc.Tx{bctest.EmptyTx(t, b1.Hash(), now.Add(time.Minute))}
+	b2, _, err := c.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	err = ValidateBlockStateless(b1, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = ValidateBlockStateless(b2, b1.BlockHeader)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// The state roots are not checked.
+	withRoot := *b2
+	header := *withRoot.BlockHeader
+	badRoot := bc.NewHash([32]byte{1})
+	header.NoncesRoot = &badRoot
+	withRoot.BlockHeader = &header
+	err = ValidateBlockStateless(&withRoot, b1.BlockHeader)
+	if err != nil {
+		t.Errorf("ValidateBlockStateless with bad nonces root: got error %v, want nil", err)
+	}
+
+	// The block must follow prev.
+	err = ValidateBlockStateless(b2, b2.BlockHeader)
+	if err == nil {
+		t.Error("ValidateBlockStateless with wrong prev: got nil error")
+	}
+
+	// Each transaction's program must produce its ID.
+	otherTx := bctest.EmptyTx(t, b1.Hash(), now.Add(time.Minute))
+	failing, err := bc.NewTx([]byte{op.MinSmallInt, op.Verify}, 3, 1000)
+	if err == nil {
+		t.Fatal("expected error from failing program")
+	}
+	for _, prog := range [][]byte{otherTx.WitnessProg, failing.WitnessProg} {
+		badTx := *txs[0]
+		badTx.WitnessProg = prog
+		badBlock := *b2
+		header := *badBlock.BlockHeader
+		badBlock.BlockHeader = &header
+		badBlock.Transactions = []*bc.Tx{&badTx}
+		root := bc.TxMerkleRoot(badBlock.Transactions)
+		header.TransactionsRoot = &root
+		err = ValidateBlockStateless(&badBlock, b1.BlockHeader)
+		if errors.Root(err) != ErrBadTx {
+			t.Errorf("ValidateBlockStateless with bad program %x: got error %v, want %v", prog, err, ErrBadTx)
+		}
+	}
+}
+
+func TestEachUnspentOutput(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	c, b1 := newTestChain(t, now)
+
+	var (
+		progA = mustAssemble(t, "drop")
+		progB = mustAssemble(t, "1 drop drop")
+	)
+
+	// outputTx makes a transaction creating an output for each of
+	// progs, distinguished by their tags, and spending inputs.
+	outputTx := func(tag int, progs [][]byte, inputs ...bc.Output) *bc.Tx {
+		src := fmt.Sprintf("[%d drop x'%x' %d nonce put] contract call\n", tag, b1.Hash().Bytes(), bc.Millis(now.Add(time.Minute)))
+		for i, prog := range progs {
+			src += fmt.Sprintf("[%d x'%x' output] contract call\n", tag+i, prog)
+		}
+		for _, in := range inputs {
+			src += fmt.Sprintf("{'C', x'%x', x'%x', {'Z', %d}} input call\n", in.Seed.Bytes(), in.Program, in.Stack[0].(txvm.Tuple)[1])
+		}
+		src += "get finalize"
+		tx, err := bc.NewTx(mustAssemble(t, src), 3, 10000)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		return tx
+	}
+
+	tx1 := outputTx(0, [][]byte{progA, progB, progA})
+	b2, s2, err := c.GenerateBlock(ctx, c.State(), bc.Millis(now)+1, []*bc.Tx{tx1})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, b2, s2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Spend the first output and create another.
+	tx2 := outputTx(3, [][]byte{progA}, tx1.Outputs[0])
+	b3, s3, err := c.GenerateBlock(ctx, c.State(), bc.Millis(now)+2, []*bc.Tx{tx2})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, b3, s3)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	cases := []struct {
+		program []byte
+		want    []bc.Hash
+	}{
+		{nil, []bc.Hash{tx1.Outputs[1].ID, tx1.Outputs[2].ID, tx2.Outputs[0].ID}},
+		{progA, []bc.Hash{tx1.Outputs[2].ID, tx2.Outputs[0].ID}},
+		{progB, []bc.Hash{tx1.Outputs[1].ID}},
+		{[]byte{}, nil},
+	}
+	for _, tc := range cases {
+		var got []bc.Hash
+		err := c.EachUnspentOutput(ctx, tc.program, func(out *bc.Output) error {
+			got = append(got, out.ID)
+			return nil
+		})
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("EachUnspentOutput(%x) got %x, want %x", tc.program, got, tc.want)
+		}
+	}
+
+	// An error from fn stops the iteration.
+	stop := errors.New("stop")
+	var n int
+	err = c.EachUnspentOutput(ctx, nil, func(*bc.Output) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("EachUnspentOutput with failing fn: got %v after %d calls, want %v after 1", err, n, stop)
+	}
+}
+
+func TestCirculation(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	c, b1 := newTestChain(t, now)
+	exp := bc.Millis(now.Add(time.Minute))
+	hold := mustAssemble(t, "put")
+
+	// issueTx makes a transaction issuing the given amounts of an
+	// asset, distinguished by tag, into one output each.
+	issueTx := func(tag string, amounts ...int64) (*bc.Tx, bc.Hash) {
+		var total int64
+		for _, a := range amounts {
+			total += a
+		}
+		issuer := fmt.Sprintf("x'%x' %d nonce 0 split put %d '%s' issue", b1.Hash().Bytes(), exp, total, tag)
+		for _, a := range amounts[1:] {
+			issuer += fmt.Sprintf(" %d split put", a)
+		}
+		issuer += " put"
+		src := fmt.Sprintf("[%s] contract call\n", issuer)
+		for range amounts {
+			src += fmt.Sprintf("[get x'%x' output] contract call\n", hold)
+		}
+		src += "get finalize"
+		tx, err := bc.NewTx(mustAssemble(t, src), 3, 10000)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(tx.Outputs) != len(amounts) {
+			t.Fatalf("issuing %q: got %d outputs, want %d", tag, len(tx.Outputs), len(amounts))
+		}
+		_, assetID, _ := outputValue(tx.Outputs[0].Stack[0])
+		return tx, assetID
+	}
+	commit := func(txs ...*bc.Tx) {
+		b, s, err := c.GenerateBlock(ctx, c.State(), c.State().TimestampMS()+1, txs)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(b.Transactions) != len(txs) {
+			t.Fatalf("block has %d transactions, want %d", len(b.Transactions), len(txs))
+		}
+		err = c.CommitAppliedBlock(ctx, b, s)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+	check := func(want map[bc.Hash]int64) {
+		t.Helper()
+		got, err := c.Circulation(ctx)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("circulation = %v, want %v", got, want)
+		}
+	}
+
+	check(map[bc.Hash]int64{})
+
+	txA, assetA := issueTx("a", 7, 3)
+	txB, assetB := issueTx("b", 5)
+	if assetA == assetB {
+		t.Fatal("assets have the same ID")
+	}
+	commit(txA, txB)
+	check(map[bc.Hash]int64{assetA: 10, assetB: 5})
+
+	// Retiring an output takes it out of circulation.
+	var spent *bc.Output
+	for i := range txA.Outputs {
+		if outputAmount(t, &txA.Outputs[i]) == 3 {
+			spent = &txA.Outputs[i]
+		}
+	}
+	if spent == nil {
+		t.Fatal("no output of 3 units")
+	}
+	retire := mustAssemble(t, fmt.Sprintf(`
+		[x'%x' %d nonce put] contract call
+		{'C', x'%x', x'%x', %s} input call
+		get retire
+		get finalize
+	`, b1.Hash().Bytes(), exp, spent.Seed.Bytes(), spent.Program, spent.Stack[0]))
+	txRetire, err := bc.NewTx(retire, 3, 10000)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	commit(txRetire)
+	check(map[bc.Hash]int64{assetA: 7, assetB: 5})
+}
+
+func outputAmount(t *testing.T, out *bc.Output) int64 {
+	amount, _, ok := outputValue(out.Stack[0])
+	if !ok {
+		t.Fatalf("output %x holds no value", out.ID.Bytes())
+	}
+	return amount
+}
+
+func mustAssemble(t testing.TB, src string) []byte {
+	prog, err := asm.Assemble(src)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	return prog
+}
+
+func TestMaxFutureBlockTime(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	src, b1 := newTestChain(t, now)
+	src.MaxBlockWindow = 0 // generate blocks minutes apart
+	curState := src.State()
+	soon, soonState, err := src.GenerateBlock(ctx, curState, bc.Millis(now.Add(time.Minute)), nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = src.CommitAppliedBlock(ctx, soon, soonState)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	late, _, err := src.GenerateBlock(ctx, soonState, bc.Millis(now.Add(time.Hour)), nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	store := memstore.New()
+	c, err := NewChain(ctx, b1, store, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	c.MaxFutureBlockTime = 10 * time.Minute
+	st := state.Empty()
+	err = st.ApplyBlock(b1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, b1, st)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	err = c.CommitBlock(ctx, soon)
+	if err != nil {
+		t.Fatalf("block one minute ahead: got error %v", err)
+	}
+
+	err = c.CommitBlock(ctx, late)
+	if errors.Root(err) != ErrFutureBlock {
+		t.Errorf("block one hour ahead: got error %v, want %v", err, ErrFutureBlock)
+	}
+	if h, _ := store.Height(ctx); h != soon.Height {
+		t.Errorf("store height = %d, want %d", h, soon.Height)
+	}
+	err = c.CommitBlocks(ctx, []*bc.Block{late})
+	if errors.Root(err) != ErrFutureBlock {
+		t.Errorf("CommitBlocks one hour ahead: got error %v, want %v", err, ErrFutureBlock)
+	}
+
+	// Once the limit allows it, the same block is accepted.
+	c.MaxFutureBlockTime = 2 * time.Hour
+	err = c.CommitBlock(ctx, late)
+	if err != nil {
+		t.Errorf("retrying block with larger limit: got error %v", err)
+	}
+	if h := c.Height(); h != late.Height {
+		t.Errorf("height = %d, want %d", h, late.Height)
+	}
+}
+
+func TestMaxBlockWindow(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	src, b1 := newTestChain(t, now)
+	src.MaxBlockWindow = 0 // generate blocks minutes apart
+	b1State := src.State()
+	within, _, err := src.GenerateBlock(ctx, b1State, bc.Millis(now.Add(time.Minute)), nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	over, _, err := src.GenerateBlock(ctx, b1State, bc.Millis(now.Add(time.Hour)), nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	c, _ := newTestChain(t, now)
+	c.MaxBlockWindow = uint64(10 * time.Minute / time.Millisecond)
+
+	_, _, err = c.GenerateBlock(ctx, c.State(), bc.Millis(now.Add(time.Hour)), nil)
+	if errors.Root(err) != ErrBlockWindow {
+		t.Errorf("GenerateBlock one hour later: got error %v, want %v", err, ErrBlockWindow)
+	}
+	_, err = c.ValidateBlock(over)
+	if errors.Root(err) != ErrBlockWindow {
+		t.Errorf("ValidateBlock one hour later: got error %v, want %v", err, ErrBlockWindow)
+	}
+	err = c.CommitBlocks(ctx, []*bc.Block{over})
+	if errors.Root(err) != ErrBlockWindow {
+		t.Errorf("CommitBlocks one hour later: got error %v, want %v", err, ErrBlockWindow)
+	}
+	err = c.CommitBlock(ctx, over)
+	if errors.Root(err) != ErrBlockWindow {
+		t.Errorf("CommitBlock one hour later: got error %v, want %v", err, ErrBlockWindow)
+	}
+	if h := c.Height(); h != b1.Height {
+		t.Errorf("height = %d, want %d", h, b1.Height)
+	}
+
+	_, err = c.ValidateBlock(within)
+	if err != nil {
+		t.Errorf("ValidateBlock one minute later: got error %v", err)
+	}
+	err = c.CommitBlock(ctx, within)
+	if err != nil {
+		t.Fatalf("CommitBlock one minute later: got error %v", err)
+	}
+	if h := c.Height(); h != within.Height {
+		t.Errorf("height = %d, want %d", h, within.Height)
+	}
+}
+
 // newTestChain returns a new Chain using memstore for storage,
 // along with an initial block b1 (with a 0/0 multisig program).
 // It commits b1 before returning.
@@ -333,3 +1192,249 @@ func mustDecodeHash(s string) (h bc.Hash) {
 	}
 	return h
 }
+
+// prunedStore is a Store that has discarded the blocks below a
+// given height.
+type prunedStore struct {
+	Store
+	below uint64
+}
+
+func (s *prunedStore) GetBlock(ctx context.Context, height uint64) (*bc.Block, error) {
+	if height < s.below {
+		return nil, errors.WithDetailf(ErrPruned, "height %d", height)
+	}
+	return s.Store.GetBlock(ctx, height)
+}
+
+func TestEachBlock(t *testing.T) {
+	ctx := context.Background()
+	b1, err := NewInitialBlock(nil, 0, time.Now())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	store := &prunedStore{Store: memstore.New()}
+	c, err := NewChain(ctx, b1, store, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	st := state.Empty()
+	err = st.ApplyBlock(b1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, b1, st)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	for i := 0; i < 4; i++ {
+		makeEmptyBlock(t, c)
+	}
+
+	var heights []uint64
+	collect := func(b *bc.Block) error {
+		heights = append(heights, b.Height)
+		return nil
+	}
+
+	cases := []struct {
+		from uint64
+		want []uint64
+	}{
+		{0, []uint64{1, 2, 3, 4, 5}},
+		{2, []uint64{2, 3, 4, 5}},
+		{5, []uint64{5}},
+		{6, nil},
+	}
+	for _, test := range cases {
+		heights = nil
+		err := c.EachBlock(ctx, test.from, collect)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if !reflect.DeepEqual(heights, test.want) {
+			t.Errorf("EachBlock(%d) visited %v, want %v", test.from, heights, test.want)
+		}
+	}
+
+	// Stop early when fn fails.
+	errStop := errors.New("stop")
+	heights = nil
+	err = c.EachBlock(ctx, 2, func(b *bc.Block) error {
+		collect(b)
+		if b.Height == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Errorf("got error %v, want %v", err, errStop)
+	}
+	if want := []uint64{2, 3}; !reflect.DeepEqual(heights, want) {
+		t.Errorf("early stop visited %v, want %v", heights, want)
+	}
+
+	// Stop when ctx is canceled.
+	cctx, cancel := context.WithCancel(ctx)
+	heights = nil
+	err = c.EachBlock(cctx, 1, func(b *bc.Block) error {
+		collect(b)
+		cancel()
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if want := []uint64{1}; !reflect.DeepEqual(heights, want) {
+		t.Errorf("canceled iteration visited %v, want %v", heights, want)
+	}
+
+	// Report pruned blocks.
+	store.below = 3
+	heights = nil
+	err = c.EachBlock(ctx, 1, collect)
+	if errors.Root(err) != ErrPruned {
+		t.Errorf("got error %v, want %v", err, ErrPruned)
+	}
+	if len(heights) != 0 {
+		t.Errorf("pruned iteration visited %v, want none", heights)
+	}
+	heights = nil
+	err = c.EachBlock(ctx, 3, collect)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if want := []uint64{3, 4, 5}; !reflect.DeepEqual(heights, want) {
+		t.Errorf("EachBlock(3) after pruning visited %v, want %v", heights, want)
+	}
+}
+
+func TestCommitAppliedBlockContiguity(t *testing.T) {
+	ctx := context.Background()
+	c, b1 := newTestChain(t, time.Now())
+	src, _ := newTestChain(t, bc.FromMillis(b1.TimestampMs))
+
+	// Generate blocks 2 and 3 on src.
+	var (
+		blocks    []*bc.Block
+		snapshots []*state.Snapshot
+	)
+	for i := 0; i < 2; i++ {
+		curState := src.State()
+		b, s, err := src.GenerateBlock(ctx, curState, curState.TimestampMS()+1, nil)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = src.CommitAppliedBlock(ctx, b, s)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		blocks = append(blocks, b)
+		snapshots = append(snapshots, s)
+	}
+
+	// A gap block is rejected and not stored.
+	err := c.CommitAppliedBlock(ctx, blocks[1], snapshots[1])
+	if errors.Root(err) != ErrNonContiguousBlock {
+		t.Errorf("gap block: got error %v, want %v", err, ErrNonContiguousBlock)
+	}
+	if _, err := c.GetBlock(ctx, blocks[1].Height); err == nil {
+		t.Error("gap block was stored")
+	}
+
+	// So is a block with the wrong snapshot.
+	err = c.CommitAppliedBlock(ctx, blocks[0], snapshots[1])
+	if errors.Root(err) != ErrNonContiguousBlock {
+		t.Errorf("mismatched snapshot: got error %v, want %v", err, ErrNonContiguousBlock)
+	}
+
+	err = c.CommitAppliedBlock(ctx, blocks[0], snapshots[0])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, blocks[1], snapshots[1])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Recommitting a block is harmless.
+	err = c.CommitAppliedBlock(ctx, blocks[0], snapshots[0])
+	if err != nil {
+		t.Errorf("recommitting block: unexpected error %v", err)
+	}
+
+	// A different, stale block is rejected.
+	stale := *blocks[0]
+	staleHeader := *stale.BlockHeader
+	staleHeader.TimestampMs++
+	stale.BlockHeader = &staleHeader
+	err = c.CommitAppliedBlock(ctx, &stale, snapshots[0])
+	if errors.Root(err) != ErrNonContiguousBlock {
+		t.Errorf("stale block: got error %v, want %v", err, ErrNonContiguousBlock)
+	}
+	if c.Height() != blocks[1].Height {
+		t.Errorf("chain height %d, want %d", c.Height(), blocks[1].Height)
+	}
+
+	// Once the Store has pruned the block, recommitting it is still
+	// harmless.
+	store := &prunedStore{Store: c.getStore(), below: blocks[1].Height}
+	err = c.SwapStore(ctx, store)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, blocks[0], snapshots[0])
+	if err != nil {
+		t.Errorf("recommitting pruned block: unexpected error %v", err)
+	}
+}
+
+func TestCommitVerifiedBlock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	src, b1 := newTestChain(t, now)
+	fast, _ := newTestChain(t, now)
+	slow, _ := newTestChain(t, now)
+
+	curState := src.State()
+	txs := []*bc.Tx{bctest.EmptyTx(t, b1.Hash(), now.Add(time.Hour))}
+	b2, s2, err := src.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	other, otherSnapshot, err := src.GenerateBlock(ctx, curState, curState.TimestampMS()+2, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Snapshots that don't belong to the block are rejected.
+	err = fast.CommitVerifiedBlock(ctx, b2, otherSnapshot)
+	if errors.Root(err) != ErrSnapshotMismatch {
+		t.Errorf("snapshot for %x: got error %v, want %v", other.Hash().Bytes(), err, ErrSnapshotMismatch)
+	}
+	doctored := state.Copy(s2)
+	doctored.ContractsTree.Insert(bc.NewHash([32]byte{1}).Bytes())
+	err = fast.CommitVerifiedBlock(ctx, b2, doctored)
+	if errors.Root(err) != ErrBadContractsRoot {
+		t.Errorf("doctored snapshot: got error %v, want %v", err, ErrBadContractsRoot)
+	}
+	if h := fast.Height(); h != 1 {
+		t.Fatalf("height after rejected commits = %d, want 1", h)
+	}
+
+	err = fast.CommitVerifiedBlock(ctx, b2, s2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = slow.CommitBlock(ctx, b2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	got, want := fast.State(), slow.State()
+	if got.Height() != want.Height() {
+		t.Errorf("height %d, want %d", got.Height(), want.Height())
+	}
+	if got.ContractsTree.RootHash() != want.ContractsTree.RootHash() || got.NonceTree.RootHash() != want.NonceTree.RootHash() {
+		t.Error("committed state differs from recomputed state")
+	}
+}
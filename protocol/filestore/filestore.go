@@ -0,0 +1,196 @@
+// Package filestore is a protocol.Store implementation that keeps
+// blockchain data in files in a local directory, for nodes that want
+// durable storage without running a database server.
+//
+// Each block is a file in the directory's blocks subdirectory, named
+// by its height, and the latest state snapshot is the file snapshot.
+// Every file is written to a temporary name, synced, and renamed into
+// place, so a crash leaves either the old contents or the new.
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/state"
+)
+
+// ErrNonContiguous is returned by SaveBlock for a block more than one
+// above the Store's height.
+var ErrNonContiguous = errors.New("block does not follow store height")
+
+// Store satisfies the protocol.Store interface.
+type Store struct {
+	dir     string
+	heights chan uint64
+
+	mu     sync.Mutex // protects height
+	height uint64
+}
+
+// Open returns a Store keeping its files in dir, creating it if
+// necessary. Its height is that of the highest block in an unbroken
+// run of blocks from height 1 already saved there.
+func Open(dir string) (*Store, error) {
+	err := os.MkdirAll(filepath.Join(dir, "blocks"), 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating store directory")
+	}
+	s := &Store{
+		dir:     dir,
+		heights: make(chan uint64, 1),
+	}
+	for {
+		_, err := os.Stat(s.blockPath(s.height + 1))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "checking for block %d", s.height+1)
+		}
+		s.height++
+	}
+	return s, nil
+}
+
+// Heights returns a channel on which the Store sends each height
+// passed to FinalizeHeight, for passing to protocol.NewChain. If a
+// height is not received before the next is finalized, it is
+// replaced by the next, so a slow reader sees only the latest.
+func (s *Store) Heights() <-chan uint64 {
+	return s.heights
+}
+
+// Height satisfies the protocol.Store interface.
+func (s *Store) Height(context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.height, nil
+}
+
+// GetBlock satisfies the protocol.Store interface. If there is no
+// file for the block, as when old block files have been removed to
+// save space, it fails with protocol.ErrPruned.
+func (s *Store) GetBlock(ctx context.Context, height uint64) (*bc.Block, error) {
+	bits, err := ioutil.ReadFile(s.blockPath(height))
+	if os.IsNotExist(err) {
+		return nil, errors.WithDetailf(protocol.ErrPruned, "no block file at height %d", height)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading block %d", height)
+	}
+	b := new(bc.Block)
+	err = b.FromBytes(bits)
+	return b, errors.Wrapf(err, "parsing block %d", height)
+}
+
+// LatestSnapshot satisfies the protocol.Store interface. If no
+// snapshot has been saved, it returns an empty one.
+func (s *Store) LatestSnapshot(context.Context) (*state.Snapshot, error) {
+	bits, err := ioutil.ReadFile(filepath.Join(s.dir, "snapshot"))
+	if os.IsNotExist(err) {
+		return state.Empty(), nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading snapshot")
+	}
+	snapshot := state.Empty()
+	err = snapshot.FromBytes(bits)
+	return snapshot, errors.Wrap(err, "parsing snapshot")
+}
+
+// SaveBlock satisfies the protocol.Store interface. Saving a block
+// that is already saved succeeds; saving a different block at its
+// height fails, as does saving a block more than one above the
+// Store's height, with ErrNonContiguous.
+func (s *Store) SaveBlock(ctx context.Context, b *bc.Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b.Height <= s.height {
+		existing, err := s.GetBlock(ctx, b.Height)
+		if err != nil {
+			return err
+		}
+		if existing.Hash() != b.Hash() {
+			return fmt.Errorf("already have a block at height %d", b.Height)
+		}
+		return nil
+	}
+	if b.Height != s.height+1 {
+		return errors.WithDetailf(ErrNonContiguous, "height %d, store height %d", b.Height, s.height)
+	}
+	bits, err := b.Bytes()
+	if err != nil {
+		return errors.Wrapf(err, "serializing block %d", b.Height)
+	}
+	err = writeFile(s.blockPath(b.Height), bits)
+	if err != nil {
+		return errors.Wrapf(err, "writing block %d", b.Height)
+	}
+	s.height = b.Height
+	return nil
+}
+
+// FinalizeHeight satisfies the protocol.Store interface. It sends
+// height on the channel returned by Heights.
+func (s *Store) FinalizeHeight(ctx context.Context, height uint64) error {
+	for {
+		select {
+		case s.heights <- height:
+			return nil
+		default:
+		}
+		// Discard the unreceived height, if it's still there.
+		select {
+		case <-s.heights:
+		default:
+		}
+	}
+}
+
+// SaveSnapshot satisfies the protocol.Store interface. It replaces
+// any snapshot saved before.
+func (s *Store) SaveSnapshot(ctx context.Context, snapshot *state.Snapshot) error {
+	bits, err := snapshot.Bytes()
+	if err != nil {
+		return errors.Wrap(err, "serializing snapshot")
+	}
+	err = writeFile(filepath.Join(s.dir, "snapshot"), bits)
+	return errors.Wrap(err, "writing snapshot")
+}
+
+func (s *Store) blockPath(height uint64) string {
+	return filepath.Join(s.dir, "blocks", fmt.Sprintf("%020d", height))
+}
+
+// writeFile atomically replaces the contents of the file at path
+// with bits.
+func writeFile(path string, bits []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(bits)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+package filestore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/bc/bctest"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/testutil"
+)
+
+func TestCommitRecover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := Open(dir)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	now := time.Now()
+	b1, err := protocol.NewInitialBlock(nil, 0, now)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	c, err := protocol.NewChain(ctx, b1, store, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	c.MaxNonceWindow = 48 * time.Hour
+	st := state.Empty()
+	err = st.ApplyBlock(b1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, b1, st)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	commit := func(c *protocol.Chain, n int) {
+		for i := 0; i < n; i++ {
+			curState := c.State()
+			txs := []*bc.Tx{bctest.EmptyTx(t, b1.Hash(), now.Add(time.Hour))}
+			b, s, err := c.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+			err = c.CommitAppliedBlock(ctx, b, s)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+		}
+	}
+	commit(c, 3)
+	select {
+	case h := <-store.Heights():
+		if h != 4 {
+			t.Errorf("finalized height %d, want 4", h)
+		}
+	default:
+		t.Error("no finalized height")
+	}
+
+	// Save a snapshot partway, then commit past it, so recovery must
+	// replay blocks.
+	err = store.SaveSnapshot(ctx, c.State())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	commit(c, 2)
+	want := c.State()
+
+	// Restart on the same directory.
+	store, err = Open(dir)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if h, _ := store.Height(ctx); h != 6 {
+		t.Fatalf("reopened store height %d, want 6", h)
+	}
+	c, err = protocol.NewChain(ctx, b1, store, store.Heights())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	got, err := c.Recover(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if got.Height() != want.Height() {
+		t.Errorf("recovered height %d, want %d", got.Height(), want.Height())
+	}
+	if got.ContractsTree.RootHash() != want.ContractsTree.RootHash() || got.NonceTree.RootHash() != want.NonceTree.RootHash() {
+		t.Error("recovered state differs from state before restart")
+	}
+	for h := uint64(1); h <= want.Height(); h++ {
+		b, err := store.GetBlock(ctx, h)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if b.Height != h {
+			t.Errorf("block at height %d has height %d", h, b.Height)
+		}
+	}
+
+	// The recovered chain carries on.
+	commit(c, 1)
+	if h := c.Height(); h != 7 {
+		t.Errorf("height after restart and commit = %d, want 7", h)
+	}
+}
+
+func TestSaveBlock(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := Open(dir)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	b1, err := protocol.NewInitialBlock(nil, 0, time.Now())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = store.SaveBlock(ctx, b1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Saving again is harmless; saving a different block is not.
+	err = store.SaveBlock(ctx, b1)
+	if err != nil {
+		t.Errorf("saving block again: %v", err)
+	}
+	other, err := protocol.NewInitialBlock(nil, 0, time.Now().Add(time.Second))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = store.SaveBlock(ctx, other)
+	if err == nil {
+		t.Error("saving conflicting block succeeded")
+	}
+
+	// Heights only increase one at a time.
+	gap := &bc.Block{BlockHeader: &bc.BlockHeader{Height: 3}}
+	err = store.SaveBlock(ctx, gap)
+	if errors.Root(err) != ErrNonContiguous {
+		t.Errorf("saving block 3 at height 1: got error %v, want %v", err, ErrNonContiguous)
+	}
+	if h, _ := store.Height(ctx); h != 1 {
+		t.Errorf("height = %d, want 1", h)
+	}
+	_, err = store.GetBlock(ctx, 2)
+	if errors.Root(err) != protocol.ErrPruned {
+		t.Errorf("getting missing block 2: got error %v, want %v", err, protocol.ErrPruned)
+	}
+
+	snapshot, err := store.LatestSnapshot(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if snapshot.Height() != 0 {
+		t.Errorf("initial snapshot height %d, want 0", snapshot.Height())
+	}
+}
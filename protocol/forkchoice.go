@@ -0,0 +1,47 @@
+package protocol
+
+import (
+	"bytes"
+
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// TipWeight is a measure of the chain ending in a given block, for
+// choosing between competing valid chains: the heavier tip wins. For
+// now the weight of a chain is its height, but it is kept as a
+// struct, compared only with Compare, so that other measures, such as
+// the voting weight of a block's signers, can be added later.
+type TipWeight struct {
+	Height uint64
+
+	// ID is the ID of the tip block. It is not part of the weight,
+	// but breaks ties between equally heavy tips.
+	ID bc.Hash
+}
+
+// Weight returns the TipWeight of the chain ending in tip.
+func Weight(tip *bc.BlockHeader) TipWeight {
+	return TipWeight{Height: tip.Height, ID: tip.Hash()}
+}
+
+// Compare returns a positive number if w is preferred over other, a
+// negative number if other is preferred over w, and 0 if they are
+// the weights of the same tip. A greater height is preferred. Between
+// distinct tips of the same height, the one with the smaller ID,
+// compared as a byte string, is preferred, so that every node makes
+// the same choice.
+func (w TipWeight) Compare(other TipWeight) int {
+	switch {
+	case w.Height > other.Height:
+		return 1
+	case w.Height < other.Height:
+		return -1
+	}
+	return bytes.Compare(other.ID.Bytes(), w.ID.Bytes())
+}
+
+// CompareTips compares the chains ending in a and b as with
+// TipWeight.Compare: positive if a is preferred, negative if b is.
+func CompareTips(a, b *bc.BlockHeader) int {
+	return Weight(a).Compare(Weight(b))
+}
@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chain/txvm/protocol/bc"
+)
+
+func TestCompareTips(t *testing.T) {
+	header := func(height, ts uint64) *bc.BlockHeader {
+		return &bc.BlockHeader{
+			Version:       3,
+			Height:        height,
+			TimestampMs:   ts,
+			NextPredicate: &bc.Predicate{Version: 1},
+		}
+	}
+
+	low, high := header(5, 1000), header(6, 1000)
+	if CompareTips(high, low) <= 0 {
+		t.Error("lower tip preferred over higher")
+	}
+	if CompareTips(low, high) >= 0 {
+		t.Error("lower tip preferred over higher, with arguments swapped")
+	}
+
+	// A later tip wins even with a smaller ID.
+	for ts := uint64(0); ts < 10; ts++ {
+		a, b := header(5, ts), header(6, ts)
+		aID, bID := a.Hash(), b.Hash()
+		if bytes.Compare(aID.Bytes(), bID.Bytes()) > 0 && CompareTips(b, a) <= 0 {
+			t.Errorf("timestamp %d: higher tip with larger ID lost", ts)
+		}
+	}
+
+	a, b := header(5, 1000), header(5, 2000)
+	aID, bID := a.Hash(), b.Hash()
+	want := 1
+	if bytes.Compare(aID.Bytes(), bID.Bytes()) > 0 {
+		want = -1
+	}
+	if got := CompareTips(a, b); got != want {
+		t.Errorf("tie: CompareTips(a, b) = %d, want %d", got, want)
+	}
+	if got := CompareTips(b, a); got != -want {
+		t.Errorf("tie: CompareTips(b, a) = %d, want %d", got, -want)
+	}
+	if got := CompareTips(a, a); got != 0 {
+		t.Errorf("CompareTips(a, a) = %d, want 0", got)
+	}
+}
@@ -22,30 +22,81 @@ func Root(items [][]byte) [32]byte {
 		return emptyStringHash
 
 	case 1:
-		h := sha3pool.Get256()
-		defer sha3pool.Put256(h)
-
-		h.Write(leafPrefix)
-		h.Write(items[0])
-		var root [32]byte
-		h.Read(root[:])
-		return root
+		return LeafHash(items[0])
 
 	default:
 		k := prevPowerOfTwo(len(items))
 		left := Root(items[:k])
 		right := Root(items[k:])
+		return InteriorHash(left, right)
+	}
+}
+
+// LeafHash returns the hash of a tree leaf containing item.
+func LeafHash(item []byte) [32]byte {
+	h := sha3pool.Get256()
+	defer sha3pool.Put256(h)
+
+	h.Write(leafPrefix)
+	h.Write(item)
+	var res [32]byte
+	h.Read(res[:])
+	return res
+}
+
+// InteriorHash returns the hash of an interior tree node with the
+// given children.
+func InteriorHash(left, right [32]byte) [32]byte {
+	h := sha3pool.Get256()
+	defer sha3pool.Put256(h)
+
+	h.Write(interiorPrefix)
+	h.Write(left[:])
+	h.Write(right[:])
+	var res [32]byte
+	h.Read(res[:])
+	return res
+}
+
+// ProofStep is one step of an inclusion proof: the hash of a sibling
+// of a node on the path from a leaf to the root.
+type ProofStep struct {
+	Hash [32]byte
+
+	// Left is true if the sibling is the left child of its parent,
+	// i.e. the node on the path is the right child.
+	Left bool
+}
 
-		h := sha3pool.Get256()
-		defer sha3pool.Put256(h)
-		h.Write(interiorPrefix)
-		h.Write(left[:])
-		h.Write(right[:])
+// Proof returns the inclusion proof for items[i] in the tree built
+// by Root(items), ordered from the leaf up to the root.
+// It panics if i is out of range.
+func Proof(items [][]byte, i int) []ProofStep {
+	if i < 0 || i >= len(items) {
+		panic("merkle: proof index out of range")
+	}
+	if len(items) == 1 {
+		return nil
+	}
+	k := prevPowerOfTwo(len(items))
+	if i < k {
+		return append(Proof(items[:k], i), ProofStep{Hash: Root(items[k:])})
+	}
+	return append(Proof(items[k:], i-k), ProofStep{Hash: Root(items[:k]), Left: true})
+}
 
-		var root [32]byte
-		h.Read(root[:])
-		return root
+// VerifyProof tells whether proof shows that item is a leaf of the
+// tree with the given root.
+func VerifyProof(item []byte, proof []ProofStep, root [32]byte) bool {
+	h := LeafHash(item)
+	for _, step := range proof {
+		if step.Left {
+			h = InteriorHash(step.Hash, h)
+		} else {
+			h = InteriorHash(h, step.Hash)
+		}
 	}
+	return h == root
 }
 
 // prevPowerOfTwo returns the largest power of two that is smaller than a given number.
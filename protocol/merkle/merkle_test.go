@@ -68,3 +68,28 @@ func TestVectors(t *testing.T) {
 func hash2hex(hash [32]byte) string {
 	return hex.EncodeToString(hash[:])
 }
+
+func TestProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		var items [][]byte
+		for i := 0; i < n; i++ {
+			items = append(items, []byte{byte(i)})
+		}
+		root := Root(items)
+		for i := range items {
+			proof := Proof(items, i)
+			if !VerifyProof(items[i], proof, root) {
+				t.Errorf("n=%d i=%d: proof does not verify", n, i)
+			}
+			if VerifyProof([]byte{0xff}, proof, root) {
+				t.Errorf("n=%d i=%d: proof verifies for wrong item", n, i)
+			}
+			if len(proof) > 0 {
+				proof[0].Left = !proof[0].Left
+				if VerifyProof(items[i], proof, root) {
+					t.Errorf("n=%d i=%d: proof with flipped direction verifies", n, i)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package protocol
+
+import (
+	"context"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/log"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/state"
+)
+
+// MirrorPolicy says what a MirroringStore does when a write to one of
+// its secondary Stores fails.
+type MirrorPolicy int
+
+const (
+	// MirrorLogErrors logs the error and goes on to the remaining
+	// secondaries. The write succeeds.
+	MirrorLogErrors MirrorPolicy = iota
+
+	// MirrorFailOnError makes the write fail with the error, without
+	// writing to the remaining secondaries. The primary, and any
+	// secondaries before the failing one, keep the write.
+	MirrorFailOnError
+)
+
+// MirroringStore is a Store that writes to a primary Store and then
+// to each of its secondary Stores in order, as when migrating to a new
+// Store or keeping a hot standby. Reads go only to the primary.
+//
+// A write that fails on the primary is not attempted on the
+// secondaries. What happens when it fails on a secondary depends on
+// Policy.
+type MirroringStore struct {
+	Primary     Store
+	Secondaries []Store
+	Policy      MirrorPolicy
+}
+
+// NewMirroringStore returns a MirroringStore writing to primary and
+// then to secondaries, handling secondary failures with policy.
+func NewMirroringStore(policy MirrorPolicy, primary Store, secondaries ...Store) *MirroringStore {
+	return &MirroringStore{
+		Primary:     primary,
+		Secondaries: secondaries,
+		Policy:      policy,
+	}
+}
+
+// Height satisfies the Store interface.
+func (m *MirroringStore) Height(ctx context.Context) (uint64, error) {
+	return m.Primary.Height(ctx)
+}
+
+// GetBlock satisfies the Store interface.
+func (m *MirroringStore) GetBlock(ctx context.Context, height uint64) (*bc.Block, error) {
+	return m.Primary.GetBlock(ctx, height)
+}
+
+// LatestSnapshot satisfies the Store interface.
+func (m *MirroringStore) LatestSnapshot(ctx context.Context) (*state.Snapshot, error) {
+	return m.Primary.LatestSnapshot(ctx)
+}
+
+// SaveBlock satisfies the Store interface.
+func (m *MirroringStore) SaveBlock(ctx context.Context, b *bc.Block) error {
+	return m.mirror(ctx, "saving block", func(s Store) error {
+		return s.SaveBlock(ctx, b)
+	})
+}
+
+// FinalizeHeight satisfies the Store interface.
+func (m *MirroringStore) FinalizeHeight(ctx context.Context, height uint64) error {
+	return m.mirror(ctx, "finalizing height", func(s Store) error {
+		return s.FinalizeHeight(ctx, height)
+	})
+}
+
+// SaveSnapshot satisfies the Store interface.
+func (m *MirroringStore) SaveSnapshot(ctx context.Context, snapshot *state.Snapshot) error {
+	return m.mirror(ctx, "saving snapshot", func(s Store) error {
+		return s.SaveSnapshot(ctx, snapshot)
+	})
+}
+
+func (m *MirroringStore) mirror(ctx context.Context, at string, write func(Store) error) error {
+	err := write(m.Primary)
+	if err != nil {
+		return err
+	}
+	for i, s := range m.Secondaries {
+		err := write(s)
+		if err == nil {
+			continue
+		}
+		if m.Policy == MirrorFailOnError {
+			return errors.Wrapf(err, "%s in secondary store %d", at, i)
+		}
+		log.Error(ctx, err, "at", at+" in secondary store", "store", i)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/prottest/memstore"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/testutil"
+)
+
+func TestMirroringStore(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := memstore.New(), memstore.New()
+	store := NewMirroringStore(MirrorFailOnError, primary, secondary)
+
+	b1, err := NewInitialBlock(nil, 0, time.Now())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	chain, err := NewChain(ctx, b1, store, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	st := state.Empty()
+	err = st.ApplyBlock(b1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = chain.CommitAppliedBlock(ctx, b1, st)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	makeEmptyBlock(t, chain)
+	b := chain.State().Header
+	err = store.SaveSnapshot(ctx, chain.State())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	for name, m := range map[string]*memstore.MemStore{"primary": primary, "secondary": secondary} {
+		if len(m.Blocks) != 2 || m.Blocks[2] == nil || m.Blocks[2].Hash() != b.Hash() {
+			t.Errorf("%s has blocks %v, want 2 ending with %x", name, m.Blocks, b.Hash().Bytes())
+		}
+		if m.State == nil || m.State.Height() != 2 {
+			t.Errorf("%s has no snapshot at height 2", name)
+		}
+	}
+}
+
+func TestMirroringStoreFailure(t *testing.T) {
+	ctx := context.Background()
+	b1, err := NewInitialBlock(nil, 0, time.Now())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	cases := []struct {
+		policy  MirrorPolicy
+		wantErr error
+	}{
+		{MirrorLogErrors, nil},
+		{MirrorFailOnError, errPermanent},
+	}
+	for _, c := range cases {
+		primary, last := memstore.New(), memstore.New()
+		failing := &flakyStore{MemStore: memstore.New(), err: errPermanent, failures: 1}
+		store := NewMirroringStore(c.policy, primary, failing, last)
+
+		err := store.SaveBlock(ctx, b1)
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("policy %d: got error %v, want %v", c.policy, err, c.wantErr)
+		}
+		if primary.Blocks[1] == nil {
+			t.Errorf("policy %d: primary did not get the block", c.policy)
+		}
+		if got, want := last.Blocks[1] != nil, c.wantErr == nil; got != want {
+			t.Errorf("policy %d: secondary after the failing one got the block = %t, want %t", c.policy, got, want)
+		}
+	}
+
+	// A failure in the primary is not mirrored.
+	primary := &flakyStore{MemStore: memstore.New(), err: errPermanent, failures: 1}
+	secondary := memstore.New()
+	store := NewMirroringStore(MirrorLogErrors, primary, secondary)
+	err = store.SaveBlock(ctx, b1)
+	if errors.Root(err) != errPermanent {
+		t.Errorf("got error %v, want %v", err, errPermanent)
+	}
+	if len(secondary.Blocks) != 0 {
+		t.Error("secondary got the block after the primary failed")
+	}
+}
@@ -0,0 +1,137 @@
+package protocol
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// OrphanPool buffers blocks whose predecessor is not yet known, as
+// happens when blocks arrive out of order during sync. Blocks are
+// indexed by their previous block ID, so that when a parent is
+// committed, Connect can return every buffered descendant that is now
+// ready to be committed.
+//
+// The pool holds at most a fixed number of blocks. When it is full,
+// adding a block evicts the one that has been in the pool longest.
+//
+// OrphanPool is safe for concurrent use.
+type OrphanPool struct {
+	mu     sync.Mutex
+	max    int
+	blocks map[bc.Hash]*list.Element // block hash -> element in order
+	byPrev map[bc.Hash][]bc.Hash     // previous block ID -> children
+	order  *list.List                // of *bc.Block, oldest first
+}
+
+// NewOrphanPool returns an OrphanPool holding at most max blocks.
+func NewOrphanPool(max int) *OrphanPool {
+	return &OrphanPool{
+		max:    max,
+		blocks: make(map[bc.Hash]*list.Element),
+		byPrev: make(map[bc.Hash][]bc.Hash),
+		order:  list.New(),
+	}
+}
+
+// Add buffers b until its predecessor is connected. It returns the
+// blocks, if any, evicted to make room. Adding a block already in the
+// pool, or a block with no previous block ID, has no effect.
+func (p *OrphanPool) Add(b *bc.Block) (evicted []*bc.Block) {
+	if b.PreviousBlockId == nil || p.max <= 0 {
+		return nil
+	}
+	hash := b.Hash()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.blocks[hash]; ok {
+		return nil
+	}
+	for p.order.Len() >= p.max {
+		oldest := p.order.Front().Value.(*bc.Block)
+		p.remove(oldest.Hash())
+		evicted = append(evicted, oldest)
+	}
+	p.blocks[hash] = p.order.PushBack(b)
+	prev := *b.PreviousBlockId
+	p.byPrev[prev] = append(p.byPrev[prev], hash)
+	return evicted
+}
+
+// Connect removes from the pool and returns all buffered blocks that
+// descend from the block with ID parent, in order of increasing height.
+// Blocks at the same height (competing children) are ordered by when
+// they were added.
+func (p *OrphanPool) Connect(parent bc.Hash) []*bc.Block {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var (
+		result []*bc.Block
+		queue  = []bc.Hash{parent}
+	)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, child := range p.byPrev[id] {
+			elem, ok := p.blocks[child]
+			if !ok {
+				continue
+			}
+			result = append(result, elem.Value.(*bc.Block))
+			queue = append(queue, child)
+		}
+		for _, child := range p.byPrev[id] {
+			p.remove(child)
+		}
+		delete(p.byPrev, id)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Height < result[j].Height
+	})
+	return result
+}
+
+// Has tells whether the block with the given ID is in the pool.
+func (p *OrphanPool) Has(hash bc.Hash) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.blocks[hash]
+	return ok
+}
+
+// Len returns the number of blocks in the pool.
+func (p *OrphanPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.order.Len()
+}
+
+// remove deletes the block with the given hash from p.
+// The caller must hold p.mu.
+func (p *OrphanPool) remove(hash bc.Hash) {
+	elem, ok := p.blocks[hash]
+	if !ok {
+		return
+	}
+	b := p.order.Remove(elem).(*bc.Block)
+	delete(p.blocks, hash)
+
+	prev := *b.PreviousBlockId
+	siblings := p.byPrev[prev]
+	for i, h := range siblings {
+		if h == hash {
+			siblings = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.byPrev, prev)
+	} else {
+		p.byPrev[prev] = siblings
+	}
+}
@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// orphanChain returns n blocks, each the child of the one before,
+// with the first a child of parent.
+func orphanChain(parent bc.Hash, height uint64, n int) []*bc.Block {
+	var blocks []*bc.Block
+	for i := 0; i < n; i++ {
+		prev := parent
+		b := &bc.Block{BlockHeader: &bc.BlockHeader{
+			Version:         3,
+			Height:          height + uint64(i),
+			PreviousBlockId: &prev,
+			TimestampMs:     1000 + uint64(i),
+			NextPredicate:   &bc.Predicate{Version: 1},
+		}}
+		blocks = append(blocks, b)
+		parent = b.Hash()
+	}
+	return blocks
+}
+
+func TestOrphanPoolConnect(t *testing.T) {
+	root := bc.NewHash([32]byte{1})
+	chain := orphanChain(root, 2, 4)
+	p := NewOrphanPool(10)
+
+	// Add out of order.
+	for _, i := range []int{3, 1, 2, 0} {
+		if ev := p.Add(chain[i]); len(ev) > 0 {
+			t.Fatalf("Add evicted %d blocks", len(ev))
+		}
+	}
+	p.Add(chain[1]) // duplicate
+	if got := p.Len(); got != 4 {
+		t.Fatalf("Len = %d, want 4", got)
+	}
+
+	if got := p.Connect(bc.NewHash([32]byte{2})); len(got) != 0 {
+		t.Errorf("Connect(unknown parent) = %d blocks, want 0", len(got))
+	}
+
+	got := p.Connect(root)
+	if len(got) != len(chain) {
+		t.Fatalf("Connect returned %d blocks, want %d", len(got), len(chain))
+	}
+	for i, b := range got {
+		if b != chain[i] {
+			t.Errorf("block %d has height %d, want %d", i, b.Height, chain[i].Height)
+		}
+	}
+	if got := p.Len(); got != 0 {
+		t.Errorf("Len after Connect = %d, want 0", got)
+	}
+}
+
+func TestOrphanPoolPartial(t *testing.T) {
+	root := bc.NewHash([32]byte{1})
+	chain := orphanChain(root, 2, 3)
+	other := orphanChain(bc.NewHash([32]byte{2}), 7, 1)
+	p := NewOrphanPool(10)
+	p.Add(chain[1])
+	p.Add(chain[2])
+	p.Add(other[0])
+
+	// chain[0] is missing, so nothing connects to root.
+	if got := p.Connect(root); len(got) != 0 {
+		t.Errorf("Connect(root) = %d blocks, want 0", len(got))
+	}
+	got := p.Connect(chain[0].Hash())
+	if len(got) != 2 || got[0] != chain[1] || got[1] != chain[2] {
+		t.Errorf("Connect(chain[0]) = %v, want chain[1:]", got)
+	}
+	if !p.Has(other[0].Hash()) || p.Len() != 1 {
+		t.Errorf("unrelated orphan not retained")
+	}
+}
+
+func TestOrphanPoolEviction(t *testing.T) {
+	chain := orphanChain(bc.NewHash([32]byte{1}), 2, 5)
+	p := NewOrphanPool(3)
+	for _, b := range chain[:3] {
+		p.Add(b)
+	}
+	ev := p.Add(chain[3])
+	if len(ev) != 1 || ev[0] != chain[0] {
+		t.Fatalf("evicted %v, want chain[0]", ev)
+	}
+	ev = p.Add(chain[4])
+	if len(ev) != 1 || ev[0] != chain[1] {
+		t.Fatalf("evicted %v, want chain[1]", ev)
+	}
+	if p.Has(chain[0].Hash()) || p.Has(chain[1].Hash()) {
+		t.Error("evicted blocks still in pool")
+	}
+	if got := p.Len(); got != 3 {
+		t.Errorf("Len = %d, want 3", got)
+	}
+
+	// With chain[1] evicted, the rest connect from it.
+	got := p.Connect(chain[1].Hash())
+	if len(got) != 3 || got[0] != chain[2] || got[2] != chain[4] {
+		t.Errorf("Connect(chain[1]) = %v, want chain[2:]", got)
+	}
+}
@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// BlockOutputs lists the outputs created and spent by a block, as
+// reported by OutputDiff.
+type BlockOutputs struct {
+	// Created holds the IDs of the outputs the block's transactions
+	// create, in the order they create them.
+	Created []bc.Hash
+
+	// Spent holds the IDs of the outputs the block's transactions
+	// spend, in the order they spend them.
+	Spent []bc.Hash
+}
+
+// OutputDiff returns the outputs created and spent by the committed
+// block at the given height, for building streams of create and
+// spend events. An output both created and spent within the block
+// appears in both lists.
+//
+// It reads only the block, taking the outputs from the contracts
+// recorded with its transactions, and runs no transaction programs.
+// It fails with ErrPruned if the block is missing. To compare the
+// output sets of two snapshots instead, use state.Diff.
+func (c *Chain) OutputDiff(ctx context.Context, height uint64) (*BlockOutputs, error) {
+	if height == 0 || height > c.Height() {
+		return nil, fmt.Errorf("no committed block at height %d", height)
+	}
+	block, err := c.getStore().GetBlock(ctx, height)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting block %d", height)
+	}
+	d := new(BlockOutputs)
+	for _, tx := range block.Transactions {
+		for _, con := range tx.Contracts {
+			switch con.Type {
+			case bc.InputType:
+				d.Spent = append(d.Spent, con.ID)
+			case bc.OutputType:
+				d.Created = append(d.Created, con.ID)
+			}
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/prottest/memstore"
+	"github.com/chain/txvm/testutil"
+)
+
+func TestOutputDiff(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c, _ := newTestChain(t, now)
+
+	id := func(i byte) bc.Hash { return bc.NewHash([32]byte{i}) }
+	output := func(i byte) bc.Contract { return bc.Contract{Type: bc.OutputType, ID: id(i)} }
+	input := func(i byte) bc.Contract { return bc.Contract{Type: bc.InputType, ID: id(i)} }
+
+	blocks := [][]*bc.Tx{
+		{
+			{ID: id(101), Contracts: []bc.Contract{output(1), output(2)}},
+			{ID: id(102), Contracts: []bc.Contract{output(3)}},
+		},
+		{
+			{ID: id(103), Contracts: []bc.Contract{input(1), output(4)}},
+			// Output 5 is created and spent within the block.
+			{ID: id(104), Contracts: []bc.Contract{input(3), output(5)}},
+			{ID: id(105), Contracts: []bc.Contract{input(5)}},
+		},
+	}
+	for _, txs := range blocks {
+		curState := c.State()
+		b, s, err := c.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(b.Transactions) != len(txs) {
+			t.Fatalf("generated block has %d transactions, want %d", len(b.Transactions), len(txs))
+		}
+		err = c.CommitAppliedBlock(ctx, b, s)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	cases := []struct {
+		height  uint64
+		created []bc.Hash
+		spent   []bc.Hash
+	}{
+		{1, nil, nil},
+		{2, []bc.Hash{id(1), id(2), id(3)}, nil},
+		{3, []bc.Hash{id(4), id(5)}, []bc.Hash{id(1), id(3), id(5)}},
+	}
+	for _, tc := range cases {
+		d, err := c.OutputDiff(ctx, tc.height)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if !reflect.DeepEqual(d.Created, tc.created) {
+			t.Errorf("block %d: created = %x, want %x", tc.height, d.Created, tc.created)
+		}
+		if !reflect.DeepEqual(d.Spent, tc.spent) {
+			t.Errorf("block %d: spent = %x, want %x", tc.height, d.Spent, tc.spent)
+		}
+	}
+
+	_, err := c.OutputDiff(ctx, c.Height()+1)
+	if err == nil {
+		t.Error("diffing uncommitted block succeeded")
+	}
+}
+
+func TestOutputDiffPruned(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestChain(t, time.Now())
+	makeEmptyBlock(t, c)
+	makeEmptyBlock(t, c)
+
+	store := &prunedStore{Store: memstore.New(), below: 2}
+	for h := uint64(1); h <= c.Height(); h++ {
+		b, err := c.GetBlock(ctx, h)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		store.Store.(*memstore.MemStore).Blocks[h] = b
+	}
+	err := c.SwapStore(ctx, store)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	_, err = c.OutputDiff(ctx, 1)
+	if errors.Root(err) != ErrPruned {
+		t.Errorf("got error %v, want %v", err, ErrPruned)
+	}
+
+	// Only the block itself is needed, not the blocks before it.
+	_, err = c.OutputDiff(ctx, 3)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+}
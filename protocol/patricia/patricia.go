@@ -17,11 +17,17 @@
 // which contains the root of the tree, to obtain a new tree
 // with the same contents. The time to make such a copy is
 // independent of the size of the tree.
+//
+// Node hashes are computed by a Hasher. The zero Tree uses
+// DefaultHasher, which implements the hash in the spec;
+// NewTree makes a tree with some other Hasher.
 package patricia
 
 import (
 	"bytes"
 	"io"
+	"sync"
+	"unsafe"
 
 	"github.com/chain/txvm/crypto/sha3pool"
 	"github.com/chain/txvm/errors"
@@ -32,9 +38,88 @@ var (
 	interiorPrefix = []byte{0x01}
 )
 
+// Hasher computes the hashes of the nodes of a tree.
+type Hasher interface {
+	// LeafHash returns the hash of a leaf holding item.
+	LeafHash(item []byte) [32]byte
+
+	// InteriorHash returns the hash of an interior node
+	// with the given child hashes.
+	InteriorHash(left, right *[32]byte) [32]byte
+}
+
+// DefaultHasher is the Hasher specified by the Chain Protocol:
+// SHA3-256 over a one-byte node-type prefix and the node contents.
+var DefaultHasher Hasher = sha3Hasher{}
+
+type sha3Hasher struct{}
+
+func (sha3Hasher) LeafHash(item []byte) (hash [32]byte) {
+	h := sha3pool.Get256()
+	h.Write(leafPrefix)
+	h.Write(item)
+	io.ReadFull(h, hash[:])
+	sha3pool.Put256(h)
+	return hash
+}
+
+func (sha3Hasher) InteriorHash(left, right *[32]byte) (hash [32]byte) {
+	h := sha3pool.Get256()
+	h.Write(interiorPrefix)
+	h.Write(left[:])
+	h.Write(right[:])
+	io.ReadFull(h, hash[:])
+	sha3pool.Put256(h)
+	return hash
+}
+
+var (
+	hashersMu sync.RWMutex
+	hashers   = map[string]Hasher{"sha3": DefaultHasher}
+)
+
+// RegisterHasher makes h available by name to HasherByName.
+// It replaces any Hasher previously registered under that name.
+// The name "sha3" refers to DefaultHasher.
+func RegisterHasher(name string, h Hasher) {
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+	hashers[name] = h
+}
+
+// HasherByName returns the Hasher registered under name,
+// or false if there is none.
+func HasherByName(name string) (Hasher, bool) {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+	h, ok := hashers[name]
+	return h, ok
+}
+
 // Tree implements a patricia tree.
 type Tree struct {
-	root *node
+	root   *node
+	hasher Hasher // nil means DefaultHasher
+
+	// size and keyBytes are the number of items in the tree
+	// and their total length, maintained by Insert and Delete.
+	size     int
+	keyBytes int
+}
+
+// NewTree returns an empty tree that hashes its nodes with h.
+// A nil h means DefaultHasher.
+// The new tree, and copies of it, must not be combined with trees
+// using a different Hasher.
+func NewTree(h Hasher) *Tree {
+	return &Tree{hasher: h}
+}
+
+func (t *Tree) getHasher() Hasher {
+	if t.hasher == nil {
+		return DefaultHasher
+	}
+	return t.hasher
 }
 
 // WalkFunc is the type of the function called for each item
@@ -98,20 +183,22 @@ func lookup(n *node, key []byte) *node {
 // If item itself is already in t, Insert does nothing
 // (and this is not an error).
 func (t *Tree) Insert(item []byte) error {
-	var hash [32]byte
-	h := sha3pool.Get256()
-	h.Write(leafPrefix)
-	h.Write(item)
-	io.ReadFull(h, hash[:])
-	sha3pool.Put256(h)
+	hash := t.getHasher().LeafHash(item)
 
 	if t.root == nil {
 		t.root = &node{key: item, keybit: 7, hash: &hash, isLeaf: true}
+		t.size, t.keyBytes = 1, len(item)
 		return nil
 	}
 
-	var err error
-	t.root, err = insert(t.root, item, &hash)
+	// Insert returns its argument unchanged if item is present
+	// or on error, and a new node otherwise.
+	root, err := insert(t.root, item, &hash)
+	if root != t.root {
+		t.size++
+		t.keyBytes += len(item)
+	}
+	t.root = root
 	return err
 }
 
@@ -132,13 +219,16 @@ func insert(n *node, key []byte, hash *[32]byte) (*node, error) {
 		bit := childIdx(key, len(n.key), n.keybit)
 
 		child := n.children[bit]
-		child, err := insert(child, key, hash)
+		newChild, err := insert(child, key, hash)
 		if err != nil {
 			return n, err
 		}
+		if newChild == child {
+			return n, nil // key already present
+		}
 		newNode := new(node)
 		*newNode = *n
-		newNode.children[bit] = child // mutation is ok because newNode hasn't escaped yet
+		newNode.children[bit] = newChild // mutation is ok because newNode hasn't escaped yet
 		newNode.hash = nil
 		return newNode, nil
 	}
@@ -165,9 +255,34 @@ func insert(n *node, key []byte, hash *[32]byte) (*node, error) {
 
 // Delete removes item from t, if present.
 func (t *Tree) Delete(item []byte) {
-	if t.root != nil {
-		t.root = delete(t.root, item)
+	if t.root == nil {
+		return
+	}
+	root := delete(t.root, item)
+	if root != t.root {
+		t.size--
+		t.keyBytes -= len(item)
+	}
+	t.root = root
+}
+
+// Len returns the number of items in t.
+func (t *Tree) Len() int {
+	return t.size
+}
+
+// EstimateMemory returns the approximate number of bytes used by
+// the nodes of t. It does not walk the tree, and it counts nodes
+// shared with other trees (copies of t, for instance) in full.
+func (t *Tree) EstimateMemory() int64 {
+	if t.size == 0 {
+		return 0
 	}
+	// A tree with n leaves has n-1 interior nodes. Every leaf
+	// holds its item (interior nodes use slices of leaf keys)
+	// and, once computed, a hash.
+	nodes := int64(2*t.size - 1)
+	return nodes*int64(unsafe.Sizeof(node{})+32) + int64(t.keyBytes)
 }
 
 func delete(n *node, key []byte) *node {
@@ -208,7 +323,22 @@ func (t *Tree) RootHash() [32]byte {
 	if root == nil {
 		return [32]byte{}
 	}
-	return root.Hash()
+	return root.Hash(t.getHasher())
+}
+
+// RootHashParallel returns the Merkle root of the tree, like
+// RootHash, but computes the hashes of up to n disjoint subtrees
+// concurrently. It pays off after a large batch of inserts and
+// deletes, which leaves many node hashes to recompute; n is
+// typically runtime.GOMAXPROCS(0). The tree's Hasher must be safe
+// for concurrent use, as DefaultHasher is.
+func (t *Tree) RootHashParallel(n int) [32]byte {
+	root := t.root
+	if root == nil {
+		return [32]byte{}
+	}
+	root.calcHashParallel(t.getHasher(), n)
+	return *root.hash
 }
 
 func commonPrefix(a, b []byte) (int, byte) {
@@ -279,26 +409,41 @@ type node struct {
 	children [2]*node
 }
 
-// Hash will return the hash for this node.
-func (n *node) Hash() [32]byte {
-	n.calcHash()
+// Hash will return the hash for this node, computed with h.
+func (n *node) Hash(h Hasher) [32]byte {
+	n.calcHash(h)
 	return *n.hash
 }
 
-func (n *node) calcHash() {
+func (n *node) calcHash(h Hasher) {
 	if n.hash != nil {
 		return
 	}
 
-	h := sha3pool.Get256()
-	h.Write(interiorPrefix)
 	for _, c := range n.children {
-		c.calcHash()
-		h.Write(c.hash[:])
+		c.calcHash(h)
 	}
+	hash := h.InteriorHash(n.children[0].hash, n.children[1].hash)
+	n.hash = &hash
+}
 
-	var hash [32]byte
-	io.ReadFull(h, hash[:])
+// calcHashParallel is like calcHash, but divides the work among up to
+// workers goroutines, one per subtree.
+func (n *node) calcHashParallel(h Hasher, workers int) {
+	if workers <= 1 || n.hash != nil {
+		n.calcHash(h)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		n.children[0].calcHashParallel(h, workers/2)
+	}()
+	n.children[1].calcHashParallel(h, workers-workers/2)
+	wg.Wait()
+
+	hash := h.InteriorHash(n.children[0].hash, n.children[1].hash)
 	n.hash = &hash
-	sha3pool.Put256(h)
 }
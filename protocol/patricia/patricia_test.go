@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"runtime"
 	"strconv"
 	"strings"
 	"testing"
@@ -59,6 +60,23 @@ func BenchmarkInsertsRootHash(b *testing.B) {
 	}
 }
 
+func BenchmarkInsertsRootHashParallel(b *testing.B) {
+	const nodes = 10000
+	for i := 0; i < b.N; i++ {
+		tr := new(Tree)
+		for j := uint64(0); j < nodes; j++ {
+			var h [32]byte
+			binary.LittleEndian.PutUint64(h[:], j)
+
+			err := tr.Insert(h[:])
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		tr.RootHashParallel(runtime.GOMAXPROCS(0))
+	}
+}
+
 func TestRootHashBug(t *testing.T) {
 	tr := new(Tree)
 
@@ -137,6 +155,49 @@ func TestRootHashInsertQuickCheck(t *testing.T) {
 	}
 }
 
+func TestRootHashParallel(t *testing.T) {
+	items := make([][]byte, 1000)
+	for i := range items {
+		h := sha3.Sum256([]byte(strconv.Itoa(i)))
+		items[i] = h[:]
+	}
+
+	// build returns a tree that has had items inserted, and every
+	// third one deleted, with its root hash computed by rootHash
+	// halfway through.
+	build := func(rootHash func(*Tree) [32]byte) *Tree {
+		tr := new(Tree)
+		for i, item := range items {
+			tr.Insert(item)
+			if i == len(items)/2 {
+				rootHash(tr)
+			}
+		}
+		for i := 0; i < len(items); i += 3 {
+			tr.Delete(items[i])
+		}
+		return tr
+	}
+
+	want := build((*Tree).RootHash).RootHash()
+	for _, n := range []int{-1, 0, 1, 2, 3, 8, 64} {
+		par := func(tr *Tree) [32]byte { return tr.RootHashParallel(n) }
+		got := build(par).RootHashParallel(n)
+		if got != want {
+			t.Errorf("RootHashParallel(%d) = %x, want %x", n, got, want)
+		}
+	}
+
+	if got := new(Tree).RootHashParallel(4); got != [32]byte{} {
+		t.Errorf("RootHashParallel of empty tree = %x, want zero", got)
+	}
+	tr := new(Tree)
+	tr.Insert(items[0])
+	if got, want := tr.RootHashParallel(4), hashForLeaf(items[0]); got != want {
+		t.Errorf("RootHashParallel of one-item tree = %x, want %x", got, want)
+	}
+}
+
 func TestLookup(t *testing.T) {
 	tr := &Tree{
 		root: &node{key: bits("11111111"), hash: hashPtr(hashForLeaf(bits("11111111"))), isLeaf: true, keybit: 7},
@@ -544,13 +605,13 @@ func TestDeletePrefix(t *testing.T) {
 	}
 
 	got := delete(root, []byte{1})
-	got.calcHash()
+	got.calcHash(DefaultHasher)
 	if !testutil.DeepEqual(got, root) {
 		t.Fatalf("got:\n%swant:\n%s", prettyNode(got, 0), prettyNode(root, 0))
 	}
 
 	got = delete(root, []byte{1, 1})
-	got.calcHash()
+	got.calcHash(DefaultHasher)
 	if !testutil.DeepEqual(got, root) {
 		t.Fatalf("got:\n%swant:\n%s", prettyNode(got, 0), prettyNode(root, 0))
 	}
@@ -593,6 +654,53 @@ func TestWalk(t *testing.T) {
 	}
 }
 
+func TestLen(t *testing.T) {
+	tr := new(Tree)
+	if tr.Len() != 0 || tr.EstimateMemory() != 0 {
+		t.Fatalf("empty tree: Len = %d, EstimateMemory = %d", tr.Len(), tr.EstimateMemory())
+	}
+
+	var prev int64
+	for i := 0; i < 10; i++ {
+		tr.Insert([]byte{byte(i), 0})
+		if tr.Len() != i+1 {
+			t.Fatalf("after %d inserts Len = %d", i+1, tr.Len())
+		}
+		if m := tr.EstimateMemory(); m <= prev {
+			t.Fatalf("after %d inserts EstimateMemory = %d, want more than %d", i+1, m, prev)
+		} else {
+			prev = m
+		}
+	}
+
+	// Inserting a present item, or one that fails, changes nothing.
+	tr.Insert([]byte{3, 0})
+	if err := tr.Insert([]byte{3, 0, 0}); err == nil {
+		t.Fatal("expected error inserting extension of item")
+	}
+	if tr.Len() != 10 || tr.EstimateMemory() != prev {
+		t.Errorf("after redundant inserts Len = %d, EstimateMemory = %d, want 10, %d", tr.Len(), tr.EstimateMemory(), prev)
+	}
+
+	// A copy keeps its count as the original changes.
+	cp := *tr
+	tr.Delete([]byte{3, 0})
+	tr.Delete([]byte{3, 0})
+	tr.Delete([]byte{42, 0})
+	if tr.Len() != 9 {
+		t.Errorf("after delete Len = %d, want 9", tr.Len())
+	}
+	if cp.Len() != 10 {
+		t.Errorf("copy Len = %d, want 10", cp.Len())
+	}
+
+	var n int
+	Walk(tr, func([]byte) error { n++; return nil })
+	if n != tr.Len() {
+		t.Errorf("Walk found %d items, Len = %d", n, tr.Len())
+	}
+}
+
 func TestHasPrefix(t *testing.T) {
 	cases := []struct {
 		s, pref string
@@ -687,6 +795,89 @@ func bits(lit string) []byte {
 	return append(b[:], byte(n))
 }
 
+func TestDefaultHasherRoots(t *testing.T) {
+	// These roots were computed before Hasher was introduced.
+	cases := []struct {
+		items [][]byte
+		want  string
+	}{{
+		items: [][]byte{[]byte("alpha"), []byte("bravo"), []byte("charl"), []byte("delta"), []byte("echoo")},
+		want:  "6be03e4871a26baa07ecc2add528d1cbe8296b6b6047b95abe0b72dbd16ac50b",
+	}, {
+		items: [][]byte{{0x01, 0x02}},
+		want:  "1186d49a4ad620618f760f29da2c593b2ec2cc2ced69dc16817390d861e62253",
+	}}
+
+	for _, c := range cases {
+		for _, tr := range []*Tree{new(Tree), NewTree(nil), NewTree(DefaultHasher)} {
+			for _, item := range c.items {
+				err := tr.Insert(item)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := tr.RootHash(); got != mustDecodeHash(c.want) {
+				t.Errorf("root of %q = %x, want %s", c.items, got, c.want)
+			}
+		}
+	}
+}
+
+// xorHasher is a cheap, insecure Hasher for testing.
+type xorHasher struct{}
+
+func (xorHasher) LeafHash(item []byte) (h [32]byte) {
+	h[0] = 0xff
+	for i, b := range item {
+		h[i%32] ^= b
+	}
+	return h
+}
+
+func (xorHasher) InteriorHash(left, right *[32]byte) (h [32]byte) {
+	for i := range h {
+		h[i] = left[i] ^ (right[i] << 1) ^ 1
+	}
+	return h
+}
+
+func TestCustomHasher(t *testing.T) {
+	RegisterHasher("xor", xorHasher{})
+	h, ok := HasherByName("xor")
+	if !ok {
+		t.Fatal("xor hasher not registered")
+	}
+	if h, ok := HasherByName("sha3"); !ok || h != DefaultHasher {
+		t.Errorf("HasherByName(sha3) = %v, %v, want DefaultHasher", h, ok)
+	}
+
+	items := [][]byte{{0x01, 0x02}, {0x01, 0x03}, {0x80, 0x00}}
+	def, custom := new(Tree), NewTree(h)
+	for _, item := range items {
+		def.Insert(item)
+		custom.Insert(item)
+	}
+
+	want := xorHasher{}.InteriorHash(
+		hashPtr(xorHasher{}.InteriorHash(hashPtr(xorHasher{}.LeafHash(items[0])), hashPtr(xorHasher{}.LeafHash(items[1])))),
+		hashPtr(xorHasher{}.LeafHash(items[2])),
+	)
+	if got := custom.RootHash(); got != want {
+		t.Errorf("custom root = %x, want %x", got, want)
+	}
+	if custom.RootHash() == def.RootHash() {
+		t.Error("custom and default hashers produce the same root")
+	}
+
+	// Copies keep the hasher.
+	cp := *custom
+	cp.Delete(items[2])
+	want = xorHasher{}.InteriorHash(hashPtr(xorHasher{}.LeafHash(items[0])), hashPtr(xorHasher{}.LeafHash(items[1])))
+	if got := cp.RootHash(); got != want {
+		t.Errorf("copy root = %x, want %x", got, want)
+	}
+}
+
 func hashForLeaf(item []byte) [32]byte {
 	return sha3.Sum256(append([]byte{0x00}, item...))
 }
@@ -20,7 +20,8 @@ parties), and call CommitAppliedBlock.
 Signer
 
 A signer validates blocks generated by the Generator and signs
-at most one block at each height.
+at most one block at each height. Type Signer enforces this,
+persisting its progress through a SignerStore.
 
 Participant
 
@@ -40,8 +41,11 @@ New block sequence
 
 Every new block must be validated against the existing
 blockchain state. New blocks are validated by calling
-ValidateBlock. Blocks produced by GenerateBlock are already
-known to be valid.
+ValidateBlock, which also returns the resulting state
+snapshot. Blocks produced by GenerateBlock are already
+known to be valid. Nodes that follow the blockchain without
+keeping its state can check blocks with ValidateBlockStateless,
+which produces no snapshot.
 
 A new block goes through the sequence:
   - If not generated locally, the block is validated by
@@ -74,6 +78,13 @@ the block must be calculated by taking the Chain's
 current state and applying the new block. To ingest a
 block without a known resulting state snapshot, call
 CommitBlock.
+Alternatively, validate it with ValidateBlock and pass
+the snapshot it returns to CommitAppliedBlock.
+
+To ingest a long run of remotely-generated blocks at once,
+as when syncing, call CommitBlocks. To ingest them as they
+arrive on a stream written with WriteBlock, call
+CommitStream.
 */
 package protocol
 
@@ -92,6 +103,11 @@ var (
 	// ErrTheDistantFuture is returned when waiting for a blockheight
 	// too far in excess of the tip of the blockchain.
 	ErrTheDistantFuture = errors.New("block height too far in future")
+
+	// ErrPruned is returned by a Store's GetBlock, possibly
+	// wrapped, when the block at the requested height has been
+	// discarded.
+	ErrPruned = errors.New("block pruned from store")
 )
 
 // Store provides storage for blockchain data: blocks and state tree
@@ -101,6 +117,9 @@ var (
 // provides access to the state at a given point in time -- outputs
 // and issuance memory. The Chain type uses Store to load state
 // from storage and persist validated data.
+//
+// A Store may discard old blocks. GetBlock then returns an error
+// whose root is ErrPruned for their heights.
 type Store interface {
 	Height(context.Context) (uint64, error)
 	GetBlock(context.Context, uint64) (*bc.Block, error)
@@ -120,28 +139,106 @@ type Chain struct {
 
 	// only used by generators
 	MaxNonceWindow time.Duration
+
+	// MaxBlockWindow, if nonzero, caps the RefsCount of generated
+	// blocks. It also limits how far, in milliseconds, a block's
+	// timestamp may be past its predecessor's for GenerateBlock to
+	// produce it and for ValidateBlock, CommitBlock, and CommitBlocks
+	// to accept it.
 	MaxBlockWindow uint64
 
+	// MaxFutureBlockTime, if nonzero, limits how far ahead of the
+	// local clock a block's timestamp may be for CommitBlock and
+	// CommitBlocks to accept it.
+	MaxFutureBlockTime time.Duration
+
 	state struct {
-		cond     sync.Cond // protects height, block, snapshot
-		height   uint64
-		snapshot *state.Snapshot // current only if leader
+		cond            sync.Cond // protects height, block, snapshot, saved snapshot info, and store
+		height          uint64
+		finalizedHeight uint64
+		snapshot        *state.Snapshot // current only if leader
+
+		savedSnapshotHeight uint64
+		snapshotErr         error
+
+		store    Store  // replaced by SwapStore
+		storeGen uint64 // incremented by SwapStore
 	}
-	store Store
+	commitMu sync.Mutex // held while saving blocks and setting state; see SwapStore
 
 	lastQueuedSnapshotMS uint64
 	pendingSnapshots     chan *state.Snapshot
+	snapshotWorkers      int
+	retryPolicy          RetryPolicy
+	committedTx          func(context.Context, uint64, *bc.Tx)
+	verifyOnStartup      bool
+
+	// validated is the result of the most recent ValidateBlock,
+	// for CommitBlock to reuse.
+	validated struct {
+		mu       sync.Mutex
+		prev     *state.Snapshot // the state the block was applied to
+		blockID  bc.Hash
+		snapshot *state.Snapshot
+	}
+
+	saving struct {
+		mu     sync.Mutex
+		latest *state.Snapshot // newest snapshot saved to the store
+		gen    uint64          // the store's generation (see state.storeGen)
+	}
+}
+
+// ChainOption is a configuration option for NewChain.
+type ChainOption func(*Chain)
+
+// SnapshotWorkers is an option for NewChain that sets the number of
+// goroutines saving state snapshots to the Store. The default is 1.
+// More workers may help with stores that can write several snapshots
+// in parallel. Saves may then complete out of order, but the most
+// recent snapshot queued is always the last one saved: if an older
+// save completes after a newer one, the newer one is saved again.
+func SnapshotWorkers(n int) ChainOption {
+	return func(c *Chain) {
+		if n > 0 {
+			c.snapshotWorkers = n
+		}
+	}
+}
+
+// OnCommittedTx is an option for NewChain that sets a callback to
+// be invoked for each transaction in each block the Chain commits,
+// in block and transaction order, with the height of the block.
+// It is called after the block is saved to the Store and c's state
+// updated, without holding any of c's locks, so it may call c's
+// methods.
+//
+// Each block is reported once, by the commit that advances c's
+// in-memory state past it, whichever commit method is used and
+// whether or not c's height already covered the block through the
+// heights channel passed to NewChain. Recommitting a block does not
+// report it again. Recover reports the transactions of the most
+// recent block again, since they may not have been reported before
+// a crash.
+func OnCommittedTx(fn func(ctx context.Context, height uint64, tx *bc.Tx)) ChainOption {
+	return func(c *Chain) {
+		c.committedTx = fn
+	}
 }
 
 // NewChain returns a new Chain using store as the underlying storage.
-func NewChain(ctx context.Context, initialBlock *bc.Block, store Store, heights <-chan uint64) (*Chain, error) {
+func NewChain(ctx context.Context, initialBlock *bc.Block, store Store, heights <-chan uint64, opts ...ChainOption) (*Chain, error) {
 	c := &Chain{
 		InitialBlockHash: initialBlock.Hash(),
-		store:            store,
 		pendingSnapshots: make(chan *state.Snapshot, 1),
+		snapshotWorkers:  1,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
 	c.state.cond.L = new(sync.Mutex)
 	c.state.snapshot = state.Empty()
+	c.state.store = store
 
 	var err error
 	c.state.height, err = store.Height(ctx)
@@ -149,6 +246,13 @@ func NewChain(ctx context.Context, initialBlock *bc.Block, store Store, heights
 		return nil, errors.Wrap(err, "looking up blockchain height")
 	}
 
+	if c.verifyOnStartup {
+		err = verifyLatestSnapshot(ctx, store)
+		if err != nil {
+			return nil, errors.Wrap(err, "verifying latest snapshot")
+		}
+	}
+
 	// Note that c.state.height may still be zero here.
 	if heights != nil {
 		go func() {
@@ -163,21 +267,93 @@ func NewChain(ctx context.Context, initialBlock *bc.Block, store Store, heights
 		}()
 	}
 
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
+	for i := 0; i < c.snapshotWorkers; i++ {
+		go c.saveSnapshots(ctx)
+	}
+
+	return c, nil
+}
+
+// saveSnapshots saves snapshots from c.pendingSnapshots to the Store
+// until ctx is canceled. Several may run at once.
+func (c *Chain) saveSnapshots(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-c.pendingSnapshots:
+			c.saveSnapshot(ctx, s)
+		}
+	}
+}
+
+// saveSnapshot saves s to the Store, unless a newer snapshot has
+// already been saved. If a newer snapshot is saved while s is being
+// saved, s may have overwritten it, so the newest is saved again,
+// until the last snapshot this call saves is the newest. If SwapStore
+// replaces the Store during a save, s is saved again to the new one.
+func (c *Chain) saveSnapshot(ctx context.Context, s *state.Snapshot) {
+	store, gen := c.getStoreGen()
+	if c.savedAsRecent(gen, s) {
+		return
+	}
+
+	for {
+		err := c.retry(ctx, store, func() error {
+			return store.SaveSnapshot(ctx, s)
+		})
+		if err != nil {
+			log.Error(ctx, err, "at", "saving snapshot")
+			c.setSavedSnapshot(gen, s.Height(), err)
+			return
+		}
+
+		c.saving.mu.Lock()
+		if c.saving.gen != gen {
+			// SwapStore replaced the store during the save. Save s
+			// to the new one.
+			c.saving.mu.Unlock()
+			store, gen = c.getStoreGen()
+			if c.savedAsRecent(gen, s) {
 				return
-			case s := <-c.pendingSnapshots:
-				err = store.SaveSnapshot(ctx, s)
-				if err != nil {
-					log.Error(ctx, err, "at", "saving snapshot")
-				}
 			}
+			continue
 		}
-	}()
+		latest := c.saving.latest
+		if latest == nil || s.Height() > latest.Height() {
+			c.saving.latest = s
+			c.saving.mu.Unlock()
+			c.setSavedSnapshot(gen, s.Height(), nil)
+			return
+		}
+		c.saving.mu.Unlock()
+		if latest == s {
+			return
+		}
+		s = latest
+	}
+}
 
-	return c, nil
+// savedAsRecent reports whether a snapshot at least as recent as s
+// has been saved to the store of generation gen.
+func (c *Chain) savedAsRecent(gen uint64, s *state.Snapshot) bool {
+	c.saving.mu.Lock()
+	defer c.saving.mu.Unlock()
+	return c.saving.gen == gen && c.saving.latest != nil && s.Height() <= c.saving.latest.Height()
+}
+
+// getStore returns the Store c currently uses.
+func (c *Chain) getStore() Store {
+	store, _ := c.getStoreGen()
+	return store
+}
+
+// getStoreGen returns the Store c currently uses and its generation,
+// which SwapStore increments.
+func (c *Chain) getStoreGen() (Store, uint64) {
+	c.state.cond.L.Lock()
+	defer c.state.cond.L.Unlock()
+	return c.state.store, c.state.storeGen
 }
 
 // Height returns the current height of the blockchain.
@@ -187,6 +363,19 @@ func (c *Chain) Height() uint64 {
 	return c.state.height
 }
 
+// FinalizedHeight returns the height of the most recent block c
+// knows to be finalized: one for which c called the Store's
+// FinalizeHeight successfully, or whose height arrived on the
+// heights channel passed to NewChain. Blocks above it may have been
+// saved, and may be in c's state, without yet being finalized. It
+// never exceeds Height, and is zero until c commits or is notified
+// of a block.
+func (c *Chain) FinalizedHeight() uint64 {
+	c.state.cond.L.Lock()
+	defer c.state.cond.L.Unlock()
+	return c.state.finalizedHeight
+}
+
 // State returns the most recent state available. It will not be current
 // unless the current process is the leader. Callers should examine the
 // returned state header's height if they need to verify the current state.
@@ -196,14 +385,75 @@ func (c *Chain) State() *state.Snapshot {
 	return c.state.snapshot
 }
 
-func (c *Chain) setState(s *state.Snapshot) {
+// Stats summarizes the progress of a Chain, for monitoring.
+type Stats struct {
+	// Height is the height of the blockchain, as known to the Chain.
+	Height uint64
+
+	// FinalizedHeight is the height of the most recent block known
+	// to be finalized. See Chain.FinalizedHeight.
+	FinalizedHeight uint64
+
+	// SnapshotHeight is the height of the Chain's in-memory state.
+	// It lags Height unless the current process is the leader.
+	SnapshotHeight uint64
+
+	// SavedSnapshotHeight is the height of the most recent state
+	// snapshot the Chain has saved to its Store, or zero if none.
+	SavedSnapshotHeight uint64
+
+	// PendingSnapshots is the number of snapshots waiting to be
+	// saved to the Store.
+	PendingSnapshots int
+
+	// SnapshotErr is the error from the most recent attempt to
+	// save a snapshot, or nil if it succeeded.
+	SnapshotErr error
+}
+
+// Stats returns a consistent summary of c's current progress.
+func (c *Chain) Stats() Stats {
+	c.state.cond.L.Lock()
+	defer c.state.cond.L.Unlock()
+	return Stats{
+		Height:              c.state.height,
+		FinalizedHeight:     c.state.finalizedHeight,
+		SnapshotHeight:      c.state.snapshot.Height(),
+		SavedSnapshotHeight: c.state.savedSnapshotHeight,
+		PendingSnapshots:    len(c.pendingSnapshots),
+		SnapshotErr:         c.state.snapshotErr,
+	}
+}
+
+// setSavedSnapshot records the outcome of saving the snapshot at
+// height to the store of generation gen. It ignores saves to a store
+// that SwapStore has since replaced.
+func (c *Chain) setSavedSnapshot(gen, height uint64, err error) {
+	c.state.cond.L.Lock()
+	defer c.state.cond.L.Unlock()
+
+	if gen != c.state.storeGen {
+		return
+	}
+
+	c.state.snapshotErr = err
+	if err == nil && height > c.state.savedSnapshotHeight {
+		c.state.savedSnapshotHeight = height
+	}
+}
+
+// setState sets c's state to s and returns the height of the state
+// it replaced. It ignores s if c's state is already as recent, so the
+// returned height is then at least s's.
+func (c *Chain) setState(s *state.Snapshot) uint64 {
 	c.state.cond.L.Lock()
 	defer c.state.cond.L.Unlock()
 
 	// Multiple goroutines may attempt to set the state at the
 	// same time. If b is an older block than c.state, ignore it.
-	if s.Height() <= c.state.snapshot.Height() {
-		return
+	prev := c.state.snapshot.Height()
+	if s.Height() <= prev {
+		return prev
 	}
 
 	c.state.snapshot = s
@@ -211,6 +461,7 @@ func (c *Chain) setState(s *state.Snapshot) {
 		c.state.height = s.Height()
 		c.state.cond.Broadcast()
 	}
+	return prev
 }
 
 func (c *Chain) setHeight(h uint64) {
@@ -222,6 +473,10 @@ func (c *Chain) setHeight(h uint64) {
 	c.state.cond.L.Lock()
 	defer c.state.cond.L.Unlock()
 
+	// Heights arrive here once finalized by another process.
+	if h > c.state.finalizedHeight {
+		c.state.finalizedHeight = h
+	}
 	if h <= c.state.height {
 		return
 	}
@@ -229,6 +484,17 @@ func (c *Chain) setHeight(h uint64) {
 	c.state.cond.Broadcast()
 }
 
+// setFinalizedHeight records that the block at height h, which must
+// not be above c's height, has been finalized.
+func (c *Chain) setFinalizedHeight(h uint64) {
+	c.state.cond.L.Lock()
+	defer c.state.cond.L.Unlock()
+
+	if h > c.state.finalizedHeight && h <= c.state.height {
+		c.state.finalizedHeight = h
+	}
+}
+
 // BlockSoonWaiter returns a channel that
 // waits for the block at the given height,
 // but it is an error to wait for a block far in the future.
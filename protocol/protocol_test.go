@@ -2,10 +2,16 @@ package protocol
 
 import (
 	"context"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/bc"
 	"github.com/chain/txvm/protocol/prottest/memstore"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/testutil"
 )
 
 func TestNewChainHeight(t *testing.T) {
@@ -30,3 +36,222 @@ func TestNewChainHeight(t *testing.T) {
 
 	cancel()
 }
+
+type failingSnapshotStore struct {
+	*memstore.MemStore
+}
+
+func (failingSnapshotStore) SaveSnapshot(context.Context, *state.Snapshot) error {
+	return errSaveSnapshot
+}
+
+var errSaveSnapshot = errors.New("save snapshot failed")
+
+func TestStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b1, err := NewInitialBlock(nil, 0, time.Now())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	c, err := NewChain(ctx, b1, failingSnapshotStore{memstore.New()}, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if got := c.Stats(); got != (Stats{}) {
+		t.Errorf("initial stats = %+v, want zero", got)
+	}
+
+	st := state.Empty()
+	err = st.ApplyBlock(b1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, b1, st)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Committing b1 queues a snapshot, which fails to save.
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Stats().SnapshotErr == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for snapshot error")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	want := Stats{
+		Height:          1,
+		FinalizedHeight: 1,
+		SnapshotHeight:  1,
+		SnapshotErr:     errSaveSnapshot,
+	}
+	if got := c.Stats(); got != want {
+		t.Errorf("stats after failed save = %+v, want %+v", got, want)
+	}
+
+	// A successful save clears the error; a height learned from
+	// elsewhere advances Height but not SnapshotHeight.
+	c.setSavedSnapshot(0, 1, nil)
+	c.setHeight(4)
+	want = Stats{
+		Height:              4,
+		FinalizedHeight:     4,
+		SnapshotHeight:      1,
+		SavedSnapshotHeight: 1,
+	}
+	if got := c.Stats(); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+// failingFinalizeStore fails to finalize heights in fail.
+type failingFinalizeStore struct {
+	*memstore.MemStore
+	fail map[uint64]bool
+}
+
+func (s failingFinalizeStore) FinalizeHeight(ctx context.Context, height uint64) error {
+	if s.fail[height] {
+		return errFinalize
+	}
+	return s.MemStore.FinalizeHeight(ctx, height)
+}
+
+var errFinalize = errors.New("finalize failed")
+
+func TestFinalizedHeight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	src, b1 := newTestChain(t, now)
+	for i := 0; i < 4; i++ {
+		makeEmptyBlock(t, src)
+	}
+
+	store := failingFinalizeStore{memstore.New(), map[uint64]bool{3: true, 4: true}}
+	c, err := NewChain(ctx, b1, store, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if h := c.FinalizedHeight(); h != 0 {
+		t.Errorf("initial finalized height = %d, want 0", h)
+	}
+
+	wantFinalized := []uint64{1, 2, 2, 2, 5}
+	for i, want := range wantFinalized {
+		height := uint64(i + 1)
+		b, err := src.GetBlock(ctx, height)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = c.CommitBlock(ctx, b)
+		if store.fail[height] {
+			if errors.Root(err) != errFinalize {
+				t.Errorf("CommitBlock(%d) error = %v, want %v", height, err, errFinalize)
+			}
+		} else if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if h := c.Height(); h != height {
+			t.Errorf("after block %d, height = %d, want %d", height, h, height)
+		}
+		if h := c.FinalizedHeight(); h != want {
+			t.Errorf("after block %d, finalized height = %d, want %d", height, h, want)
+		}
+		if c.FinalizedHeight() > c.Height() {
+			t.Errorf("after block %d, finalized height %d exceeds height %d", height, c.FinalizedHeight(), c.Height())
+		}
+	}
+
+	// A height finalized elsewhere advances both.
+	c.setHeight(7)
+	if h := c.FinalizedHeight(); h != 7 {
+		t.Errorf("finalized height after notification = %d, want 7", h)
+	}
+	if h := c.Height(); h != 7 {
+		t.Errorf("height after notification = %d, want 7", h)
+	}
+}
+
+// slowSnapshotStore blocks saving the snapshot at height 1 until
+// release is closed, and records the height of each completed save.
+type slowSnapshotStore struct {
+	*memstore.MemStore
+	started chan uint64
+	release chan struct{}
+
+	mu    sync.Mutex
+	saved []uint64
+}
+
+func (s *slowSnapshotStore) SaveSnapshot(ctx context.Context, snapshot *state.Snapshot) error {
+	s.started <- snapshot.Height()
+	if snapshot.Height() == 1 {
+		<-s.release
+	}
+	err := s.MemStore.SaveSnapshot(ctx, snapshot)
+	s.mu.Lock()
+	s.saved = append(s.saved, snapshot.Height())
+	s.mu.Unlock()
+	return err
+}
+
+func (s *slowSnapshotStore) savedHeights() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint64(nil), s.saved...)
+}
+
+func TestSnapshotWorkersOrdering(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src, b1 := newTestChain(t, time.Now())
+	s1 := src.State()
+	_, s2, err := src.GenerateBlock(ctx, s1, s1.TimestampMS()+1, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	store := &slowSnapshotStore{
+		MemStore: memstore.New(),
+		started:  make(chan uint64, 10),
+		release:  make(chan struct{}),
+	}
+	c, err := NewChain(ctx, b1, store, nil, SnapshotWorkers(2))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// The save of s1 starts first but completes after s2's.
+	c.queueSnapshot(ctx, s1)
+	if h := <-store.started; h != 1 {
+		t.Fatalf("first save started at height %d, want 1", h)
+	}
+	c.queueSnapshot(ctx, s2)
+	if h := <-store.started; h != 2 {
+		t.Fatalf("second save started at height %d, want 2", h)
+	}
+	close(store.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(store.savedHeights()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for saves; completed %v", store.savedHeights())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	want := []uint64{2, 1, 2}
+	if got := store.savedHeights(); !reflect.DeepEqual(got, want) {
+		t.Errorf("saves completed at heights %v, want %v", got, want)
+	}
+	if got, _ := store.LatestSnapshot(ctx); got.Height() != 2 {
+		t.Errorf("durable snapshot height = %d, want 2", got.Height())
+	}
+	if got := c.Stats().SavedSnapshotHeight; got != 2 {
+		t.Errorf("SavedSnapshotHeight = %d, want 2", got)
+	}
+}
@@ -18,6 +18,9 @@ type MemStore struct {
 	mu     sync.Mutex
 	Blocks map[uint64]*bc.Block
 	State  *state.Snapshot
+
+	SignedHeight uint64
+	SignedID     bc.Hash
 }
 
 // New returns a new MemStore.
@@ -79,3 +82,18 @@ func (m *MemStore) LatestSnapshot(context.Context) (*state.Snapshot, error) {
 
 // FinalizeHeight satisfies the protocol.Store interface.
 func (m *MemStore) FinalizeHeight(context.Context, uint64) error { return nil }
+
+// LatestSigned satisfies the protocol.SignerStore interface.
+func (m *MemStore) LatestSigned(context.Context) (uint64, bc.Hash, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.SignedHeight, m.SignedID, nil
+}
+
+// SaveSigned satisfies the protocol.SignerStore interface.
+func (m *MemStore) SaveSigned(ctx context.Context, height uint64, id bc.Hash) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.SignedHeight, m.SignedID = height, id
+	return nil
+}
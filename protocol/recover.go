@@ -9,6 +9,58 @@ import (
 	"github.com/chain/txvm/protocol/state"
 )
 
+// EnableStartupVerification is an option for NewChain that makes it
+// check, before returning, that the Store's latest snapshot is
+// consistent with the stored blocks: that its header is that of the
+// stored block at its height, and that its contracts and nonces roots
+// are the ones that block commits to. If not, NewChain fails with
+// ErrSnapshotMismatch, ErrBadContractsRoot, or ErrBadNoncesRoot.
+//
+// Comparing roots stands in for re-applying the block to the state
+// before it: the Store keeps only the latest snapshot, so that state
+// could be rebuilt only by replaying every block from the initial
+// one, which a pruned Store no longer has. The roots were checked
+// against the result of applying the block when it was committed, so
+// a snapshot matching them is that result. If the block has been
+// pruned, NewChain fails with ErrPruned.
+//
+// The check is off by default, since it reads a snapshot and a block
+// from the Store, and computes the snapshot's roots.
+func EnableStartupVerification() ChainOption {
+	return func(c *Chain) {
+		c.verifyOnStartup = true
+	}
+}
+
+// verifyLatestSnapshot performs the check described in
+// EnableStartupVerification on store.
+func verifyLatestSnapshot(ctx context.Context, store Store) error {
+	snapshot, err := store.LatestSnapshot(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting latest snapshot")
+	}
+	if snapshot == nil || snapshot.Height() == 0 {
+		return nil
+	}
+	b, err := store.GetBlock(ctx, snapshot.Height())
+	if err != nil {
+		return errors.Wrap(err, "getting snapshot block")
+	}
+	if b == nil {
+		return errors.WithDetailf(ErrPruned, "no block %d for snapshot", snapshot.Height())
+	}
+	if snapshot.Header.Hash() != b.Hash() {
+		return errors.WithDetailf(ErrSnapshotMismatch, "snapshot header %x, stored block %d is %x", snapshot.Header.Hash().Bytes(), b.Height, b.Hash().Bytes())
+	}
+	if b.ContractsRoot.Byte32() != snapshot.ContractsTree.RootHash() {
+		return errors.WithDetailf(ErrBadContractsRoot, "block %d", b.Height)
+	}
+	if b.NoncesRoot.Byte32() != snapshot.NonceTree.RootHash() {
+		return errors.WithDetailf(ErrBadNoncesRoot, "block %d", b.Height)
+	}
+	return nil
+}
+
 // Recover performs crash recovery, restoring the blockchain
 // to a complete state. It returns the latest confirmed block
 // and the corresponding state snapshot.
@@ -16,13 +68,14 @@ import (
 // If the blockchain is empty (missing initial block), this function
 // returns a nil block and an empty snapshot.
 func (c *Chain) Recover(ctx context.Context) (*state.Snapshot, error) {
-	snapshot, err := c.store.LatestSnapshot(ctx)
+	store := c.getStore()
+	snapshot, err := store.LatestSnapshot(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting latest snapshot")
 	}
 	var b *bc.Block
 	if snapshot.Height() > 0 {
-		b, err = c.store.GetBlock(ctx, snapshot.Height())
+		b, err = store.GetBlock(ctx, snapshot.Height())
 		if err != nil {
 			return nil, errors.Wrap(err, "getting snapshot block")
 		}
@@ -35,14 +88,14 @@ func (c *Chain) Recover(ctx context.Context) (*state.Snapshot, error) {
 	// The true height of the blockchain might be higher than the
 	// height at which the state snapshot was taken. Replay all
 	// existing blocks higher than the snapshot height.
-	height, err := c.store.Height(ctx)
+	height, err := store.Height(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting blockchain height")
 	}
 
 	// Bring the snapshot up to date with the latest block
 	for h := snapshot.Height() + 1; h <= height; h++ {
-		b, err = c.store.GetBlock(ctx, h)
+		b, err = store.GetBlock(ctx, h)
 		if err != nil {
 			return nil, errors.Wrap(err, "getting block")
 		}
@@ -61,7 +114,7 @@ func (c *Chain) Recover(ctx context.Context) (*state.Snapshot, error) {
 		// been too, but make sure just in case. Also "finalize" the last
 		// block (notifying other processes of the latest block height)
 		// and maybe persist the snapshot.
-		err = c.CommitAppliedBlock(ctx, b, snapshot)
+		err = c.commitAppliedBlock(ctx, b, snapshot)
 		if err != nil {
 			return nil, errors.Wrap(err, "committing block")
 		}
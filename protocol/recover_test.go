@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/bc"
 	"github.com/chain/txvm/protocol/prottest/memstore"
 	"github.com/chain/txvm/protocol/state"
@@ -113,3 +114,65 @@ func TestRecoverSnapshotAdditionalBlocks(t *testing.T) {
 		t.Fatal("chain.state.Header is nil")
 	}
 }
+
+func TestStartupVerification(t *testing.T) {
+	ctx := context.Background()
+	c, b1 := newTestChain(t, time.Now())
+	makeEmptyBlock(t, c)
+	good := c.State()
+
+	other, _ := newTestChain(t, time.Now().Add(time.Second))
+	makeEmptyBlock(t, other)
+
+	tampered := state.Copy(good)
+	err := tampered.ContractsTree.Insert(bc.NewHash([32]byte{1}).Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperedNonces := state.Copy(good)
+	err = tamperedNonces.NonceTree.Insert(state.NonceCommitment(bc.NewHash([32]byte{1}), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		snapshot *state.Snapshot
+		wantErr  error
+	}{
+		{"consistent", good, nil},
+		{"empty", state.Empty(), nil},
+		{"other chain", other.State(), ErrSnapshotMismatch},
+		{"tampered contracts", tampered, ErrBadContractsRoot},
+		{"tampered nonces", tamperedNonces, ErrBadNoncesRoot},
+	}
+	for _, c1 := range cases {
+		store := memstore.New()
+		for h := uint64(1); h <= c.Height(); h++ {
+			b, err := c.GetBlock(ctx, h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			store.Blocks[h] = b
+		}
+		store.State = c1.snapshot
+
+		_, err := NewChain(ctx, b1, store, nil, EnableStartupVerification())
+		if errors.Root(err) != c1.wantErr {
+			t.Errorf("%s: got error %v, want %v", c1.name, err, c1.wantErr)
+		}
+
+		// Without the option, the snapshot is not checked.
+		_, err = NewChain(ctx, b1, store, nil)
+		if err != nil {
+			t.Errorf("%s: without verification, got error %v", c1.name, err)
+		}
+	}
+	// A snapshot whose block has been pruned cannot be verified.
+	store := nilBlockStore{memstore.New()}
+	store.State = good
+	_, err = NewChain(ctx, b1, store, nil, EnableStartupVerification())
+	if errors.Root(err) != ErrPruned {
+		t.Errorf("pruned: got error %v, want %v", err, ErrPruned)
+	}
+}
@@ -0,0 +1,100 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/protocol/txvm"
+)
+
+// TxResult is the outcome of running a committed transaction's
+// program again, as reported by ReplayBlock.
+type TxResult struct {
+	// Tx is the transaction as it appears in the block.
+	Tx *bc.Tx
+
+	// Log is the transaction log produced by running the program.
+	Log []txvm.Tuple
+
+	// RunlimitUsed is the part of the transaction's runlimit that
+	// running the program consumed.
+	RunlimitUsed int64
+
+	// Err is non-nil if the program failed, produced a different
+	// transaction ID, or could not be applied to the state before
+	// it. Log and RunlimitUsed describe the run up to the failure.
+	Err error
+}
+
+// ReplayBlock runs again the transactions of the committed block at
+// the given height, against the state just before that block, and
+// returns the result for each, in order. Each transaction that
+// succeeds is applied before running the next, as in the original
+// validation. c's state is unchanged.
+//
+// The state before the block is rebuilt from the latest snapshot in
+// the Store, if it is old enough, or from the initial block, so
+// ReplayBlock may read many blocks, and fails with ErrPruned if any
+// is missing.
+func (c *Chain) ReplayBlock(ctx context.Context, height uint64) ([]*TxResult, error) {
+	if height == 0 || height > c.Height() {
+		return nil, fmt.Errorf("no committed block at height %d", height)
+	}
+	store := c.getStore()
+	snapshot, err := store.LatestSnapshot(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting latest snapshot")
+	}
+	if snapshot.Height() >= height {
+		snapshot = state.Empty()
+	} else {
+		snapshot = state.Copy(snapshot)
+	}
+	for h := snapshot.Height() + 1; h < height; h++ {
+		b, err := store.GetBlock(ctx, h)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting block %d", h)
+		}
+		err = snapshot.ApplyBlock(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "applying block %d", h)
+		}
+	}
+
+	block, err := store.GetBlock(ctx, height)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting block %d", height)
+	}
+	snapshot.PruneNonces(block.TimestampMs)
+	err = snapshot.ApplyBlockHeader(block.BlockHeader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "applying block %d header", height)
+	}
+
+	results := make([]*TxResult, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		res := &TxResult{Tx: tx}
+		results = append(results, res)
+
+		var left int64
+		onLog := txvm.OnLog(func(vm *txvm.VM) { res.Log = vm.Log })
+		vtx, err := bc.NewTx(tx.WitnessProg, tx.Version, tx.Runlimit, onLog, txvm.GetRunlimit(&left))
+		res.RunlimitUsed = tx.Runlimit - left
+		if err != nil {
+			res.Err = errors.Wrap(err, "running transaction program")
+			continue
+		}
+		if vtx.ID != tx.ID {
+			res.Err = errors.WithDetailf(ErrBadTx, "program produces ID %x, want %x", vtx.ID.Bytes(), tx.ID.Bytes())
+			continue
+		}
+		res.Err = snapshot.ApplyTx(vtx)
+	}
+	return results, nil
+}
@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/bc/bctest"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/testutil"
+)
+
+func TestReplayBlock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c, b1 := newTestChain(t, now)
+
+	var committed [][]*bc.Tx
+	for _, n := range []int{2, 1} {
+		var txs []*bc.Tx
+		for i := 0; i < n; i++ {
+			txs = append(txs, bctest.EmptyTx(t, b1.Hash(), now.Add(time.Hour)))
+		}
+		curState := c.State()
+		b, s, err := c.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = c.CommitAppliedBlock(ctx, b, s)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		committed = append(committed, b.Transactions)
+	}
+	live := c.State()
+	liveRoot := live.ContractsTree.RootHash()
+	liveNonces := live.NonceTree.RootHash()
+
+	for i, txs := range committed {
+		height := uint64(i + 2)
+		results, err := c.ReplayBlock(ctx, height)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(results) != len(txs) {
+			t.Fatalf("block %d: got %d results, want %d", height, len(results), len(txs))
+		}
+		for j, res := range results {
+			tx := txs[j]
+			if res.Err != nil {
+				t.Errorf("block %d tx %d: %v", height, j, res.Err)
+			}
+			if res.Tx != tx {
+				t.Errorf("block %d tx %d: result for a different transaction", height, j)
+			}
+			if !reflect.DeepEqual(res.Log, tx.Log) {
+				t.Errorf("block %d tx %d: log %v, want %v", height, j, res.Log, tx.Log)
+			}
+			var left int64
+			_, err := bc.NewTx(tx.WitnessProg, tx.Version, tx.Runlimit, txvm.GetRunlimit(&left))
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+			if want := tx.Runlimit - left; res.RunlimitUsed != want {
+				t.Errorf("block %d tx %d: runlimit used %d, want %d", height, j, res.RunlimitUsed, want)
+			}
+		}
+	}
+
+	if c.State() != live || live.ContractsTree.RootHash() != liveRoot || live.NonceTree.RootHash() != liveNonces {
+		t.Error("ReplayBlock changed the live state")
+	}
+
+	_, err := c.ReplayBlock(ctx, c.Height()+1)
+	if err == nil {
+		t.Error("replaying uncommitted block succeeded")
+	}
+}
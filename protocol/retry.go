@@ -0,0 +1,78 @@
+package protocol
+
+import (
+	"context"
+	"time"
+
+	"github.com/chain/txvm/log"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// RetryPolicy controls how a Chain retries Store writes (SaveBlock
+// and SaveSnapshot) that fail with transient errors. Only Stores
+// implementing TransientErrorStore have their writes retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times to try each write.
+	// Values less than 2 disable retries.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. Each later retry
+	// waits twice as long as the one before it, up to MaxBackoff if
+	// MaxBackoff is nonzero.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// TransientErrorStore is implemented by Stores that can tell
+// transient errors, such as deadlocks and timeouts, from permanent
+// ones.
+type TransientErrorStore interface {
+	// IsTransient reports whether err, returned by one of the
+	// Store's methods, is transient, so that the call may succeed
+	// if repeated.
+	IsTransient(err error) bool
+}
+
+// WithRetryPolicy is an option for NewChain that sets the policy for
+// retrying Store writes that fail with transient errors. By default,
+// writes are not retried.
+func WithRetryPolicy(p RetryPolicy) ChainOption {
+	return func(c *Chain) {
+		c.retryPolicy = p
+	}
+}
+
+func (c *Chain) saveBlock(ctx context.Context, b *bc.Block) error {
+	store := c.getStore()
+	return c.retry(ctx, store, func() error {
+		return store.SaveBlock(ctx, b)
+	})
+}
+
+// retry calls f until it succeeds, fails with an error that store
+// does not consider transient, or has been called as many times as
+// c's RetryPolicy allows. It returns the last error from f. Retries
+// stop early if ctx is canceled.
+func (c *Chain) retry(ctx context.Context, store Store, f func() error) error {
+	ts, ok := store.(TransientErrorStore)
+	backoff := c.retryPolicy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || !ok || attempt >= c.retryPolicy.MaxAttempts || !ts.IsTransient(err) {
+			return err
+		}
+		log.Error(ctx, err, "at", "retrying store write", "attempt", attempt)
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff *= 2
+		if max := c.retryPolicy.MaxBackoff; max > 0 && backoff > max {
+			backoff = max
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package protocol
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/prottest/memstore"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/testutil"
+)
+
+var (
+	errTransient = errors.New("transient store error")
+	errPermanent = errors.New("permanent store error")
+)
+
+// flakyStore is a Store whose SaveBlock fails with err the first
+// failures times it is called.
+type flakyStore struct {
+	*memstore.MemStore
+
+	mu       sync.Mutex
+	err      error
+	failures int
+	calls    int
+}
+
+func (s *flakyStore) SaveBlock(ctx context.Context, b *bc.Block) error {
+	s.mu.Lock()
+	s.calls++
+	fail := s.calls <= s.failures
+	s.mu.Unlock()
+	if fail {
+		return s.err
+	}
+	return s.MemStore.SaveBlock(ctx, b)
+}
+
+func (s *flakyStore) IsTransient(err error) bool {
+	return errors.Root(err) == errTransient
+}
+
+func TestRetryPolicy(t *testing.T) {
+	cases := []struct {
+		err         error
+		maxAttempts int
+		wantErr     error
+		wantCalls   int
+	}{
+		{errTransient, 3, nil, 3},
+		{errTransient, 2, errTransient, 2},
+		{errTransient, 0, errTransient, 1},
+		{errPermanent, 3, errPermanent, 1},
+	}
+	for _, c := range cases {
+		ctx := context.Background()
+		b1, err := NewInitialBlock(nil, 0, time.Now())
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		store := &flakyStore{MemStore: memstore.New(), err: c.err, failures: 2}
+		policy := RetryPolicy{MaxAttempts: c.maxAttempts, Backoff: time.Millisecond}
+		chain, err := NewChain(ctx, b1, store, nil, WithRetryPolicy(policy))
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		st := state.Empty()
+		err = st.ApplyBlock(b1)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+
+		err = chain.CommitAppliedBlock(ctx, b1, st)
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("%v with %d attempts: got error %v, want %v", c.err, c.maxAttempts, err, c.wantErr)
+		}
+		if store.calls != c.wantCalls {
+			t.Errorf("%v with %d attempts: SaveBlock called %d times, want %d", c.err, c.maxAttempts, store.calls, c.wantCalls)
+		}
+		wantHeight := uint64(0)
+		if c.wantErr == nil {
+			wantHeight = 1
+		}
+		if chain.Height() != wantHeight {
+			t.Errorf("%v with %d attempts: height %d, want %d", c.err, c.maxAttempts, chain.Height(), wantHeight)
+		}
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b1, err := NewInitialBlock(nil, 0, time.Now())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	store := &flakyStore{MemStore: memstore.New(), err: errTransient, failures: 2}
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}
+	chain, err := NewChain(context.Background(), b1, store, nil, WithRetryPolicy(policy))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	cancel()
+	err = chain.saveBlock(ctx, b1)
+	if errors.Root(err) != errTransient {
+		t.Errorf("got error %v, want %v", err, errTransient)
+	}
+	if store.calls != 1 {
+		t.Errorf("SaveBlock called %d times, want 1", store.calls)
+	}
+}
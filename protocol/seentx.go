@@ -0,0 +1,118 @@
+package protocol
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// SeenTxs remembers recently received transactions by witness hash,
+// so that a node can cheaply drop repeated relays of a transaction it
+// has already accepted, without validating it again.
+//
+// It holds at most a fixed number of transactions, each for at most a
+// fixed time. When it is full, recording a transaction forgets the
+// one recorded longest ago.
+//
+// SeenTxs is safe for concurrent use.
+type SeenTxs struct {
+	// ByID, if true, makes a transaction a duplicate of any seen
+	// transaction with the same ID, even if its witness differs.
+	// Otherwise a different witness for the same transaction, such
+	// as one with a higher runlimit, is treated as new.
+	ByID bool
+
+	mu        sync.Mutex
+	max       int
+	ttl       time.Duration
+	now       func() time.Time
+	byWitness map[bc.Hash]*list.Element
+	byID      map[bc.Hash]int // tx ID -> number of witnesses
+	order     *list.List      // of *seenTx, oldest first
+}
+
+type seenTx struct {
+	witness, id bc.Hash
+	added       time.Time
+}
+
+// NewSeenTxs returns a SeenTxs remembering at most max transactions,
+// each for at most ttl.
+func NewSeenTxs(max int, ttl time.Duration) *SeenTxs {
+	return &SeenTxs{
+		max:       max,
+		ttl:       ttl,
+		now:       time.Now,
+		byWitness: make(map[bc.Hash]*list.Element),
+		byID:      make(map[bc.Hash]int),
+		order:     list.New(),
+	}
+}
+
+// Seen reports whether tx duplicates a transaction already recorded.
+// If not, it records tx.
+func (s *SeenTxs) Seen(tx *bc.Tx) bool {
+	witness := tx.WitnessHash()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for s.order.Len() > 0 {
+		oldest := s.order.Front().Value.(*seenTx)
+		if now.Sub(oldest.added) < s.ttl {
+			break
+		}
+		s.remove(oldest)
+	}
+
+	if _, ok := s.byWitness[witness]; ok {
+		return true
+	}
+	if s.ByID && s.byID[tx.ID] > 0 {
+		return true
+	}
+	if s.max <= 0 {
+		return false
+	}
+	for s.order.Len() >= s.max {
+		s.remove(s.order.Front().Value.(*seenTx))
+	}
+	s.byWitness[witness] = s.order.PushBack(&seenTx{witness: witness, id: tx.ID, added: now})
+	s.byID[tx.ID]++
+	return false
+}
+
+// Forget removes the record of every witness for the transaction
+// with the given ID, so that it can be received again, as when it is
+// dropped before being committed.
+func (s *SeenTxs) Forget(id bc.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for e := s.order.Front(); e != nil && s.byID[id] > 0; {
+		next := e.Next()
+		if t := e.Value.(*seenTx); t.id == id {
+			s.remove(t)
+		}
+		e = next
+	}
+}
+
+// Len returns the number of transactions recorded.
+func (s *SeenTxs) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+func (s *SeenTxs) remove(t *seenTx) {
+	s.order.Remove(s.byWitness[t.witness])
+	delete(s.byWitness, t.witness)
+	s.byID[t.id]--
+	if s.byID[t.id] == 0 {
+		delete(s.byID, t.id)
+	}
+}
@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/bc/bctest"
+	"github.com/chain/txvm/testutil"
+)
+
+func TestSeenTxs(t *testing.T) {
+	exp := time.Now().Add(time.Hour)
+	tx := bctest.EmptyTx(t, bc.Hash{}, exp)
+
+	// The same transaction with a different witness.
+	rewitnessed, err := bc.NewTx(tx.WitnessProg, tx.Version, tx.Runlimit+1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if rewitnessed.ID != tx.ID || rewitnessed.WitnessHash() == tx.WitnessHash() {
+		t.Fatal("rewitnessed tx should have the same ID and a different witness hash")
+	}
+
+	s := NewSeenTxs(10, time.Minute)
+	if s.Seen(tx) {
+		t.Error("new tx seen")
+	}
+	if !s.Seen(tx) {
+		t.Error("identical relay not seen")
+	}
+	if s.Seen(rewitnessed) {
+		t.Error("rewitnessed tx seen, want it treated as new")
+	}
+	if got := s.Len(); got != 2 {
+		t.Errorf("Len = %d, want 2", got)
+	}
+
+	s = NewSeenTxs(10, time.Minute)
+	s.ByID = true
+	s.Seen(tx)
+	if !s.Seen(rewitnessed) {
+		t.Error("rewitnessed tx not seen with ByID")
+	}
+
+	s.Forget(tx.ID)
+	if s.Len() != 0 {
+		t.Errorf("Len after Forget = %d, want 0", s.Len())
+	}
+	if s.Seen(rewitnessed) {
+		t.Error("forgotten tx seen")
+	}
+}
+
+func TestSeenTxsBounds(t *testing.T) {
+	exp := time.Now().Add(time.Hour)
+	var txs []*bc.Tx
+	for i := 0; i < 3; i++ {
+		txs = append(txs, bctest.EmptyTx(t, bc.Hash{}, exp))
+	}
+
+	now := time.Unix(1000, 0)
+	s := NewSeenTxs(2, time.Minute)
+	s.now = func() time.Time { return now }
+
+	s.Seen(txs[0])
+	s.Seen(txs[1])
+	s.Seen(txs[2]) // evicts txs[0]
+	if got := s.Len(); got != 2 {
+		t.Errorf("Len = %d, want 2", got)
+	}
+	if !s.Seen(txs[2]) {
+		t.Error("recent tx not seen")
+	}
+	if s.Seen(txs[0]) { // evicts txs[1]
+		t.Error("evicted tx seen")
+	}
+
+	now = now.Add(time.Minute)
+	if s.Seen(txs[2]) {
+		t.Error("expired tx seen")
+	}
+	if got := s.Len(); got != 1 {
+		t.Errorf("Len after expiry = %d, want 1", got)
+	}
+}
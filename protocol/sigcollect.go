@@ -0,0 +1,128 @@
+package protocol
+
+import (
+	"bytes"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/validation"
+)
+
+var (
+	// ErrUnknownSigner is returned when a block signature is offered
+	// by a key that is not in the block's signer set.
+	ErrUnknownSigner = errors.New("signer not in block predicate")
+
+	// ErrDuplicateSig is returned when a signer's signature has
+	// already been collected.
+	ErrDuplicateSig = errors.New("duplicate block signature")
+
+	// ErrBadBlockSig is returned when a block signature fails
+	// verification against the signer's key.
+	ErrBadBlockSig = errors.New("invalid block signature")
+
+	// ErrNoQuorum is returned when block arguments are requested
+	// before a quorum of signatures has been collected.
+	ErrNoQuorum = errors.New("insufficient block signatures for quorum")
+)
+
+// SigCollector gathers the individual signatures of a block's signers
+// and assembles them into the block's predicate arguments once a
+// quorum is reached. The predicate is the NextPredicate of the
+// block's predecessor.
+//
+// SigCollector is not safe for concurrent use.
+type SigCollector struct {
+	pred  *bc.Predicate
+	hash  bc.Hash
+	sigs  [][]byte // parallel to pred.Pubkeys
+	count int
+}
+
+// NewSigCollector returns a SigCollector for signatures over b
+// satisfying pred. Only version-1 (multisig) predicates are
+// supported.
+func NewSigCollector(b *bc.Block, pred *bc.Predicate) (*SigCollector, error) {
+	if pred.Version != 1 {
+		return nil, errors.WithDetailf(ErrBadBlockSig, "unsupported predicate version %d", pred.Version)
+	}
+	return &SigCollector{
+		pred: pred,
+		hash: b.Hash(),
+		sigs: make([][]byte, len(pred.Pubkeys)),
+	}, nil
+}
+
+// Add verifies sig as pubkey's signature over the block and records
+// it. It returns ErrUnknownSigner if pubkey is not in the predicate,
+// ErrDuplicateSig if pubkey has already signed, and ErrBadBlockSig
+// if the signature does not verify.
+func (sc *SigCollector) Add(pubkey ed25519.PublicKey, sig []byte) error {
+	idx := -1
+	for i, pk := range sc.pred.Pubkeys {
+		if bytes.Equal(pk, pubkey) {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return errors.WithDetailf(ErrUnknownSigner, "public key %x", []byte(pubkey))
+	}
+	if sc.sigs[idx] != nil {
+		return errors.WithDetailf(ErrDuplicateSig, "public key %x", []byte(pubkey))
+	}
+	if len(sig) != ed25519.SignatureSize || !ed25519.Verify(pubkey, sc.hash.Bytes(), sig) {
+		return errors.WithDetailf(ErrBadBlockSig, "public key %x, signature %x", []byte(pubkey), sig)
+	}
+	sc.sigs[idx] = sig
+	sc.count++
+	return nil
+}
+
+// Ready tells whether a quorum of signatures has been collected.
+func (sc *SigCollector) Ready() bool {
+	return sc.count >= int(sc.pred.Quorum)
+}
+
+// Arguments produces the block's predicate arguments: one entry per
+// predicate pubkey, in predicate order, with an empty string for each
+// signer not counted toward the quorum. When more than a quorum of
+// signatures has been collected, the earliest signers in predicate
+// order are used, since the predicate requires exactly a quorum.
+func (sc *SigCollector) Arguments() ([]interface{}, error) {
+	if !sc.Ready() {
+		return nil, errors.WithDetailf(ErrNoQuorum, "have %d of %d", sc.count, sc.pred.Quorum)
+	}
+	args := make([]interface{}, 0, len(sc.sigs))
+	var n int32
+	for _, sig := range sc.sigs {
+		if sig != nil && n < sc.pred.Quorum {
+			args = append(args, sig)
+			n++
+		} else {
+			args = append(args, []byte{})
+		}
+	}
+	return args, nil
+}
+
+// SingleSignerPredicate returns the predicate satisfied by the
+// signature of the one key pub, for single-key generators such as
+// those of test networks.
+func SingleSignerPredicate(pub ed25519.PublicKey) *bc.Predicate {
+	return &bc.Predicate{Version: 1, Quorum: 1, Pubkeys: [][]byte{pub}}
+}
+
+// SignSingle returns the predicate arguments for b under the
+// SingleSignerPredicate of priv's public key: priv's signature over
+// b's hash. The caller sets them as b.Arguments.
+func SignSingle(b *bc.Block, priv ed25519.PrivateKey) []interface{} {
+	return []interface{}{ed25519.Sign(priv, b.Hash().Bytes())}
+}
+
+// VerifySingle checks b's predicate arguments against the
+// SingleSignerPredicate of pub.
+func VerifySingle(b *bc.Block, pub ed25519.PublicKey) error {
+	return validation.BlockSig(b, SingleSignerPredicate(pub))
+}
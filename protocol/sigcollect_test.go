@@ -0,0 +1,137 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/validation"
+	"github.com/chain/txvm/testutil"
+)
+
+func TestSigCollector(t *testing.T) {
+	var (
+		pubkeys  []ed25519.PublicKey
+		privkeys []ed25519.PrivateKey
+	)
+	pred := &bc.Predicate{Version: 1, Quorum: 2}
+	for i := 0; i < 3; i++ {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		pubkeys = append(pubkeys, pub)
+		privkeys = append(privkeys, priv)
+		pred.Pubkeys = append(pred.Pubkeys, pub)
+	}
+
+	b := &bc.Block{BlockHeader: &bc.BlockHeader{Version: 3, Height: 2, TimestampMs: 1000, NextPredicate: pred}}
+	msg := b.Hash().Bytes()
+
+	sc, err := NewSigCollector(b, pred)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// An interloper's signature is rejected.
+	interPub, interPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = sc.Add(interPub, ed25519.Sign(interPriv, msg))
+	if errors.Root(err) != ErrUnknownSigner {
+		t.Errorf("interloper: got error %v, want %v", err, ErrUnknownSigner)
+	}
+
+	// A signer's key with someone else's signature is rejected.
+	err = sc.Add(pubkeys[0], ed25519.Sign(interPriv, msg))
+	if errors.Root(err) != ErrBadBlockSig {
+		t.Errorf("bad signature: got error %v, want %v", err, ErrBadBlockSig)
+	}
+
+	err = sc.Add(pubkeys[2], ed25519.Sign(privkeys[2], msg))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if sc.Ready() {
+		t.Error("collector ready after 1 of 2 signatures")
+	}
+	_, err = sc.Arguments()
+	if errors.Root(err) != ErrNoQuorum {
+		t.Errorf("early Arguments: got error %v, want %v", err, ErrNoQuorum)
+	}
+
+	err = sc.Add(pubkeys[2], ed25519.Sign(privkeys[2], msg))
+	if errors.Root(err) != ErrDuplicateSig {
+		t.Errorf("duplicate: got error %v, want %v", err, ErrDuplicateSig)
+	}
+
+	err = sc.Add(pubkeys[0], ed25519.Sign(privkeys[0], msg))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !sc.Ready() {
+		t.Fatal("collector not ready after 2 of 2 signatures")
+	}
+
+	b.Arguments, err = sc.Arguments()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if got := b.Arguments[1].([]byte); len(got) != 0 {
+		t.Errorf("non-signer argument = %x, want empty", got)
+	}
+	err = validation.BlockSig(b, pred)
+	if err != nil {
+		t.Errorf("assembled block fails predicate: %v", err)
+	}
+
+	// Collecting more than a quorum still yields exactly a quorum.
+	err = sc.Add(pubkeys[1], ed25519.Sign(privkeys[1], msg))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	b.Arguments, err = sc.Arguments()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = validation.BlockSig(b, pred)
+	if err != nil {
+		t.Errorf("over-quorum block fails predicate: %v", err)
+	}
+}
+
+func TestSignSingle(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	otherPub, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	pred := SingleSignerPredicate(pub)
+
+	b := &bc.Block{BlockHeader: &bc.BlockHeader{Version: 3, Height: 2, TimestampMs: 1000, NextPredicate: pred}}
+	b.Arguments = SignSingle(b, priv)
+
+	err = VerifySingle(b, pub)
+	if err != nil {
+		t.Errorf("VerifySingle: %v", err)
+	}
+	err = validation.BlockSig(b, pred)
+	if err != nil {
+		t.Errorf("BlockSig: %v", err)
+	}
+	err = VerifySingle(b, otherPub)
+	if err == nil {
+		t.Error("VerifySingle with another key: got nil error")
+	}
+
+	b.Arguments = SignSingle(b, otherPriv)
+	err = VerifySingle(b, pub)
+	if err == nil {
+		t.Error("VerifySingle of another key's signature: got nil error")
+	}
+}
@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"context"
+	"sync"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// ErrAlreadySigned is returned when a Signer is asked to sign a block
+// at or below the height of a different block it has already signed.
+var ErrAlreadySigned = errors.New("already signed a block at this height")
+
+// SignerStore provides persistent storage for a Signer's record of
+// the most recent block it signed.
+type SignerStore interface {
+	// LatestSigned returns the height and ID of the most recent
+	// block signed, or zero values if none has been.
+	LatestSigned(context.Context) (height uint64, id bc.Hash, err error)
+
+	// SaveSigned records that the block with the given height and
+	// ID is about to be signed. It must not return until the record
+	// is durable.
+	SaveSigned(ctx context.Context, height uint64, id bc.Hash) error
+}
+
+// Signer signs blocks with a single key, at most one block at each
+// height. Before producing a signature it records the block's height
+// and ID in its SignerStore, so the guarantee survives a crash and
+// restart.
+//
+// Signer does not validate blocks; callers should do that (e.g. with
+// Chain.ValidateBlock) before calling SignBlock.
+//
+// Signer is safe for concurrent use.
+type Signer struct {
+	key   ed25519.PrivateKey
+	store SignerStore
+
+	mu     sync.Mutex
+	height uint64
+	id     bc.Hash
+}
+
+// NewSigner returns a Signer for key that records its progress in
+// store, resuming from whatever store has already recorded.
+func NewSigner(ctx context.Context, key ed25519.PrivateKey, store SignerStore) (*Signer, error) {
+	height, id, err := store.LatestSigned(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up latest signed block")
+	}
+	return &Signer{
+		key:    key,
+		store:  store,
+		height: height,
+		id:     id,
+	}, nil
+}
+
+// SignBlock returns s's signature over b. It returns
+// ErrAlreadySigned if s has signed a different block at the same or
+// a greater height. Signing the most recently signed block again
+// returns the same signature.
+func (s *Signer) SignBlock(ctx context.Context, b *bc.Block) ([]byte, error) {
+	id := b.Hash()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b.Height < s.height || (b.Height == s.height && id != s.id) {
+		return nil, errors.WithDetailf(ErrAlreadySigned, "requested height %d, last signed height %d", b.Height, s.height)
+	}
+	if b.Height > s.height {
+		err := s.store.SaveSigned(ctx, b.Height, id)
+		if err != nil {
+			return nil, errors.Wrap(err, "recording signed block")
+		}
+		s.height, s.id = b.Height, id
+	}
+	return ed25519.Sign(s.key, id.Bytes()), nil
+}
@@ -0,0 +1,78 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/prottest/memstore"
+	"github.com/chain/txvm/testutil"
+)
+
+func TestSigner(t *testing.T) {
+	ctx := context.Background()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	block := func(height, ts uint64) *bc.Block {
+		return &bc.Block{BlockHeader: &bc.BlockHeader{
+			Version:       3,
+			Height:        height,
+			TimestampMs:   ts,
+			NextPredicate: &bc.Predicate{Version: 1},
+		}}
+	}
+	b2, b2fork, b3 := block(2, 1000), block(2, 2000), block(3, 3000)
+
+	store := memstore.New()
+	s, err := NewSigner(ctx, priv, store)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	sig, err := s.SignBlock(ctx, b2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !ed25519.Verify(pub, b2.Hash().Bytes(), sig) {
+		t.Error("signature does not verify")
+	}
+
+	// Signing the same block again is harmless.
+	again, err := s.SignBlock(ctx, b2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if string(again) != string(sig) {
+		t.Error("re-signing produced a different signature")
+	}
+
+	_, err = s.SignBlock(ctx, b2fork)
+	if errors.Root(err) != ErrAlreadySigned {
+		t.Errorf("signing competing block: got error %v, want %v", err, ErrAlreadySigned)
+	}
+
+	// A new Signer on the same store picks up where the old one
+	// left off.
+	s, err = NewSigner(ctx, priv, store)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = s.SignBlock(ctx, b2fork)
+	if errors.Root(err) != ErrAlreadySigned {
+		t.Errorf("signing competing block after restart: got error %v, want %v", err, ErrAlreadySigned)
+	}
+	_, err = s.SignBlock(ctx, b3)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = s.SignBlock(ctx, b2)
+	if errors.Root(err) != ErrAlreadySigned {
+		t.Errorf("signing lower block: got error %v, want %v", err, ErrAlreadySigned)
+	}
+	if store.SignedHeight != 3 || store.SignedID != b3.Hash() {
+		t.Errorf("store recorded height %d, want 3", store.SignedHeight)
+	}
+}
@@ -0,0 +1,64 @@
+package state
+
+import (
+	"bytes"
+
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/patricia"
+)
+
+// SnapshotDiff is the difference between the unspent output sets of
+// two snapshots, as computed by Diff.
+type SnapshotDiff struct {
+	// Created holds the IDs of outputs unspent in the second snapshot
+	// but not the first, in ascending order.
+	Created []bc.Hash
+
+	// Spent holds the IDs of outputs unspent in the first snapshot
+	// but not the second, in ascending order.
+	Spent []bc.Hash
+}
+
+// Diff compares the contracts trees of before and after and returns
+// the outputs created and spent between them. It looks only at the
+// output sets, so an output both created and spent between the two
+// snapshots appears in neither list, and nonces are ignored.
+func Diff(before, after *Snapshot) *SnapshotDiff {
+	b := outputIDs(before)
+	a := outputIDs(after)
+
+	d := new(SnapshotDiff)
+	for len(b) > 0 || len(a) > 0 {
+		switch {
+		case len(a) == 0:
+			d.Spent = append(d.Spent, bc.HashFromBytes(b[0]))
+			b = b[1:]
+		case len(b) == 0:
+			d.Created = append(d.Created, bc.HashFromBytes(a[0]))
+			a = a[1:]
+		default:
+			switch bytes.Compare(b[0], a[0]) {
+			case -1:
+				d.Spent = append(d.Spent, bc.HashFromBytes(b[0]))
+				b = b[1:]
+			case 1:
+				d.Created = append(d.Created, bc.HashFromBytes(a[0]))
+				a = a[1:]
+			default:
+				b, a = b[1:], a[1:]
+			}
+		}
+	}
+	return d
+}
+
+// outputIDs returns the items of s's contracts tree in ascending
+// order.
+func outputIDs(s *Snapshot) [][]byte {
+	var ids [][]byte
+	patricia.Walk(s.ContractsTree, func(item []byte) error {
+		ids = append(ids, item)
+		return nil
+	})
+	return ids
+}
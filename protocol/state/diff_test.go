@@ -0,0 +1,53 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chain/txvm/protocol/bc"
+)
+
+func TestDiff(t *testing.T) {
+	withOutputs := func(ids ...byte) *Snapshot {
+		s := empty(t)
+		for _, i := range ids {
+			err := s.ContractsTree.Insert(bc.NewHash([32]byte{i}).Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return s
+	}
+	hashes := func(ids ...byte) []bc.Hash {
+		var res []bc.Hash
+		for _, i := range ids {
+			res = append(res, bc.NewHash([32]byte{i}))
+		}
+		return res
+	}
+
+	cases := []struct {
+		name          string
+		before, after *Snapshot
+		created       []bc.Hash
+		spent         []bc.Hash
+	}{
+		{"both empty", withOutputs(), withOutputs(), nil, nil},
+		{"unchanged", withOutputs(1, 2), withOutputs(2, 1), nil, nil},
+		{"created", withOutputs(2), withOutputs(3, 1, 2), hashes(1, 3), nil},
+		{"spent", withOutputs(1, 2, 3), withOutputs(2), nil, hashes(1, 3)},
+		{"both", withOutputs(1, 3, 5), withOutputs(2, 3, 4), hashes(2, 4), hashes(1, 5)},
+		{"all replaced", withOutputs(1, 2), withOutputs(3), hashes(3), hashes(1, 2)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := Diff(c.before, c.after)
+			if !reflect.DeepEqual(d.Created, c.created) {
+				t.Errorf("created = %x, want %x", d.Created, c.created)
+			}
+			if !reflect.DeepEqual(d.Spent, c.spent) {
+				t.Errorf("spent = %x, want %x", d.Spent, c.spent)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/chain/txvm/crypto/sha3"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// Export and Import use a container format for moving a snapshot
+// between machines. All integers are big-endian.
+//
+//   magic       8 bytes, "txvmsnap"
+//   version     4 bytes, currently 1
+//   height      8 bytes
+//   block ID   32 bytes, the hash of the snapshot's header
+//                        (all zeroes if there is none)
+//   length      8 bytes, the length of the payload
+//   payload    the snapshot, as produced by Snapshot.Bytes
+//   checksum   32 bytes, SHA3-256 of everything above
+const (
+	exportMagic   = "txvmsnap"
+	exportVersion = 1
+	exportPrefix  = len(exportMagic) + 4 + 8 + 32 + 8
+)
+
+var (
+	// ErrExportFormat is returned by Import for input that is not a
+	// complete snapshot export, including truncated input.
+	ErrExportFormat = errors.New("invalid snapshot export")
+
+	// ErrExportVersion is returned by Import for a snapshot export
+	// with an unknown format version.
+	ErrExportVersion = errors.New("unknown snapshot export version")
+
+	// ErrExportChecksum is returned by Import when the checksum of a
+	// snapshot export does not match its contents.
+	ErrExportChecksum = errors.New("snapshot export checksum mismatch")
+)
+
+// Export writes s to w in a self-describing, versioned,
+// checksummed format that Import can read.
+func (s *Snapshot) Export(w io.Writer) error {
+	payload, err := s.Bytes()
+	if err != nil {
+		return err
+	}
+
+	var blockID bc.Hash
+	if s.Header != nil {
+		blockID = s.Header.Hash()
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(exportMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(exportVersion))
+	binary.Write(&buf, binary.BigEndian, s.Height())
+	buf.Write(blockID.Bytes())
+	binary.Write(&buf, binary.BigEndian, uint64(len(payload)))
+	buf.Write(payload)
+	sum := sha3.Sum256(buf.Bytes())
+	buf.Write(sum[:])
+
+	_, err = buf.WriteTo(w)
+	return errors.Wrap(err, "writing snapshot export")
+}
+
+// Import reads a snapshot written by Export from r. It verifies the
+// checksum, and that the height and block ID recorded in the
+// container match the snapshot's header.
+func Import(r io.Reader) (*Snapshot, error) {
+	h := sha3.New256()
+	r = io.TeeReader(r, h)
+
+	prefix := make([]byte, exportPrefix)
+	_, err := io.ReadFull(r, prefix)
+	if err != nil {
+		return nil, importErr(err, "reading header")
+	}
+	if string(prefix[:len(exportMagic)]) != exportMagic {
+		return nil, errors.WithDetail(ErrExportFormat, "bad magic number")
+	}
+	fields := prefix[len(exportMagic):]
+	version := binary.BigEndian.Uint32(fields)
+	if version != exportVersion {
+		return nil, errors.WithDetailf(ErrExportVersion, "version %d", version)
+	}
+	height := binary.BigEndian.Uint64(fields[4:])
+	blockID := bc.HashFromBytes(fields[12:44])
+	length := binary.BigEndian.Uint64(fields[44:])
+
+	// Copy rather than allocating length bytes up front,
+	// so a corrupt length can't cause a huge allocation.
+	var payload bytes.Buffer
+	n, err := io.CopyN(&payload, r, int64(length))
+	if err != nil || uint64(n) != length {
+		return nil, importErr(err, "reading payload")
+	}
+
+	want := h.Sum(nil)
+	var got [32]byte
+	_, err = io.ReadFull(r, got[:])
+	if err != nil {
+		return nil, importErr(err, "reading checksum")
+	}
+	if !bytes.Equal(got[:], want) {
+		return nil, errors.WithDetailf(ErrExportChecksum, "got %x, want %x", got[:], want)
+	}
+
+	s := Empty()
+	err = s.FromBytes(payload.Bytes())
+	if err != nil {
+		return nil, errors.Sub(ErrExportFormat, err)
+	}
+	if s.Height() != height {
+		return nil, errors.WithDetailf(ErrExportFormat, "container height %d, snapshot height %d", height, s.Height())
+	}
+	var snapshotID bc.Hash
+	if s.Header != nil {
+		snapshotID = s.Header.Hash()
+	}
+	if snapshotID != blockID {
+		return nil, errors.WithDetailf(ErrExportFormat, "container block ID %x, snapshot block ID %x", blockID.Bytes(), snapshotID.Bytes())
+	}
+	return s, nil
+}
+
+func importErr(err error, msg string) error {
+	if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.WithDetailf(ErrExportFormat, "truncated input %s", msg)
+	}
+	return errors.Wrap(err, msg)
+}
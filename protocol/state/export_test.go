@@ -0,0 +1,105 @@
+package state
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+func exportTestSnapshot(t *testing.T) *Snapshot {
+	s := empty(t)
+	for i := byte(1); i <= 5; i++ {
+		id := bc.NewHash([32]byte{i})
+		err := s.ContractsTree.Insert(id.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.NonceTree.Insert(NonceCommitment(bc.NewHash([32]byte{9}), 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RefIDs = append(s.RefIDs, bc.NewHash([32]byte{7}))
+	return s
+}
+
+func TestExportImport(t *testing.T) {
+	for _, s := range []*Snapshot{Empty(), exportTestSnapshot(t)} {
+		var buf bytes.Buffer
+		err := s.Export(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Import(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ContractsTree.RootHash() != s.ContractsTree.RootHash() {
+			t.Error("contracts tree differs after round trip")
+		}
+		if got.NonceTree.RootHash() != s.NonceTree.RootHash() {
+			t.Error("nonce tree differs after round trip")
+		}
+		if got.Height() != s.Height() {
+			t.Errorf("got height %d, want %d", got.Height(), s.Height())
+		}
+		if s.Header != nil && got.Header.Hash() != s.Header.Hash() {
+			t.Error("header differs after round trip")
+		}
+		if got.InitialBlockID != s.InitialBlockID {
+			t.Errorf("got initial block ID %x, want %x", got.InitialBlockID.Bytes(), s.InitialBlockID.Bytes())
+		}
+		if len(got.RefIDs) != len(s.RefIDs) {
+			t.Errorf("got %d ref IDs, want %d", len(got.RefIDs), len(s.RefIDs))
+		} else {
+			for i := range s.RefIDs {
+				if got.RefIDs[i] != s.RefIDs[i] {
+					t.Errorf("ref ID %d is %x, want %x", i, got.RefIDs[i].Bytes(), s.RefIDs[i].Bytes())
+				}
+			}
+		}
+	}
+}
+
+func TestImportCorruption(t *testing.T) {
+	var buf bytes.Buffer
+	err := exportTestSnapshot(t).Export(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := buf.Bytes()
+
+	// Every truncation is rejected.
+	for n := 0; n < len(exported); n++ {
+		_, err := Import(bytes.NewReader(exported[:n]))
+		if errors.Root(err) != ErrExportFormat {
+			t.Fatalf("Import(truncated to %d bytes) = %v, want %v", n, err, ErrExportFormat)
+		}
+	}
+
+	corrupt := func(i int) []byte {
+		b := append([]byte{}, exported...)
+		b[i] ^= 0x01
+		return b
+	}
+	cases := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{"magic", corrupt(0), ErrExportFormat},
+		{"version", corrupt(len(exportMagic) + 3), ErrExportVersion},
+		{"height", corrupt(len(exportMagic) + 11), ErrExportChecksum},
+		{"block ID", corrupt(len(exportMagic) + 12), ErrExportChecksum},
+		{"payload", corrupt(exportPrefix + 5), ErrExportChecksum},
+		{"checksum", corrupt(len(exported) - 1), ErrExportChecksum},
+	}
+	for _, c := range cases {
+		_, err := Import(bytes.NewReader(c.input))
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("Import(corrupt %s) = %v, want %v", c.name, err, c.wantErr)
+		}
+	}
+}
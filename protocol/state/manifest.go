@@ -0,0 +1,53 @@
+package state
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/patricia"
+)
+
+// ExportManifest writes a manifest of s's unspent outputs to w, for
+// reconciling the state with an external ledger. The manifest is
+// text, one item per line:
+//
+//	txvm-manifest 1
+//	height <height>
+//	block <hex ID of s's header, or all zeroes if there is none>
+//	output <hex output ID>         (once per output, in ascending order)
+//	contracts-root <hex root>
+//
+// The contracts root is that of s's contracts tree, the commitment a
+// block header makes to the output set, so it can be recomputed from
+// the listed IDs with a patricia tree and checked against a block.
+//
+// A snapshot records only the IDs of unspent outputs, so the manifest
+// does not include their assets, amounts, or programs; those must be
+// looked up in the transactions that created them.
+//
+// Snapshots with the same header and output set produce
+// byte-identical manifests.
+func (s *Snapshot) ExportManifest(w io.Writer) error {
+	var blockID bc.Hash
+	if s.Header != nil {
+		blockID = s.Header.Hash()
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "txvm-manifest 1\n")
+	fmt.Fprintf(bw, "height %d\n", s.Height())
+	fmt.Fprintf(bw, "block %x\n", blockID.Bytes())
+	err := patricia.Walk(s.ContractsTree, func(item []byte) error {
+		_, err := fmt.Fprintf(bw, "output %x\n", item)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "writing snapshot manifest")
+	}
+	root := s.ContractsTree.RootHash()
+	fmt.Fprintf(bw, "contracts-root %x\n", root[:])
+	return errors.Wrap(bw.Flush(), "writing snapshot manifest")
+}
@@ -0,0 +1,88 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/patricia"
+)
+
+func TestExportManifest(t *testing.T) {
+	manifest := func(s *Snapshot) []byte {
+		var buf bytes.Buffer
+		err := s.ExportManifest(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	withOutputs := func(ids ...byte) *Snapshot {
+		s := empty(t)
+		for _, i := range ids {
+			id := bc.NewHash([32]byte{i})
+			err := s.ContractsTree.Insert(id.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return s
+	}
+
+	a := manifest(withOutputs(3, 1, 2))
+	if b := manifest(withOutputs(1, 2, 3)); !bytes.Equal(a, b) {
+		t.Errorf("equal snapshots have different manifests:\n%s\n%s", a, b)
+	}
+	if b := manifest(withOutputs(1, 2, 4)); bytes.Equal(a, b) {
+		t.Error("snapshots with different outputs have the same manifest")
+	}
+	if b := manifest(withOutputs(1, 2)); bytes.Equal(a, b) {
+		t.Error("snapshot with a spent output has the same manifest")
+	}
+	s := withOutputs(1, 2, 3)
+	s.Header.TimestampMs++
+	if b := manifest(s); bytes.Equal(a, b) {
+		t.Error("snapshots with different headers have the same manifest")
+	}
+
+	// The outputs are in ascending order, and rebuild the contracts
+	// root.
+	s = withOutputs(3, 1, 2)
+	tree := patricia.NewTree(nil)
+	var (
+		prev []byte
+		root string
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(a))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch fields[0] {
+		case "output":
+			id, err := hex.DecodeString(fields[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if prev != nil && bytes.Compare(prev, id) >= 0 {
+				t.Errorf("output %x follows %x", id, prev)
+			}
+			prev = id
+			err = tree.Insert(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+		case "contracts-root":
+			root = fields[1]
+		}
+	}
+	want := s.ContractsTree.RootHash()
+	if root != fmt.Sprintf("%x", want[:]) {
+		t.Errorf("manifest has contracts root %s, want %x", root, want[:])
+	}
+	if got := tree.RootHash(); got != want {
+		t.Errorf("root from manifest outputs is %x, want %x", got[:], want[:])
+	}
+}
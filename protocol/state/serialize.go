@@ -44,6 +44,9 @@ func (s *Snapshot) Bytes() ([]byte, error) {
 	if !s.InitialBlockID.IsZero() {
 		rs.InitialBlockId = &s.InitialBlockID
 	}
+	for i := range s.RefIDs {
+		rs.RefIds = append(rs.RefIds, &s.RefIDs[i])
+	}
 	b, err := proto.Marshal(&rs)
 	return b, errors.Wrap(err, "marshaling state snapshot")
 }
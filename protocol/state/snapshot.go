@@ -8,11 +8,20 @@ import (
 	"encoding/binary"
 	"fmt"
 
+	"github.com/golang/protobuf/proto"
+
 	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/bc"
 	"github.com/chain/txvm/protocol/patricia"
 )
 
+// ErrSpendBeforeCreate is returned by ApplyBlock and CheckSpendOrder
+// for a block that spends an output before the transaction creating
+// it. Its data (see errors.Data) has the output ID under "output",
+// and the indexes of the spending and creating transactions under
+// "spend" and "create".
+var ErrSpendBeforeCreate = errors.New("output spent before it is created")
+
 // Snapshot contains a blockchain's state.
 //
 // TODO: consider making type Snapshot truly immutable.  We already
@@ -75,7 +84,8 @@ func Empty() *Snapshot {
 
 // ApplyBlock updates s in place. It runs in three phases:
 // PruneNonces, ApplyBlockHeader, and ApplyTx
-// (the latter called in a loop for each transaction). Callers
+// (the latter called in a loop for each transaction, after
+// CheckSpendOrder checks the transactions' order). Callers
 // are free to invoke those phases separately.
 func (s *Snapshot) ApplyBlock(block *bc.Block) error {
 	s.PruneNonces(block.TimestampMs)
@@ -85,6 +95,13 @@ func (s *Snapshot) ApplyBlock(block *bc.Block) error {
 		return errors.Wrap(err, "applying block header")
 	}
 
+	err = checkSpendOrder(block.Transactions, func(id bc.Hash) bool {
+		return s.ContractsTree.Contains(id.Bytes())
+	})
+	if err != nil {
+		return err
+	}
+
 	for i, tx := range block.Transactions {
 		err = s.ApplyTx(tx)
 		if err != nil {
@@ -95,6 +112,56 @@ func (s *Snapshot) ApplyBlock(block *bc.Block) error {
 	return nil
 }
 
+// CheckSpendOrder checks that no transaction in txs, a block's
+// transactions in order, spends an output before the transaction
+// creating it, or before its creation in the same transaction. If one
+// does, it returns ErrSpendBeforeCreate. The contracts are checked in
+// order, tracking which outputs created in txs are unspent, so an
+// output may be created, spent, and created and spent again. A spend
+// of an output with no later creation in txs is not checked; it must
+// have been created before txs.
+func CheckSpendOrder(txs []*bc.Tx) error {
+	return checkSpendOrder(txs, nil)
+}
+
+// checkSpendOrder is CheckSpendOrder, except that if existing is
+// non-nil, a spend of an output for which it reports true is allowed
+// even if the output is created again later in txs.
+func checkSpendOrder(txs []*bc.Tx, existing func(bc.Hash) bool) error {
+	// pending holds, for each output ID, the indexes of the
+	// transactions creating it that have not yet been reached.
+	pending := make(map[bc.Hash][]int)
+	for i, tx := range txs {
+		for _, con := range tx.Contracts {
+			if con.Type == bc.OutputType {
+				pending[con.ID] = append(pending[con.ID], i)
+			}
+		}
+	}
+	live := make(map[bc.Hash]bool)
+	for i, tx := range txs {
+		for _, con := range tx.Contracts {
+			switch con.Type {
+			case bc.OutputType:
+				live[con.ID] = true
+				pending[con.ID] = pending[con.ID][1:]
+			case bc.InputType:
+				if live[con.ID] {
+					delete(live, con.ID)
+					continue
+				}
+				later := pending[con.ID]
+				if len(later) == 0 || (existing != nil && existing(con.ID)) {
+					continue
+				}
+				err := errors.WithDetailf(ErrSpendBeforeCreate, "output %x spent in transaction %d, created in transaction %d", con.ID.Bytes(), i, later[0])
+				return errors.WithData(err, "output", con.ID, "spend", i, "create", later[0])
+			}
+		}
+	}
+	return nil
+}
+
 // ApplyBlockHeader is the header-specific phase of applying a block
 // to the blockchain state. (See ApplyBlock.)
 func (s *Snapshot) ApplyBlockHeader(bh *bc.BlockHeader) error {
@@ -191,6 +258,41 @@ func (s *Snapshot) TimestampMS() uint64 {
 	return s.Header.TimestampMs
 }
 
+// EstimateMemory returns the approximate number of bytes used by
+// s: the nodes of its contracts and nonce trees, and its block
+// header and RefIDs. It uses item counts maintained by the trees
+// and does not walk them. Nodes shared with copies of s are
+// counted in full.
+func (s *Snapshot) EstimateMemory() int64 {
+	n := s.ContractsTree.EstimateMemory() + s.NonceTree.EstimateMemory()
+	n += int64(len(s.RefIDs) * 32)
+	if s.Header != nil {
+		n += int64(proto.Size(s.Header))
+	}
+	return n
+}
+
+// Nonce is an entry in a snapshot's nonce set: the ID of a nonce
+// used by a transaction, and the time, in milliseconds, when it
+// expires and is pruned from the set.
+type Nonce struct {
+	ID    bc.Hash
+	ExpMS uint64
+}
+
+// Nonces returns the entries in s's nonce set, ordered by ID. A
+// transaction using a nonce in the set is rejected as a replay until
+// the nonce expires.
+func (s *Snapshot) Nonces() []Nonce {
+	var nonces []Nonce
+	patricia.Walk(s.NonceTree, func(item []byte) error {
+		id, exp := idTime(item)
+		nonces = append(nonces, Nonce{ID: id, ExpMS: exp})
+		return nil
+	})
+	return nonces
+}
+
 // NonceCommitment returns the byte commitment
 // for the given nonce id and expiration.
 func NonceCommitment(id bc.Hash, expms uint64) []byte {
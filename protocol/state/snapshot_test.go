@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/bc"
 )
 
@@ -73,6 +74,37 @@ func TestCopySnapshot(t *testing.T) {
 	}
 }
 
+func TestEstimateMemory(t *testing.T) {
+	snap := empty(t)
+	prev := snap.EstimateMemory()
+	if prev <= 0 {
+		t.Fatalf("EstimateMemory = %d, want positive", prev)
+	}
+	for i := 1; i <= 10; i++ {
+		tx := &bc.Tx{
+			Contracts: []bc.Contract{{Type: bc.OutputType, ID: bc.NewHash([32]byte{byte(i)})}},
+		}
+		err := snap.ApplyTx(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := snap.EstimateMemory()
+		if got <= prev {
+			t.Fatalf("after %d outputs EstimateMemory = %d, want more than %d", i, got, prev)
+		}
+		prev = got
+	}
+
+	tx := &bc.Tx{Nonces: []bc.Nonce{{ID: bc.NewHash([32]byte{2}), ExpMS: 5}}}
+	err := snap.ApplyTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snap.EstimateMemory(); got <= prev {
+		t.Errorf("after nonce EstimateMemory = %d, want more than %d", got, prev)
+	}
+}
+
 func TestApplyBlock(t *testing.T) {
 	maxTime := uint64(10)
 	// Setup a snapshot with a nonce with a known expiry.
@@ -254,3 +286,113 @@ func TestHeaderAccessors(t *testing.T) {
 		}
 	}
 }
+
+func TestNonces(t *testing.T) {
+	snap := empty(t)
+	if got := snap.Nonces(); len(got) != 0 {
+		t.Errorf("empty snapshot has nonces %v", got)
+	}
+
+	tx := &bc.Tx{
+		Nonces: []bc.Nonce{
+			{ID: bc.NewHash([32]byte{2}), ExpMS: 50},
+			{ID: bc.NewHash([32]byte{1}), ExpMS: 10},
+		},
+	}
+	err := snap.ApplyTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Nonce{
+		{ID: bc.NewHash([32]byte{1}), ExpMS: 10},
+		{ID: bc.NewHash([32]byte{2}), ExpMS: 50},
+	}
+	if got := snap.Nonces(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Nonces = %v, want %v", got, want)
+	}
+
+	snap.PruneNonces(11)
+	want = want[1:]
+	if got := snap.Nonces(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after pruning, Nonces = %v, want %v", got, want)
+	}
+}
+
+func TestSpendOrder(t *testing.T) {
+	out := bc.NewHash([32]byte{7})
+	create := &bc.Tx{Contracts: []bc.Contract{{Type: bc.OutputType, ID: out}}}
+	spend := &bc.Tx{Contracts: []bc.Contract{{Type: bc.InputType, ID: out}}}
+	block := func(txs ...*bc.Tx) *bc.Block {
+		return &bc.Block{
+			BlockHeader: &bc.BlockHeader{
+				Height:        2,
+				NextPredicate: &bc.Predicate{},
+			},
+			Transactions: txs,
+		}
+	}
+
+	snap := empty(t)
+	err := snap.ApplyBlock(block(create, spend))
+	if err != nil {
+		t.Fatalf("create then spend: %v", err)
+	}
+	if snap.ContractsTree.Contains(out.Bytes()) {
+		t.Error("spent output still in snapshot")
+	}
+
+	snap = empty(t)
+	err = snap.ApplyBlock(block(spend, create))
+	if errors.Root(err) != ErrSpendBeforeCreate {
+		t.Fatalf("spend then create: got error %v, want %v", err, ErrSpendBeforeCreate)
+	}
+	data := errors.Data(err)
+	if data["output"] != out || data["spend"] != 0 || data["create"] != 1 {
+		t.Errorf("error data = %v, want output %x, spend 0, create 1", data, out.Bytes())
+	}
+
+	// The same holds within a transaction.
+	both := &bc.Tx{Contracts: []bc.Contract{spend.Contracts[0], create.Contracts[0]}}
+	err = CheckSpendOrder([]*bc.Tx{both})
+	if errors.Root(err) != ErrSpendBeforeCreate {
+		t.Errorf("spend then create in one transaction: got error %v, want %v", err, ErrSpendBeforeCreate)
+	}
+	both.Contracts[0], both.Contracts[1] = both.Contracts[1], both.Contracts[0]
+	err = CheckSpendOrder([]*bc.Tx{both})
+	if err != nil {
+		t.Errorf("create then spend in one transaction: %v", err)
+	}
+
+	// An output may be created and spent again, as with outputs whose
+	// IDs are deterministic.
+	snap = empty(t)
+	err = snap.ApplyBlock(block(create, spend, create, spend))
+	if err != nil {
+		t.Errorf("create, spend, create, spend: %v", err)
+	}
+	if snap.ContractsTree.Contains(out.Bytes()) {
+		t.Error("spent output still in snapshot")
+	}
+	err = CheckSpendOrder([]*bc.Tx{create, spend, spend, create})
+	if errors.Root(err) != ErrSpendBeforeCreate {
+		t.Errorf("create, spend, spend, create: got error %v, want %v", err, ErrSpendBeforeCreate)
+	}
+	data = errors.Data(err)
+	if data["spend"] != 2 || data["create"] != 3 {
+		t.Errorf("error data = %v, want spend 2, create 3", data)
+	}
+
+	// An output already in the state may be spent and created again.
+	snap = empty(t)
+	err = snap.ApplyBlock(block(create))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = snap.ApplyBlock(block(spend, create))
+	if err != nil {
+		t.Errorf("spend existing output, then create it again: %v", err)
+	}
+	if !snap.ContractsTree.Contains(out.Bytes()) {
+		t.Error("re-created output missing from snapshot")
+	}
+}
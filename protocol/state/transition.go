@@ -0,0 +1,44 @@
+package state
+
+import (
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// ErrTransition is returned by VerifyTransition when a snapshot is
+// not the result of applying a block to the one before it.
+var ErrTransition = errors.New("snapshot does not follow from block")
+
+// VerifyTransition checks that next is the snapshot produced by
+// applying block to prev: that it has block's header, and the same
+// contracts and nonce trees as a copy of prev with block applied.
+// Prev is not modified.
+//
+// On a mismatch, the returned error has root ErrTransition and its
+// detail names the part of the snapshot that differs. If block cannot
+// be applied to prev at all, the error from ApplyBlock is returned
+// instead.
+func VerifyTransition(prev *Snapshot, block *bc.Block, next *Snapshot) error {
+	applied := Copy(prev)
+	err := applied.ApplyBlock(block)
+	if err != nil {
+		return errors.Wrap(err, "applying block to previous snapshot")
+	}
+
+	if next.Header == nil {
+		return errors.WithDetail(ErrTransition, "next snapshot has no header")
+	}
+	if got, want := next.Header.Hash(), applied.Header.Hash(); got != want {
+		return errors.WithDetailf(ErrTransition, "header %x, want %x (height %d, want %d)", got.Bytes(), want.Bytes(), next.Height(), block.Height)
+	}
+	if next.InitialBlockID != applied.InitialBlockID {
+		return errors.WithDetailf(ErrTransition, "initial block ID %x, want %x", next.InitialBlockID.Bytes(), applied.InitialBlockID.Bytes())
+	}
+	if got, want := next.ContractsTree.RootHash(), applied.ContractsTree.RootHash(); got != want {
+		return errors.WithDetailf(ErrTransition, "contracts root %x, want %x", got[:], want[:])
+	}
+	if got, want := next.NonceTree.RootHash(), applied.NonceTree.RootHash(); got != want {
+		return errors.WithDetailf(ErrTransition, "nonce root %x, want %x", got[:], want[:])
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+func TestVerifyTransition(t *testing.T) {
+	prev := empty(t)
+	block := &bc.Block{
+		BlockHeader: &bc.BlockHeader{
+			Height:        2,
+			TimestampMs:   2,
+			NextPredicate: &bc.Predicate{},
+		},
+		Transactions: []*bc.Tx{{
+			Contracts: []bc.Contract{{Type: bc.OutputType, ID: bc.NewHash([32]byte{1})}},
+			Nonces:    []bc.Nonce{{ID: bc.NewHash([32]byte{2}), ExpMS: 100}},
+		}},
+	}
+	prevRoot := prev.ContractsTree.RootHash()
+
+	next := func() *Snapshot {
+		s := Copy(prev)
+		err := s.ApplyBlock(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	err := VerifyTransition(prev, block, next())
+	if err != nil {
+		t.Fatalf("correct transition: %v", err)
+	}
+	if prev.ContractsTree.RootHash() != prevRoot || prev.Height() != 1 {
+		t.Error("VerifyTransition modified the previous snapshot")
+	}
+
+	cases := []struct {
+		name   string
+		doctor func(*Snapshot)
+	}{
+		{
+			name:   "extra output",
+			doctor: func(s *Snapshot) { s.ContractsTree.Insert(bc.NewHash([32]byte{3}).Bytes()) },
+		},
+		{
+			name:   "missing output",
+			doctor: func(s *Snapshot) { s.ContractsTree.Delete(bc.NewHash([32]byte{1}).Bytes()) },
+		},
+		{
+			name:   "missing nonce",
+			doctor: func(s *Snapshot) { s.NonceTree.Delete(NonceCommitment(bc.NewHash([32]byte{2}), 100)) },
+		},
+		{
+			name: "different header",
+			doctor: func(s *Snapshot) {
+				h := *s.Header
+				h.TimestampMs++
+				s.Header = &h
+			},
+		},
+		{
+			name:   "no header",
+			doctor: func(s *Snapshot) { s.Header = nil },
+		},
+		{
+			name:   "stale",
+			doctor: func(s *Snapshot) { *s = *Copy(prev) },
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := next()
+			c.doctor(s)
+			err := VerifyTransition(prev, block, s)
+			if errors.Root(err) != ErrTransition {
+				t.Errorf("got error %v, want %v", err, ErrTransition)
+			}
+		})
+	}
+
+	// A block that doesn't apply is reported as such, not as a
+	// mismatch.
+	bad := &bc.Block{
+		BlockHeader: &bc.BlockHeader{
+			Height:        3,
+			NextPredicate: &bc.Predicate{},
+		},
+		Transactions: []*bc.Tx{{
+			Contracts: []bc.Contract{{Type: bc.InputType, ID: bc.NewHash([32]byte{4})}},
+		}},
+	}
+	err = VerifyTransition(prev, bad, next())
+	if err == nil || errors.Root(err) == ErrTransition {
+		t.Errorf("inapplicable block: got error %v, want an application error", err)
+	}
+}
@@ -0,0 +1,113 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+var (
+	// ErrTruncatedBlock is returned by CommitStream when the stream
+	// ends partway through a block.
+	ErrTruncatedBlock = errors.New("truncated block in stream")
+
+	// ErrBlockSize is returned by CommitStream when a block's length
+	// prefix is zero or exceeds the limit on the size of a block.
+	ErrBlockSize = errors.New("invalid block size in stream")
+)
+
+// WriteBlock writes b to w in the form read by CommitStream: a 4-byte
+// big-endian length followed by the serialized block.
+func WriteBlock(w io.Writer, b *bc.Block) error {
+	bits, err := b.Bytes()
+	if err != nil {
+		return errors.Wrap(err, "serializing block")
+	}
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(len(bits)))
+	_, err = w.Write(prefix[:])
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bits)
+	return err
+}
+
+// CommitStream reads blocks written by WriteBlock from r, and
+// validates and commits each one in turn, as with ValidateBlock and
+// CommitAppliedBlock. Blocks at or below c's current height are
+// stored, as with CommitBlock, but not otherwise processed.
+//
+// The stream may come from an untrusted source, so each block is
+// decoded with bc.Block.FromBytesLimited and lim. A length prefix
+// larger than lim.MaxBytes fails with ErrBlockSize before any of the
+// block is read. Otherwise the block is read as it arrives, so memory
+// grows with the bytes actually received rather than with the length
+// the prefix declares.
+//
+// CommitStream returns when r is exhausted at a block boundary, with
+// a nil error, or at the first error. Either way, it returns the
+// height of c's state after the last block it committed. If the
+// stream ends partway through a block, the error is
+// ErrTruncatedBlock and the partial block is discarded; the blocks
+// before it remain committed.
+func (c *Chain) CommitStream(ctx context.Context, r io.Reader, lim bc.DecodeLimits) (uint64, error) {
+	var prefix [4]byte
+	for {
+		height := c.State().Height()
+
+		_, err := io.ReadFull(r, prefix[:])
+		if err == io.EOF {
+			return height, nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			return height, errors.WithDetail(ErrTruncatedBlock, "reading length prefix")
+		}
+		if err != nil {
+			return height, errors.Wrap(err, "reading length prefix")
+		}
+
+		n := int64(binary.BigEndian.Uint32(prefix[:]))
+		if n == 0 || (lim.MaxBytes > 0 && n > int64(lim.MaxBytes)) {
+			return height, errors.WithDetailf(ErrBlockSize, "block of %d bytes", n)
+		}
+		var buf bytes.Buffer
+		got, err := buf.ReadFrom(io.LimitReader(r, n))
+		if err != nil {
+			return height, errors.Wrap(err, "reading block")
+		}
+		if got < n {
+			return height, errors.WithDetailf(ErrTruncatedBlock, "reading block of %d bytes", n)
+		}
+
+		block := new(bc.Block)
+		err = block.FromBytesLimited(buf.Bytes(), lim)
+		if err != nil {
+			return height, errors.Wrap(err, "parsing block")
+		}
+
+		if block.Height <= height {
+			err = c.CommitBlock(ctx, block)
+			if err != nil {
+				return height, errors.Wrapf(err, "committing block %d", block.Height)
+			}
+			continue
+		}
+		err = c.checkFutureBlock(block)
+		if err != nil {
+			return height, err
+		}
+		snapshot, err := c.ValidateBlock(block)
+		if err != nil {
+			return height, errors.Wrapf(err, "validating block %d", block.Height)
+		}
+		err = c.CommitAppliedBlock(ctx, block, snapshot)
+		if err != nil {
+			return height, errors.Wrapf(err, "committing block %d", block.Height)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/bc/bctest"
+	"github.com/chain/txvm/protocol/prottest/memstore"
+	"github.com/chain/txvm/testutil"
+)
+
+// streamBlocks generates n blocks after b1 on src and returns them,
+// serialized with WriteBlock.
+func streamBlocks(t *testing.T, src *Chain, b1 *bc.Block, n int) ([]*bc.Block, []byte) {
+	ctx := context.Background()
+	now := time.Now()
+
+	var (
+		blocks []*bc.Block
+		buf    bytes.Buffer
+	)
+	for i := 0; i < n; i++ {
+		curState := src.State()
+		txs := []*bc.Tx{bctest.EmptyTx(t, b1.Hash(), now.Add(time.Minute))}
+		b, s, err := src.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = src.CommitAppliedBlock(ctx, b, s)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = WriteBlock(&buf, b)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, buf.Bytes()
+}
+
+func TestCommitStream(t *testing.T) {
+	ctx := context.Background()
+	src, b1 := newTestChain(t, time.Now())
+	blocks, stream := streamBlocks(t, src, b1, 4)
+
+	c, _ := newTestChain(t, bc.FromMillis(b1.TimestampMs))
+	height, err := c.CommitStream(ctx, iotest.HalfReader(bytes.NewReader(stream)), bc.DecodeLimits{})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if want := blocks[len(blocks)-1].Height; height != want || c.Height() != want {
+		t.Errorf("CommitStream height = %d, chain height = %d, want %d", height, c.Height(), want)
+	}
+
+	// Replaying the stream is harmless.
+	height, err = c.CommitStream(ctx, iotest.OneByteReader(bytes.NewReader(stream)), bc.DecodeLimits{})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if want := blocks[len(blocks)-1].Height; height != want {
+		t.Errorf("replayed CommitStream height = %d, want %d", height, want)
+	}
+}
+
+func TestCommitStreamTruncated(t *testing.T) {
+	ctx := context.Background()
+	src, b1 := newTestChain(t, time.Now())
+	blocks, stream := streamBlocks(t, src, b1, 3)
+
+	// Cut the stream inside the last block, then inside the
+	// last block's length prefix.
+	var last bytes.Buffer
+	err := WriteBlock(&last, blocks[2])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	lastStart := len(stream) - last.Len()
+	for _, cut := range []int{len(stream) - 1, lastStart + 2} {
+		store := memstore.New()
+		c, err := NewChain(ctx, b1, store, nil)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		c.MaxNonceWindow = 48 * time.Hour
+		snapshot, err := c.ValidateBlock(b1)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = c.CommitAppliedBlock(ctx, b1, snapshot)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+
+		height, err := c.CommitStream(ctx, bytes.NewReader(stream[:cut]), bc.DecodeLimits{})
+		if errors.Root(err) != ErrTruncatedBlock {
+			t.Errorf("cut at %d: got error %v, want %v", cut, err, ErrTruncatedBlock)
+		}
+		if want := blocks[1].Height; height != want || c.Height() != want {
+			t.Errorf("cut at %d: height %d, chain height %d, want %d", cut, height, c.Height(), want)
+		}
+		if h, _ := store.Height(ctx); h != blocks[1].Height {
+			t.Errorf("cut at %d: store height %d, want %d", cut, h, blocks[1].Height)
+		}
+	}
+}
+
+func TestCommitStreamBadSize(t *testing.T) {
+	c, _ := newTestChain(t, time.Now())
+	_, err := c.CommitStream(context.Background(), bytes.NewReader([]byte{0, 0, 0, 0}), bc.DecodeLimits{})
+	if errors.Root(err) != ErrBlockSize {
+		t.Errorf("got error %v, want %v", err, ErrBlockSize)
+	}
+}
+
+func TestCommitStreamLimits(t *testing.T) {
+	ctx := context.Background()
+	src, b1 := newTestChain(t, time.Now())
+	_, stream := streamBlocks(t, src, b1, 1)
+	blockLen := len(stream) - 4
+
+	cases := []struct {
+		name    string
+		lim     bc.DecodeLimits
+		wantErr error
+	}{
+		{"within limits", bc.DecodeLimits{MaxBytes: blockLen, MaxTxs: 1}, nil},
+		{"too many bytes", bc.DecodeLimits{MaxBytes: blockLen - 1}, ErrBlockSize},
+		{"field too long", bc.DecodeLimits{MaxFieldLen: 8}, bc.ErrDecodeLimit},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := newTestChain(t, bc.FromMillis(b1.TimestampMs))
+			_, err := c.CommitStream(ctx, bytes.NewReader(stream), tc.lim)
+			if errors.Root(err) != tc.wantErr {
+				t.Errorf("got error %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// A length prefix declaring a huge block, followed by only a few
+// bytes, fails as truncated without allocating the declared size.
+func TestCommitStreamHugePrefix(t *testing.T) {
+	c, _ := newTestChain(t, time.Now())
+	stream := append([]byte{0xff, 0xff, 0xff, 0xff}, make([]byte, 100)...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := c.CommitStream(context.Background(), bytes.NewReader(stream), bc.DecodeLimits{})
+	runtime.ReadMemStats(&after)
+	if errors.Root(err) != ErrTruncatedBlock {
+		t.Errorf("got error %v, want %v", err, ErrTruncatedBlock)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+		t.Errorf("allocated %d bytes for a truncated block", alloc)
+	}
+}
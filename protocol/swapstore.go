@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"context"
+
+	"github.com/chain/txvm/errors"
+)
+
+// ErrStoreMismatch is returned by SwapStore when the new Store's
+// contents diverge from c's state.
+var ErrStoreMismatch = errors.New("store does not match chain state")
+
+// SwapStore replaces the Store c uses with newStore, for instance to
+// move a running chain to a copy of its store on new hardware.
+//
+// SwapStore waits for any block being committed to c, and blocks
+// further commits until it returns, so each block is saved to the
+// Store that c's state was read from. It checks that newStore's height
+// is c's height, that its block at that height is the one in c's
+// current Store (and, if c has a current snapshot, the one the
+// snapshot's header describes), and that its latest snapshot is
+// consistent with its blocks and no newer than c's height, as
+// EnableStartupVerification does. If not, it returns
+// ErrStoreMismatch, ErrSnapshotMismatch, ErrBadContractsRoot, or
+// ErrBadNoncesRoot, and c keeps its Store. A block missing from c's
+// current Store is reported as ErrPruned.
+//
+// The checks read newStore without holding c's state lock, so
+// readers of c's state are not held up. If c's height changes
+// meanwhile, as when another process commits a block, SwapStore
+// returns ErrStoreMismatch.
+//
+// Otherwise all subsequent reads and writes go to newStore. A
+// snapshot being saved to the old Store is saved again to newStore,
+// and c's saved-snapshot height (see Stats) becomes that of
+// newStore's latest snapshot.
+func (c *Chain) SwapStore(ctx context.Context, newStore Store) error {
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+
+	c.state.cond.L.Lock()
+	height, snapshot, curStore := c.state.height, c.state.snapshot, c.state.store
+	c.state.cond.L.Unlock()
+
+	newHeight, err := newStore.Height(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting new store height")
+	}
+	if newHeight != height {
+		return errors.WithDetailf(ErrStoreMismatch, "new store height %d, chain height %d", newHeight, height)
+	}
+
+	if height > 0 {
+		cur, err := curStore.GetBlock(ctx, height)
+		if err != nil {
+			return errors.Wrapf(err, "getting block %d", height)
+		}
+		if cur == nil {
+			return errors.WithDetailf(ErrPruned, "no block %d in current store", height)
+		}
+		b, err := newStore.GetBlock(ctx, height)
+		if err != nil {
+			return errors.Wrapf(err, "getting block %d from new store", height)
+		}
+		if b == nil {
+			return errors.WithDetailf(ErrStoreMismatch, "no block %d in new store", height)
+		}
+		if b.Hash() != cur.Hash() {
+			return errors.WithDetailf(ErrStoreMismatch, "block %d is %x in new store, %x in current store", height, b.Hash().Bytes(), cur.Hash().Bytes())
+		}
+	}
+
+	if h := snapshot.Height(); h > 0 {
+		b, err := newStore.GetBlock(ctx, h)
+		if err != nil {
+			return errors.Wrapf(err, "getting block %d from new store", h)
+		}
+		if b == nil {
+			return errors.WithDetailf(ErrStoreMismatch, "no block %d in new store", h)
+		}
+		if b.Hash() != snapshot.Header.Hash() {
+			return errors.WithDetailf(ErrStoreMismatch, "block %d is %x in new store, %x in chain state", h, b.Hash().Bytes(), snapshot.Header.Hash().Bytes())
+		}
+	}
+
+	newSnapshot, err := newStore.LatestSnapshot(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting new store latest snapshot")
+	}
+	if newSnapshot != nil && newSnapshot.Height() > height {
+		return errors.WithDetailf(ErrStoreMismatch, "new store snapshot height %d, chain height %d", newSnapshot.Height(), height)
+	}
+	err = verifyLatestSnapshot(ctx, newStore)
+	if err != nil {
+		return err
+	}
+
+	c.state.cond.L.Lock()
+	defer c.state.cond.L.Unlock()
+	if c.state.height != height {
+		return errors.WithDetailf(ErrStoreMismatch, "chain height changed from %d to %d during swap", height, c.state.height)
+	}
+	c.state.store = newStore
+	c.state.storeGen++
+	c.state.savedSnapshotHeight = newSnapshot.Height()
+	c.state.snapshotErr = nil
+
+	// Snapshots saved to the old store don't count for the new one.
+	// A save to the old store that finishes after this sees the new
+	// generation and saves its snapshot again.
+	c.saving.mu.Lock()
+	c.saving.latest = newSnapshot
+	c.saving.gen = c.state.storeGen
+	c.saving.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,279 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/prottest/memstore"
+	"github.com/chain/txvm/protocol/state"
+)
+
+// copyStore returns a MemStore holding c's blocks up to height and
+// the given snapshot.
+func copyStore(t *testing.T, c *Chain, height uint64, snapshot *state.Snapshot) *memstore.MemStore {
+	ctx := context.Background()
+	store := memstore.New()
+	for h := uint64(1); h <= height; h++ {
+		b, err := c.GetBlock(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Blocks[h] = b
+	}
+	store.State = snapshot
+	return store
+}
+
+func TestSwapStore(t *testing.T) {
+	ctx := context.Background()
+
+	c, _ := newTestChain(t, time.Now())
+	makeEmptyBlock(t, c)
+	old := c.getStore().(*memstore.MemStore)
+
+	newStore := copyStore(t, c, c.Height(), c.State())
+	err := c.SwapStore(ctx, newStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	makeEmptyBlock(t, c)
+	if got := len(newStore.Blocks); got != 3 {
+		t.Errorf("new store has %d blocks, want 3", got)
+	}
+	if got := len(old.Blocks); got != 2 {
+		t.Errorf("old store has %d blocks, want 2", got)
+	}
+	b, err := c.GetBlock(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Hash() != newStore.Blocks[3].Hash() {
+		t.Errorf("GetBlock(3) = %x, want %x", b.Hash().Bytes(), newStore.Blocks[3].Hash().Bytes())
+	}
+}
+
+func TestSwapStoreMismatch(t *testing.T) {
+	ctx := context.Background()
+
+	c, _ := newTestChain(t, time.Now())
+	makeEmptyBlock(t, c)
+	good := c.State()
+
+	other, _ := newTestChain(t, time.Now().Add(time.Second))
+	makeEmptyBlock(t, other)
+
+	tampered := state.Copy(good)
+	err := tampered.ContractsTree.Insert(bc.NewHash([32]byte{1}).Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		store   Store
+		wantErr error
+	}{
+		{"short", copyStore(t, c, 1, nil), ErrStoreMismatch},
+		{"other chain", copyStore(t, other, 2, other.State()), ErrStoreMismatch},
+		{"tampered snapshot", copyStore(t, c, 2, tampered), ErrBadContractsRoot},
+		{"pruned", nilBlockStore{copyStore(t, c, 2, good)}, ErrStoreMismatch},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			old := c.getStore()
+			err := c.SwapStore(ctx, tc.store)
+			if errors.Root(err) != tc.wantErr {
+				t.Errorf("SwapStore() error = %v, want %v", err, tc.wantErr)
+			}
+			if c.getStore() != old {
+				t.Error("store replaced after failed SwapStore")
+			}
+		})
+	}
+}
+
+// nilBlockStore reports its blocks as pruned, as a Store may, by
+// returning nil for them without an error.
+type nilBlockStore struct {
+	*memstore.MemStore
+}
+
+func (nilBlockStore) GetBlock(context.Context, uint64) (*bc.Block, error) {
+	return nil, nil
+}
+
+// slowLatestStore blocks reading its latest snapshot until release
+// is closed, after signaling started.
+type slowLatestStore struct {
+	*memstore.MemStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *slowLatestStore) LatestSnapshot(ctx context.Context) (*state.Snapshot, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return s.MemStore.LatestSnapshot(ctx)
+}
+
+func TestSwapStoreReadersProceed(t *testing.T) {
+	ctx := context.Background()
+
+	c, _ := newTestChain(t, time.Now())
+	makeEmptyBlock(t, c)
+	newStore := &slowLatestStore{
+		MemStore: copyStore(t, c, c.Height(), c.State()),
+		started:  make(chan struct{}, 2),
+		release:  make(chan struct{}),
+	}
+
+	swapped := make(chan error)
+	go func() { swapped <- c.SwapStore(ctx, newStore) }()
+	<-newStore.started
+
+	// While SwapStore reads the new store, c's state is readable.
+	read := make(chan uint64)
+	go func() {
+		c.State()
+		c.Stats()
+		read <- c.Height()
+	}()
+	select {
+	case h := <-read:
+		if h != 2 {
+			t.Errorf("Height() = %d, want 2", h)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reading chain state blocked by SwapStore")
+	}
+
+	close(newStore.release)
+	if err := <-swapped; err != nil {
+		t.Fatal(err)
+	}
+	if c.getStore() != Store(newStore) {
+		t.Error("store not replaced")
+	}
+}
+
+// blockingStore blocks saving the block and the snapshot at the given
+// height until release is closed, after signaling started.
+type blockingStore struct {
+	*memstore.MemStore
+	height  uint64
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) SaveBlock(ctx context.Context, b *bc.Block) error {
+	if b.Height == s.height {
+		s.started <- struct{}{}
+		<-s.release
+	}
+	return s.MemStore.SaveBlock(ctx, b)
+}
+
+func (s *blockingStore) SaveSnapshot(ctx context.Context, snapshot *state.Snapshot) error {
+	if snapshot.Height() == s.height {
+		s.started <- struct{}{}
+		<-s.release
+	}
+	return s.MemStore.SaveSnapshot(ctx, snapshot)
+}
+
+func TestSwapStoreWaitsForCommit(t *testing.T) {
+	ctx := context.Background()
+
+	src, b1 := newTestChain(t, time.Now())
+	makeEmptyBlock(t, src)
+	b2, err := src.GetBlock(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := &blockingStore{
+		MemStore: memstore.New(),
+		height:   2,
+		started:  make(chan struct{}, 1),
+		release:  make(chan struct{}),
+	}
+	old.MemStore.Blocks[1] = b1
+	c, err := NewChain(ctx, b1, old, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Recover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newStore := copyStore(t, c, 1, nil)
+
+	committed := make(chan error)
+	go func() { committed <- c.CommitBlock(ctx, b2) }()
+	<-old.started
+
+	swapped := make(chan error)
+	go func() { swapped <- c.SwapStore(ctx, newStore) }()
+	select {
+	case err := <-swapped:
+		t.Fatalf("SwapStore returned %v during a commit", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(old.release)
+	if err := <-committed; err != nil {
+		t.Fatal(err)
+	}
+	// The commit finished first, so newStore is now missing block 2.
+	if err := <-swapped; errors.Root(err) != ErrStoreMismatch {
+		t.Errorf("SwapStore() error = %v, want %v", err, ErrStoreMismatch)
+	}
+	if c.getStore() != Store(old) {
+		t.Error("store replaced after failed SwapStore")
+	}
+}
+
+func TestSwapStorePendingSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src, b1 := newTestChain(t, time.Now())
+	makeEmptyBlock(t, src)
+
+	old := &blockingStore{
+		MemStore: copyStore(t, src, 2, nil),
+		height:   2,
+		started:  make(chan struct{}, 1),
+		release:  make(chan struct{}),
+	}
+	c, err := NewChain(ctx, b1, old, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A snapshot save to the old store is in progress during the
+	// swap, so it is saved again to the new store.
+	c.queueSnapshot(ctx, src.State())
+	<-old.started
+	newStore := copyStore(t, src, 2, nil)
+	err = c.SwapStore(ctx, newStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(old.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Stats().SavedSnapshotHeight != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for snapshot save")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got, _ := newStore.LatestSnapshot(ctx); got.Height() != 2 {
+		t.Errorf("new store snapshot height = %d, want 2", got.Height())
+	}
+}
@@ -1,8 +1,11 @@
 package protocol
 
 import (
+	"context"
+
 	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/state"
 )
 
 // ErrBadTx is returned for transactions failing validation
@@ -29,3 +32,81 @@ func (c *Chain) checkTransactionTime(tx *bc.Tx, blockTimeMS uint64) error {
 	}
 	return nil
 }
+
+// RejectedTx is a transaction left out by ApplyTxs, with the
+// reason.
+type RejectedTx struct {
+	Tx  *bc.Tx
+	Err error
+}
+
+// ApplyTxs finds which of txs can be applied together to snapshot,
+// as for assembling a block. It applies each transaction in turn to
+// a copy of snapshot, keeping those that apply cleanly to the
+// transactions kept before them and rejecting the rest (for
+// instance, double spends, reused nonces, and spends of outputs not
+// yet created). It returns the kept transactions, in order, the
+// rejected ones, with the errors that rejected them, and the state
+// after the kept ones. snapshot is unchanged.
+//
+// ApplyTxs checks only the transactions' effects on the state; it
+// does not check time ranges or runlimits, which depend on the block.
+func ApplyTxs(snapshot *state.Snapshot, txs []*bc.Tx) (applied []*bc.Tx, rejected []RejectedTx, result *state.Snapshot) {
+	result = state.Copy(snapshot)
+	for _, tx := range txs {
+		err := result.ApplyTx(tx)
+		if err != nil {
+			rejected = append(rejected, RejectedTx{Tx: tx, Err: err})
+			continue
+		}
+		applied = append(applied, tx)
+	}
+	return applied, rejected, result
+}
+
+// errTxHeightsDone stops EachBlock at the end of EachTxHeight's range.
+var errTxHeightsDone = errors.New("done")
+
+// EachTxHeight calls fn with the ID of each transaction in the
+// committed blocks from height from (or 1, if from is 0) to height to
+// (or c's height, if to is 0 or above it), with the height of its
+// block, in block order. It is for streaming a transaction index to
+// an external store; see TxHeights.
+//
+// Blocks are read with EachBlock, and EachTxHeight returns the same
+// errors. In particular, it fails with ErrPruned if the Store has
+// discarded a block in the range, so an index of a pruned chain must
+// start above the pruned blocks.
+func (c *Chain) EachTxHeight(ctx context.Context, from, to uint64, fn func(txid bc.Hash, height uint64) error) error {
+	err := c.EachBlock(ctx, from, func(b *bc.Block) error {
+		if to > 0 && b.Height > to {
+			return errTxHeightsDone
+		}
+		for _, tx := range b.Transactions {
+			err := fn(tx.ID, b.Height)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == errTxHeightsDone {
+		err = nil
+	}
+	return err
+}
+
+// TxHeights returns a map from the ID of each transaction in the
+// committed blocks from height from to height to, as for
+// EachTxHeight, to the height of its block.
+func (c *Chain) TxHeights(ctx context.Context, from, to uint64) (map[bc.Hash]uint64, error) {
+	heights := make(map[bc.Hash]uint64)
+	err := c.EachTxHeight(ctx, from, to, func(txid bc.Hash, height uint64) error {
+		heights[txid] = height
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return heights, nil
+}
@@ -2,10 +2,18 @@ package protocol
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/bc/bctest"
+	"github.com/chain/txvm/protocol/prottest/memstore"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/testutil"
 )
 
 func TestBadMaxNonceWindow(t *testing.T) {
@@ -35,3 +43,216 @@ func TestBadMaxNonceWindow(t *testing.T) {
 		t.Error("expected 0 max issuance to be ignored")
 	}
 }
+
+func TestTxHeights(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	b1, err := NewInitialBlock(nil, 0, now)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	store := &prunedStore{Store: memstore.New()}
+	c, err := NewChain(ctx, b1, store, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	c.MaxNonceWindow = 48 * time.Hour
+	st := state.Empty()
+	err = st.ApplyBlock(b1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, b1, st)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	all := make(map[bc.Hash]uint64)
+	for i := 0; i < 4; i++ {
+		var txs []*bc.Tx
+		for j := 0; j <= i%2; j++ {
+			txs = append(txs, bctest.EmptyTx(t, b1.Hash(), now.Add(time.Hour)))
+		}
+		curState := c.State()
+		b, s, err := c.GenerateBlock(ctx, curState, curState.TimestampMS()+1, txs)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = c.CommitAppliedBlock(ctx, b, s)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		for _, tx := range b.Transactions {
+			all[tx.ID] = b.Height
+		}
+	}
+	if len(all) != 6 {
+		t.Fatalf("committed %d transactions, want 6", len(all))
+	}
+
+	subset := func(from, to uint64) map[bc.Hash]uint64 {
+		m := make(map[bc.Hash]uint64)
+		for id, h := range all {
+			if h >= from && h <= to {
+				m[id] = h
+			}
+		}
+		return m
+	}
+	cases := []struct {
+		from, to uint64
+		want     map[bc.Hash]uint64
+	}{
+		{0, 0, all},
+		{1, 5, all},
+		{3, 4, subset(3, 4)},
+		{4, 0, subset(4, 5)},
+		{5, 100, subset(5, 5)},
+		{6, 0, map[bc.Hash]uint64{}},
+	}
+	for _, tc := range cases {
+		got, err := c.TxHeights(ctx, tc.from, tc.to)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("TxHeights(%d, %d) = %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+
+	// Streaming visits transactions in block order and stops at the
+	// first error.
+	var heights []uint64
+	errStop := errors.New("stop")
+	err = c.EachTxHeight(ctx, 0, 0, func(txid bc.Hash, height uint64) error {
+		if all[txid] != height {
+			t.Errorf("tx %x at height %d, want %d", txid.Bytes(), height, all[txid])
+		}
+		heights = append(heights, height)
+		if len(heights) == 4 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Errorf("got error %v, want %v", err, errStop)
+	}
+	if want := []uint64{2, 3, 3, 4}; !reflect.DeepEqual(heights, want) {
+		t.Errorf("heights = %v, want %v", heights, want)
+	}
+
+	// An index of a pruned chain must start above the pruned blocks.
+	store.below = 3
+	_, err = c.TxHeights(ctx, 0, 0)
+	if errors.Root(err) != ErrPruned {
+		t.Errorf("pruned range: got error %v, want %v", err, ErrPruned)
+	}
+	got, err := c.TxHeights(ctx, 3, 0)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if want := subset(3, 5); !reflect.DeepEqual(got, want) {
+		t.Errorf("TxHeights above pruned blocks = %v, want %v", got, want)
+	}
+}
+
+func TestApplyTxs(t *testing.T) {
+	now := time.Now()
+	c, b1 := newTestChain(t, now)
+
+	// spendTx makes a transaction creating an output, distinguished
+	// by tag, and spending inputs.
+	prog := mustAssemble(t, "drop")
+	spendTx := func(tag int, inputs ...bc.Output) *bc.Tx {
+		src := fmt.Sprintf("[%d drop x'%x' %d nonce put] contract call\n", tag, b1.Hash().Bytes(), bc.Millis(now.Add(time.Minute)))
+		src += fmt.Sprintf("[%d x'%x' output] contract call\n", tag, prog)
+		for _, in := range inputs {
+			src += fmt.Sprintf("{'C', x'%x', x'%x', {'Z', %d}} input call\n", in.Seed.Bytes(), in.Program, in.Stack[0].(txvm.Tuple)[1])
+		}
+		src += "get finalize"
+		tx, err := bc.NewTx(mustAssemble(t, src), 3, 10000)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		return tx
+	}
+
+	var (
+		create   = spendTx(1)
+		spend    = spendTx(2, create.Outputs[0])
+		spendToo = spendTx(3, create.Outputs[0]) // conflicts with spend
+		other    = spendTx(4)
+	)
+
+	cases := []struct {
+		name         string
+		txs          []*bc.Tx
+		wantApplied  []*bc.Tx
+		wantRejected []*bc.Tx
+	}{
+		{
+			name:        "none",
+			txs:         nil,
+			wantApplied: nil,
+		},
+		{
+			name:        "non-conflicting",
+			txs:         []*bc.Tx{create, other, spend},
+			wantApplied: []*bc.Tx{create, other, spend},
+		},
+		{
+			name:         "double spend",
+			txs:          []*bc.Tx{create, spend, other, spendToo},
+			wantApplied:  []*bc.Tx{create, spend, other},
+			wantRejected: []*bc.Tx{spendToo},
+		},
+		{
+			name:         "spend before create",
+			txs:          []*bc.Tx{spend, create, spendToo},
+			wantApplied:  []*bc.Tx{create, spendToo},
+			wantRejected: []*bc.Tx{spend},
+		},
+		{
+			name:         "reused nonce",
+			txs:          []*bc.Tx{other, create, other},
+			wantApplied:  []*bc.Tx{other, create},
+			wantRejected: []*bc.Tx{other},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := c.State()
+			beforeRoot := before.ContractsTree.RootHash()
+			applied, rejected, result := ApplyTxs(before, tc.txs)
+			if !reflect.DeepEqual(applied, tc.wantApplied) {
+				t.Errorf("applied %d transactions, want %d", len(applied), len(tc.wantApplied))
+			}
+			if len(rejected) != len(tc.wantRejected) {
+				t.Fatalf("rejected %d transactions, want %d", len(rejected), len(tc.wantRejected))
+			}
+			for i, r := range rejected {
+				if r.Tx != tc.wantRejected[i] {
+					t.Errorf("rejected[%d] is tx %x, want %x", i, r.Tx.ID.Bytes(), tc.wantRejected[i].ID.Bytes())
+				}
+				if r.Err == nil {
+					t.Errorf("rejected[%d] has no error", i)
+				}
+			}
+
+			// The result is the state after the applied transactions.
+			want := state.Copy(before)
+			for _, tx := range tc.wantApplied {
+				err := want.ApplyTx(tx)
+				if err != nil {
+					testutil.FatalErr(t, err)
+				}
+			}
+			if result.ContractsTree.RootHash() != want.ContractsTree.RootHash() || result.NonceTree.RootHash() != want.NonceTree.RootHash() {
+				t.Error("result is not the state after the applied transactions")
+			}
+			if before.ContractsTree.RootHash() != beforeRoot {
+				t.Error("ApplyTxs changed the snapshot")
+			}
+		})
+	}
+}
@@ -15,12 +15,25 @@ func opNonce(vm *VM) {
 	vm.push(a)
 }
 
+func opUniqueToken(vm *VM) {
+	tag := vm.popBytes()
+	tok := UniqueToken(vm.contract.seed, tag)
+	vm.chargeCreate(Bytes(tok[:]))
+	vm.push(Bytes(tok[:]))
+}
+
 func opAnchor(vm *VM) {
 	v := vm.peekValue()
 	vm.chargeCopy(Bytes(v.anchor))
 	vm.push(Bytes(v.anchor))
 }
 
+// UniqueToken computes the token produced by the uniquetoken
+// instruction in a contract with the given seed, for the given tag.
+func UniqueToken(seed, tag []byte) [32]byte {
+	return VMHash("UniqueToken", Encode(Tuple{Bytes(seed), Bytes(tag)}))
+}
+
 // NonceTuple computes a nonce tuple suitable for logging (with
 // vm.log(nonce...)) or hashing (with NonceHash).
 func NonceTuple(callerSeed, selfSeed, blockID []byte, expTimeMS int64) Tuple {
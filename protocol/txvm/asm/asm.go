@@ -138,6 +138,9 @@ func (a *assembler) assembleItems() error {
 				a.buf.Write(preassembled)
 			} else if o, ok := op.Code(a.lit); ok {
 				a.buf.WriteByte(o)
+			} else if code, ok := op.ExtCode(a.lit); ok {
+				writePushint64(&a.buf, code)
+				a.buf.WriteByte(op.Ext)
 			} else {
 				return fmt.Errorf("unknown identifier %q at offset %d", a.lit, a.off)
 			}
@@ -419,6 +422,10 @@ func Disassemble(prog []byte) (string, error) {
 				pushdatas = 1
 			}
 			latestInt64 = nil
+		case opcode == op.Ext && latestInt64 != nil && op.ExtName(*latestInt64) != "":
+			pieces[len(pieces)-1] = op.ExtName(*latestInt64)
+			pushdatas = 0
+			latestInt64 = nil
 		case int(opcode) < op.MinPushdata:
 			pieces = append(pieces, op.Name(opcode))
 			pushdatas = 0
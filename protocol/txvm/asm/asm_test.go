@@ -43,6 +43,47 @@ func TestAssembler(t *testing.T) {
 		{"[1 verify] wrap", []byte{op.MinPushdata + 2, 1, op.Verify, op.Wrap}},
 		{"[1 verify] yield", []byte{op.MinPushdata + 2, 1, op.Verify, op.Yield}},
 		{"[1 verify] output", []byte{op.MinPushdata + 2, 1, op.Verify, op.Output}},
+		// Extended instructions:
+		{"blocktime", []byte{op.BlockTime, op.Ext}},
+		{"checksigph", []byte{op.CheckSigPH, op.Ext}},
+		{"modexp", []byte{op.ModExp, op.Ext}},
+		{"finalized", []byte{op.Finalized, op.Ext}},
+		{"intbytes", []byte{op.IntBytes, op.Ext}},
+		{"merkleverify", []byte{op.MerkleVerify, op.Ext}},
+		{"uniquetoken", []byte{op.UniqueToken, op.Ext}},
+		{"hashtocurve", []byte{op.HashToCurve, op.Ext}},
+		{"typedfield", []byte{op.TypedField, op.Ext}},
+		{"prevblock", []byte{op.PrevBlock, op.Ext}},
+		{"revbytes", []byte{op.RevBytes, op.Ext}},
+		{"splitbytes", []byte{op.SplitBytes, op.Ext}},
+		{"hmacsha256", []byte{op.HMACSHA256, op.Ext}},
+		{"tuplecat", []byte{op.TupleCat, op.Ext}},
+		{"inputindex", []byte{op.InputIndex, op.Ext}},
+		{"txnonce", []byte{op.TxNonce, op.Ext}},
+		{"min", []byte{op.Min, op.Ext}},
+		{"max", []byte{op.Max, op.Ext}},
+		{"all", []byte{op.All, op.Ext}},
+		{"any", []byte{op.Any, op.Ext}},
+		{"checkmultisig", []byte{op.CheckMultisig, op.Ext}},
+		{"hasprefix", []byte{op.HasPrefix, op.Ext}},
+		{"hassuffix", []byte{op.HasSuffix, op.Ext}},
+		{"programhash", []byte{op.ProgramHash, op.Ext}},
+		{"dropif", []byte{op.DropIf, op.Ext}},
+		{"finalanchor", []byte{op.FinalAnchor, op.Ext}},
+		{"bytesint", []byte{op.BytesInt, op.Ext}},
+		{"verifydepth", []byte{op.VerifyDepth, op.Ext}},
+		{"keycommit", []byte{op.KeyCommit, op.Ext}},
+		{"checkaggsig", []byte{op.CheckAggSig, op.Ext}},
+		{"rotl", []byte{op.RotL, op.Ext}},
+		{"rotr", []byte{op.RotR, op.Ext}},
+		{"map", []byte{op.MinPushdata + 1, op.Map, op.Int, op.Ext}},
+		{"inrange", []byte{op.MinPushdata + 1, op.InRange, op.Int, op.Ext}},
+		{"popcount", []byte{op.MinPushdata + 1, op.PopCount, op.Int, op.Ext}},
+		{"isutf8", []byte{op.MinPushdata + 1, op.IsUTF8, op.Int, op.Ext}},
+		{"padl", []byte{op.MinPushdata + 1, op.PadL, op.Int, op.Ext}},
+		{"padr", []byte{op.MinPushdata + 1, op.PadR, op.Int, op.Ext}},
+		{"clear", []byte{op.MinPushdata + 1, op.Clear, op.Int, op.Ext}},
+		{"30 ext", []byte{30, op.Ext}},
 	}
 	for _, c := range cases {
 		got, err := Assemble(c.src)
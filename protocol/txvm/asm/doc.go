@@ -27,6 +27,10 @@ that expand to longer sequences of instructions:
  - ge: swap le (greater than or equal)
  - lt: swap gt (less than)
 
+Extended instructions (see package op) are represented by their names
+as well, and assemble to "x ext" where x is the instruction's code.
+For example, "blocktime" assembles to "0 ext".
+
 Whitespace between tokens in assembler input is insignificant.
 Comments are introduced by # and continue to the end of line.
 
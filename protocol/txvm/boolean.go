@@ -16,3 +16,36 @@ func opOr(vm *VM) {
 	p := vm.popBool()
 	vm.pushBool(p || q)
 }
+
+func opAll(vm *VM) {
+	t := vm.popTuple()
+	vm.charge(int64(len(t)))
+	all := true
+	for _, item := range t {
+		if !isTrue(item) {
+			all = false
+			break
+		}
+	}
+	vm.pushBool(all)
+}
+
+func opAny(vm *VM) {
+	t := vm.popTuple()
+	vm.charge(int64(len(t)))
+	any := false
+	for _, item := range t {
+		if isTrue(item) {
+			any = true
+			break
+		}
+	}
+	vm.pushBool(any)
+}
+
+// isTrue reports whether d is true as a boolean: anything but the
+// int 0.
+func isTrue(d Data) bool {
+	n, ok := d.(Int)
+	return !ok || n != 0
+}
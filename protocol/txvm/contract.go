@@ -1,6 +1,7 @@
 package txvm
 
 import (
+	"crypto/sha256"
 	"fmt"
 
 	"github.com/chain/txvm/errors"
@@ -17,6 +18,10 @@ var (
 
 	// ErrPrv is returned when prv is called.
 	ErrPrv = errorf("prv called")
+
+	// ErrNotInput is returned when inputindex is called from a
+	// contract that was not created by input.
+	ErrNotInput = errorf("current contract is not an input")
 )
 
 func (con *contract) snapshot() (encoded, id Bytes) {
@@ -82,12 +87,22 @@ func opInput(vm *VM) {
 	if err != nil {
 		panic(err)
 	}
+	con.input = true
+	con.inputIndex = vm.inputs
+	vm.inputs++
 	vm.chargeCreate(con)
 	vm.push(con)
 
 	vm.logInput(snapshotID)
 }
 
+func opInputIndex(vm *VM) {
+	if !vm.contract.input {
+		panic(ErrNotInput)
+	}
+	vm.push(Int(vm.contract.inputIndex))
+}
+
 func opYield(vm *VM) {
 	prog := vm.popBytes()
 	vm.contract.program = prog
@@ -111,6 +126,12 @@ func opContractProgram(vm *VM) {
 	vm.push(Bytes(vm.contract.program))
 }
 
+func opProgramHash(vm *VM) {
+	h := sha256.Sum256(vm.contract.program)
+	vm.chargeCreate(Bytes(h[:]))
+	vm.push(Bytes(h[:]))
+}
+
 func opSelf(vm *VM) {
 	vm.chargeCopy(Bytes(vm.contract.seed))
 	vm.push(Bytes(vm.contract.seed))
@@ -145,6 +166,13 @@ func opPut(vm *VM) {
 }
 
 func opExt(vm *VM) {
+	if vm.txVersion >= ExtVersion {
+		if code, ok := vm.peek().(Int); ok && code >= 0 && int64(code) < int64(len(extFuncs)) && extFuncs[code] != nil {
+			vm.pop()
+			extFuncs[code](vm)
+			return
+		}
+	}
 	if !vm.extension {
 		panic(errors.Wrap(ErrExt, "ext"))
 	}
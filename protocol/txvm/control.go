@@ -12,6 +12,16 @@ var (
 	// ErrJump is returned when the jump destination for a jumpif
 	// is not within the bounds of the program.
 	ErrJump = errorf("invalid jump destination")
+
+	// ErrMapResult is returned when the program run by map for an
+	// item of its tuple does not leave exactly one item on the
+	// contract stack.
+	ErrMapResult = errorf("map program must leave one result")
+
+	// ErrMapUnwind is returned when the program run by map executes
+	// output, wrap, or yield, which would end the contract before
+	// map produced its results.
+	ErrMapUnwind = errorf("map program must not unwind contract")
 )
 
 func opVerify(vm *VM) {
@@ -41,3 +51,29 @@ func opExec(vm *VM) {
 	prog := vm.popBytes()
 	vm.exec(prog)
 }
+
+// opMap runs prog once for each item of the tuple, each time on a
+// contract stack holding only that item, so that prog cannot reach
+// the items below the tuple. The contract's own stack is restored
+// after each run.
+func opMap(vm *VM) {
+	prog := vm.popBytes()
+	t := vm.popTuple()
+	vm.charge(int64(len(t)))
+	results := make(Tuple, 0, len(t))
+	below := vm.contract.stack
+	for i, item := range t {
+		vm.contract.stack = stack{item}
+		vm.exec(prog)
+		if vm.unwinding {
+			panic(errors.WithData(ErrMapUnwind, "item", i))
+		}
+		if got := vm.contract.stack.Len(); got != 1 {
+			panic(errors.WithData(ErrMapResult, "item", i, "got", got))
+		}
+		results = append(results, vm.popData())
+		vm.contract.stack = below
+	}
+	vm.chargeCreate(results)
+	vm.push(results)
+}
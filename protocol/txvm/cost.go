@@ -0,0 +1,242 @@
+package txvm
+
+import (
+	"math"
+
+	"github.com/chain/txvm/math/checked"
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+// Runlimit costs shared by the instructions that charge them and by
+// OpcodeCost and ExtOpcodeCost.
+const (
+	entryCost       = 128  // creating a value or contract
+	sigCheckCost    = 2048 // checking one signature
+	aggKeyCost      = 1024 // adding one key to an aggregate public key
+	hashToCurveCost = 2048 // mapping a message to a curve point
+	merkleHashCost  = 64   // computing one hash of a merkle proof
+)
+
+// stringCost is the cost of creating or copying a string of n bytes.
+func stringCost(n int64) (int64, bool) {
+	return checked.AddInt64(1, n)
+}
+
+// tupleCost is the cost of creating or copying a tuple of n items.
+func tupleCost(n int64) (int64, bool) {
+	return checked.AddInt64(1, n)
+}
+
+// modExpCost is the cost of the exponentiation in modexp, with a
+// modulus of modLen bytes and an exponent of expBits bits.
+func modExpCost(modLen, expBits int64) int64 {
+	// The cost of square-and-multiply grows with the number of
+	// exponent bits times the square of the modulus size in words.
+	words := (modLen + 7) / 8
+	if expBits == 0 {
+		expBits = 1
+	}
+	return words * words * expBits
+}
+
+// merkleProofCost is the cost of checking a merkle proof of the given
+// number of steps for a leaf of leafLen bytes.
+func merkleProofCost(leafLen, steps int64) int64 {
+	return leafLen + merkleHashCost*(steps+1)
+}
+
+// OpcodeCost returns the runlimit the VM charges for executing one
+// instruction with the given opcode, including the base cost of 1.
+//
+// For instructions whose cost depends on their operands, operandSize
+// is the size that determines it:
+//
+//   pushdata                          length of the data
+//   roll, bury, reverse               n, the int operand
+//   untuple                           number of items in the tuple
+//   tuple                             number of items in the new tuple
+//   dup, peek, field                  length of the copied string or
+//                                     tuple; negative for an int
+//   peeklog                           number of items in the log entry
+//   assetid, anchor, seed, self,
+//   caller, contractprogram, txid     length of the copied string
+//   encode, cat, slice,
+//   bitnot, bitand, bitor, bitxor     length of the resulting string
+//   output                            length of the encoded snapshot
+//   checksig                          length of the signature
+//
+// For other instructions operandSize is ignored. The cost of exec
+// and call does not include the instructions of the program they run,
+// and the cost of ext does not include that of the extended
+// instruction it selects; see ExtOpcodeCost. The cost of an
+// instruction that fails is not meaningful. A cost too large to
+// represent is reported as math.MaxInt64.
+func OpcodeCost(opcode byte, operandSize int) int64 {
+	n := int64(operandSize)
+	switch {
+	case op.IsSmallIntOp(opcode):
+		return 1
+	case op.IsPushdataOp(opcode):
+		return costSum(1, sat(stringCost(n)))
+	}
+
+	switch opcode {
+	case op.Roll, op.Bury, op.Reverse, op.Untuple:
+		return costSum(1, n)
+	case op.Tuple, op.PeekLog:
+		return costSum(1, sat(tupleCost(n)))
+	case op.Dup, op.Peek, op.Field:
+		return costSum(1, copyCost(n))
+	case op.AssetID, op.Anchor, op.Seed, op.Self, op.Caller, op.ContractProgram, op.TxID:
+		return costSum(1, sat(stringCost(n)))
+	case op.Encode, op.Cat, op.Slice, op.BitNot, op.BitAnd, op.BitOr, op.BitXor:
+		return costSum(1, sat(stringCost(n)))
+	case op.VMHash, op.SHA256, op.SHA3:
+		return costSum(1, sat(stringCost(32)))
+	case op.CheckSig:
+		if n == 0 {
+			return 1
+		}
+		return 1 + sigCheckCost
+	case op.Nonce:
+		// A nonce log entry, a timerange log entry, and a value.
+		return costSum(1, sat(tupleCost(5)), sat(tupleCost(4)), entryCost)
+	case op.Merge:
+		return 1 + entryCost
+	case op.Split:
+		return 1 + 2*entryCost
+	case op.Issue:
+		return costSum(1, entryCost, sat(tupleCost(5)))
+	case op.Retire:
+		return costSum(1, sat(tupleCost(5)))
+	case op.Log:
+		return costSum(1, sat(tupleCost(3)))
+	case op.Input:
+		return costSum(1, entryCost, sat(tupleCost(3)))
+	case op.TimeRange, op.Finalize:
+		return costSum(1, sat(tupleCost(4)))
+	case op.Output:
+		return costSum(1, sat(stringCost(n)), sat(tupleCost(3)))
+	case op.Contract:
+		return 1 + entryCost
+	}
+	return 1
+}
+
+// ExtOpcodeCost returns the runlimit the VM charges for executing an
+// ext instruction that selects the extended instruction with the
+// given code, including the base cost of 1 of the ext instruction
+// itself but not the cost of pushing code.
+//
+// For extended instructions whose cost depends on their operands,
+// operandSizes are the sizes that determine it, in this order:
+//
+//   checksigph                    length of the signature
+//   modexp                        length of the modulus, and bit
+//                                 length of the exponent
+//   intbytes                      width
+//   merkleverify                  length of the leaf, and number of
+//                                 proof steps
+//   hashtocurve                   length of the message
+//   typedfield                    as for field
+//   revbytes, rotl, rotr          length of the string
+//   splitbytes                    length of the string being split
+//   hmacsha256                    total length of key and message
+//   keycommit                     total length of key and value
+//   tuplecat                      number of items in the new tuple
+//   all, any, map                 number of items in the tuple
+//   checkmultisig                 number of non-empty signatures
+//   hasprefix, hassuffix          length of the prefix or suffix
+//   checkaggsig                   number of public keys, and length
+//                                 of the signature
+//   isutf8                        length of the string
+//   padl, padr                    length of the resulting string
+//   clear                         number of items on the stack
+//
+// Missing operand sizes are taken to be 0, and others are ignored.
+// The cost of map does not include the instructions of the program it
+// runs. The cost of an unassigned code, which executes only when
+// extensions are enabled, is 1.
+func ExtOpcodeCost(code int64, operandSizes ...int) int64 {
+	var m, n int64
+	if len(operandSizes) > 0 {
+		n = int64(operandSizes[0])
+	}
+	if len(operandSizes) > 1 {
+		m = int64(operandSizes[1])
+	}
+
+	switch code {
+	case op.CheckSigPH:
+		if n == 0 {
+			return 1
+		}
+		return 1 + sigCheckCost
+	case op.ModExp:
+		return costSum(1, modExpCost(n, m), sat(stringCost(n)))
+	case op.IntBytes, op.RevBytes, op.RotL, op.RotR, op.PadL, op.PadR:
+		return costSum(1, sat(stringCost(n)))
+	case op.MerkleVerify:
+		return costSum(1, merkleProofCost(n, m))
+	case op.UniqueToken, op.TxNonce, op.ProgramHash, op.FinalAnchor:
+		return costSum(1, sat(stringCost(32)))
+	case op.HashToCurve:
+		return costSum(1, hashToCurveCost, n, sat(stringCost(32)))
+	case op.TypedField:
+		return costSum(1, copyCost(n))
+	case op.PrevBlock:
+		return costSum(1, sat(tupleCost(3)))
+	case op.SplitBytes:
+		// The head and tail together cost as much as a copy of the
+		// whole string and an empty string.
+		return costSum(1, sat(stringCost(n)), sat(stringCost(0)))
+	case op.HMACSHA256, op.KeyCommit:
+		return costSum(1, n, sat(stringCost(32)))
+	case op.TupleCat:
+		return costSum(1, sat(tupleCost(n)))
+	case op.All, op.Any, op.HasPrefix, op.HasSuffix, op.IsUTF8, op.Clear:
+		return costSum(1, n)
+	case op.Map:
+		return costSum(1, n, sat(tupleCost(n)))
+	case op.CheckMultisig:
+		cost, ok := checked.MulInt64(sigCheckCost, n)
+		return costSum(1, sat(cost, ok))
+	case op.CheckAggSig:
+		if m == 0 {
+			return 1
+		}
+		cost, ok := checked.MulInt64(aggKeyCost, n)
+		return costSum(1, sigCheckCost, sat(cost, ok))
+	}
+	return 1
+}
+
+// copyCost is the cost of copying a string or tuple of n bytes or
+// items, or an int if n is negative.
+func copyCost(n int64) int64 {
+	if n < 0 {
+		return 0
+	}
+	return sat(stringCost(n)) // the same as tupleCost(n)
+}
+
+// sat returns cost, or math.MaxInt64 if computing it overflowed.
+func sat(cost int64, ok bool) int64 {
+	if !ok {
+		return math.MaxInt64
+	}
+	return cost
+}
+
+// costSum returns the sum of costs, or math.MaxInt64 if it overflows.
+func costSum(costs ...int64) int64 {
+	var sum int64
+	for _, c := range costs {
+		var ok bool
+		sum, ok = checked.AddInt64(sum, c)
+		if !ok {
+			return math.MaxInt64
+		}
+	}
+	return sum
+}
@@ -0,0 +1,325 @@
+package txvm_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/asm"
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+// costCheck is an instruction whose runlimit charge TestOpcodeCost
+// compares with OpcodeCost or ExtOpcodeCost.
+type costCheck struct {
+	opcode byte
+	ext    int64 // the extended instruction's code, if opcode is op.Ext
+	sizes  []int
+}
+
+func opCost(opcode byte, size int) costCheck {
+	return costCheck{opcode: opcode, ext: -1, sizes: []int{size}}
+}
+
+func extCost(code int64, sizes ...int) costCheck {
+	return costCheck{opcode: op.Ext, ext: code, sizes: sizes}
+}
+
+func (c costCheck) want() int64 {
+	if c.opcode == op.Ext {
+		return txvm.ExtOpcodeCost(c.ext, c.sizes...)
+	}
+	return txvm.OpcodeCost(c.opcode, c.sizes[0])
+}
+
+func (c costCheck) String() string {
+	if c.opcode == op.Ext {
+		return fmt.Sprintf("ext %s with operand sizes %v", op.ExtName(c.ext), c.sizes)
+	}
+	return fmt.Sprintf("opcode %02x with operand size %d", c.opcode, c.sizes[0])
+}
+
+func TestOpcodeCost(t *testing.T) {
+	const msg = "msg"
+	pub, prv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub2, prv2, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := ed25519.Sign(prv, []byte(msg))
+	aggPubs := []ed25519.PublicKey{pub, pub2}
+	aggSig := aggSign(t, aggPubs, []ed25519.PrivateKey{prv, prv2}, []byte(msg))
+
+	wrapProg := mustAssemble(t, "caller drop contractprogram drop [] yield")
+	outputSeed := txvm.ContractSeed(mustAssemble(t, "[] output"))
+	outputSnapshot := txvm.Encode(txvm.Tuple{txvm.Bytes{txvm.ContractCode}, txvm.Bytes(outputSeed[:]), txvm.Bytes{}})
+	encoded := txvm.Encode(txvm.Bytes("dec"))
+
+	cases := []struct {
+		name   string
+		src    string
+		opts   []txvm.Option
+		checks []costCheck
+	}{
+		{
+			name:   "small int and pushdata",
+			src:    "0 verifydepth 7 'abcde' drop drop",
+			checks: []costCheck{opCost(7, 0), opCost(op.MinPushdata, 5), opCost(op.Drop, 0), extCost(op.VerifyDepth)},
+		},
+		{
+			name: "stack",
+			src:  "1 2 3 2 roll 1 bury 3 reverse put depth drop get drop drop drop",
+			checks: []costCheck{
+				opCost(op.Roll, 2), opCost(op.Bury, 1), opCost(op.Reverse, 3),
+				opCost(op.Put, 0), opCost(op.Depth, 0), opCost(op.Get, 0),
+			},
+		},
+		{
+			name: "ints and booleans",
+			src: `x'05' int 2 add neg 3 mul 2 div 3 mod 1 gt drop
+				0 not 1 and 0 or verify
+				'ab' len 2 eq verify
+				1 2 min 1 2 max drop drop
+				2 1 3 inrange drop 7 popcount drop
+				x'0102' bytesint drop 5 2 intbytes drop
+				{1, 1} all drop {0, 1} any drop
+				1 0 dropif 1 0 jumpif drop`,
+			checks: []costCheck{
+				opCost(op.Int, 0), opCost(op.Add, 0), opCost(op.Neg, 0), opCost(op.Mul, 0),
+				opCost(op.Div, 0), opCost(op.Mod, 0), opCost(op.GT, 0), opCost(op.Not, 0),
+				opCost(op.And, 0), opCost(op.Or, 0), opCost(op.Verify, 0), opCost(op.Len, 0),
+				opCost(op.Eq, 0), opCost(op.JumpIf, 0),
+				extCost(op.Min), extCost(op.Max), extCost(op.InRange), extCost(op.PopCount),
+				extCost(op.BytesInt), extCost(op.IntBytes, 2),
+				extCost(op.All, 2), extCost(op.Any, 2), extCost(op.DropIf),
+			},
+		},
+		{
+			name: "tuples",
+			src: `'ab' 'c' 9 3 tuple dup 0 field drop untuple drop drop drop drop
+				{'ab'} 0 x'53' typedfield drop
+				{1} {2, 3} tuplecat drop
+				{1, 2} [1 add] map drop`,
+			checks: []costCheck{
+				opCost(op.Tuple, 3), opCost(op.Dup, 3), opCost(op.Field, 2), opCost(op.Untuple, 3),
+				extCost(op.TypedField, 2), extCost(op.TupleCat, 3), extCost(op.Map, 2),
+			},
+		},
+		{
+			name:   "dup and peek",
+			src:    "7 dup 'abc' 1 peek drop drop drop drop",
+			checks: []costCheck{opCost(op.Dup, -1), opCost(op.Peek, -1)},
+		},
+		{
+			name: "strings",
+			src: `'ab' 'cde' cat 1 4 slice encode bitnot drop
+				'ab' 'cd' bitand 'ef' bitor 'gh' bitxor drop
+				'abc' revbytes 1 rotl 1 rotr drop
+				'abcd' 1 splitbytes drop drop
+				'abc' 'ab' hasprefix drop 'abc' 'c' hassuffix drop
+				'abc' isutf8 drop
+				'ab' 4 0 padl 5 0 padr drop`,
+			checks: []costCheck{
+				opCost(op.Cat, 5), opCost(op.Slice, 3), opCost(op.Encode, len(encoded)), opCost(op.BitNot, len(encoded)),
+				opCost(op.BitAnd, 2), opCost(op.BitOr, 2), opCost(op.BitXor, 2),
+				extCost(op.RevBytes, 3), extCost(op.RotL, 3), extCost(op.RotR, 3),
+				extCost(op.SplitBytes, 4), extCost(op.HasPrefix, 2), extCost(op.HasSuffix, 1),
+				extCost(op.IsUTF8, 3), extCost(op.PadL, 4), extCost(op.PadR, 5),
+			},
+		},
+		{
+			name: "hashes",
+			src: `'x' sha256 sha3 'f' vmhash drop
+				'key' 'msg' hmacsha256 drop 'key' 'value' keycommit drop
+				'abc' ` + h2cDST + ` hashtocurve drop
+				x'01' ` + merkleSrc([][]byte{{1}, {2}, {3}, {4}}, 0) + ` merkleverify
+				x'02' x'03' x'07' modexp drop`,
+			checks: []costCheck{
+				opCost(op.SHA256, 0), opCost(op.SHA3, 0), opCost(op.VMHash, 0),
+				extCost(op.HMACSHA256, 6), extCost(op.KeyCommit, 8), extCost(op.HashToCurve, 3),
+				extCost(op.MerkleVerify, 1, 2), extCost(op.ModExp, 1, 2),
+			},
+		},
+		{
+			name: "signatures",
+			src: fmt.Sprintf(`'%[1]s' x'%[2]x' x'%[3]x' 0 checksig drop
+				'%[1]s' {x'%[3]x'} {x'%[2]x'} 1 checkmultisig
+				'%[1]s' {x'%[2]x', x'%[4]x'} x'%[5]x' checkaggsig drop
+				%[6]s %[7]s %[8]s checksigph drop`,
+				msg, pub, sig, pub2, aggSig, phPrehash, phPubkey, phSig),
+			checks: []costCheck{
+				opCost(op.CheckSig, 64), extCost(op.CheckMultisig, 1),
+				extCost(op.CheckAggSig, 2, 64), extCost(op.CheckSigPH, 64),
+			},
+		},
+		{
+			name: "empty signatures",
+			src: fmt.Sprintf(`'%[1]s' 'pubkey' '' 0 checksig drop
+				'%[1]s' {x'%[2]x'} '' checkaggsig drop
+				%[3]s %[4]s '' checksigph drop`,
+				msg, pub, phPrehash, phPubkey),
+			checks: []costCheck{
+				opCost(op.CheckSig, 0), extCost(op.CheckAggSig, 1, 0), extCost(op.CheckSigPH, 0),
+			},
+		},
+		{
+			name: "values and log",
+			src: `x'0000000000000000000000000000000000000000000000000000000000000000' 100 nonce
+				0 split 5 'tag' issue
+				amount drop assetid drop anchor drop
+				2 split merge retire
+				self drop
+				'data' log
+				0 peeklog drop
+				0 100 timerange
+				[] contract call
+				finalized drop
+				finalize
+				txid drop txnonce drop finalanchor drop`,
+			checks: []costCheck{
+				opCost(op.Nonce, 0),
+				opCost(op.Split, 0),
+				opCost(op.Issue, 0),
+				opCost(op.Amount, 0),
+				opCost(op.AssetID, 32),
+				opCost(op.Anchor, 32),
+				opCost(op.Merge, 0),
+				opCost(op.Retire, 0),
+				opCost(op.Self, 32),
+				opCost(op.Log, 0),
+				opCost(op.PeekLog, 5),
+				opCost(op.TimeRange, 0),
+				opCost(op.Contract, 0),
+				opCost(op.Call, 0),
+				opCost(op.Finalize, 0),
+				opCost(op.TxID, 32),
+				extCost(op.Finalized),
+				extCost(op.TxNonce),
+				extCost(op.FinalAnchor),
+			},
+		},
+		{
+			name: "contracts",
+			src: fmt.Sprintf(`x'%x' contract seed drop call get call
+				[[] wrap] contract call get call
+				[] contract call
+				[1 drop] exec
+				programhash drop 'tag' uniquetoken drop
+				{'C', x'%s', [inputindex drop]} input call
+				[[] output] contract call`, wrapProg, inputSeed),
+			checks: []costCheck{
+				opCost(op.Seed, 32), opCost(op.Caller, 32), opCost(op.ContractProgram, len(wrapProg)),
+				opCost(op.Yield, 0), opCost(op.Wrap, 0), opCost(op.Exec, 0), opCost(op.Input, 0),
+				opCost(op.Output, len(outputSnapshot)),
+				extCost(op.ProgramHash), extCost(op.UniqueToken), extCost(op.InputIndex),
+			},
+		},
+		{
+			name:   "block",
+			src:    "blocktime prevblock drop drop",
+			opts:   []txvm.Option{txvm.BlockTime(5), txvm.PrevBlock(1, 4, make([]byte, 32))},
+			checks: []costCheck{extCost(op.BlockTime), extCost(op.PrevBlock)},
+		},
+		{
+			name:   "clear",
+			src:    "1 'ab' {3} clear",
+			checks: []costCheck{extCost(op.Clear, 3)},
+		},
+		{
+			name:   "unassigned ext",
+			src:    "200 ext",
+			opts:   []txvm.Option{txvm.EnableExtension},
+			checks: []costCheck{extCost(200)},
+		},
+	}
+
+	type key struct {
+		opcode byte
+		ext    int64
+	}
+	type frame struct {
+		key            key
+		before, nested int64
+	}
+	checked := make(map[key]bool)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			prog := mustAssemble(t, c.src)
+
+			// The cost of the first execution of each instruction,
+			// not counting that of any instructions it runs.
+			got := make(map[key]int64)
+			var frames []frame
+			opts := append([]txvm.Option{
+				txvm.BeforeStep(func(vm *txvm.VM) {
+					k := key{opcode: vm.OpCode(), ext: -1}
+					if k.opcode == op.Ext {
+						// StackItem returns the inspected form of
+						// the code, {'Z', code}.
+						top := vm.StackItem(vm.StackLen() - 1).(txvm.Tuple)
+						if code, ok := top[1].(txvm.Int); ok {
+							k.ext = int64(code)
+						}
+					}
+					frames = append(frames, frame{key: k, before: vm.Runlimit()})
+				}),
+				txvm.AfterStep(func(vm *txvm.VM) {
+					f := frames[len(frames)-1]
+					frames = frames[:len(frames)-1]
+					total := f.before - vm.Runlimit()
+					if len(frames) > 0 {
+						frames[len(frames)-1].nested += total
+					}
+					if _, ok := got[f.key]; !ok {
+						got[f.key] = total - f.nested
+					}
+				}),
+			}, c.opts...)
+			_, err := txvm.Validate(prog, txvm.ExtVersion, 100000, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, ch := range c.checks {
+				k := key{ch.opcode, ch.ext}
+				checked[k] = true
+				cost, ok := got[k]
+				if !ok {
+					t.Errorf("%s not executed", ch)
+					continue
+				}
+				if want := ch.want(); cost != want {
+					t.Errorf("%s: VM charged %d, want %d", ch, cost, want)
+				}
+			}
+		})
+	}
+
+	// Every instruction that can succeed is checked.
+	for i := 0; i < 256; i++ {
+		opcode := byte(i)
+		if op.IsSmallIntOp(opcode) || op.IsPushdataOp(opcode) || opcode == op.Prv || op.Name(opcode) == "" {
+			continue
+		}
+		if !checked[key{opcode, -1}] && opcode != op.Ext {
+			t.Errorf("opcode %s not checked", op.Name(opcode))
+		}
+	}
+	for code := int64(0); code < 256; code++ {
+		if op.ExtName(code) != "" && !checked[key{op.Ext, code}] {
+			t.Errorf("extended instruction %s not checked", op.ExtName(code))
+		}
+	}
+}
+
+func mustAssemble(t *testing.T, src string) []byte {
+	prog, err := asm.Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog
+}
@@ -1,11 +1,16 @@
 package txvm
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
 
 	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/crypto/ed25519/ecmath"
 	"github.com/chain/txvm/crypto/sha3"
 	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/merkle"
 )
 
 var (
@@ -20,6 +25,30 @@ var (
 	// ErrSignature is returned when checksig is called with a
 	// non-empty signature that fails the check.
 	ErrSignature = errorf("invalid non-empty signature")
+
+	// ErrPrehashSize is returned when checksigph is called with a
+	// prehash whose length is not that of a SHA-512 digest.
+	ErrPrehashSize = errorf("bad prehash length")
+
+	// ErrMerkleProof is returned when merkleverify is called with a
+	// proof that does not show inclusion of the leaf under the root.
+	ErrMerkleProof = errorf("merkle proof fail")
+
+	// ErrDSTSize is returned when hashtocurve is called with a
+	// domain separation tag that is empty or longer than 255 bytes.
+	ErrDSTSize = errorf("bad domain separation tag length")
+
+	// ErrQuorum is returned when checkmultisig is called with fewer
+	// non-empty signatures than its quorum.
+	ErrQuorum = errorf("too few signatures for quorum")
+
+	// ErrDupPubkey is returned when checkmultisig is called with a
+	// public key that appears more than once.
+	ErrDupPubkey = errorf("duplicate public key")
+
+	// ErrPubkey is returned when checkaggsig is called with a public
+	// key that does not encode a point on the curve.
+	ErrPubkey = errorf("invalid public key")
 )
 
 func opVMHash(vm *VM) {
@@ -39,6 +68,42 @@ func opSHA256(vm *VM) {
 	vm.push(h)
 }
 
+func opHMACSHA256(vm *VM) {
+	msg := vm.popBytes()
+	key := vm.popBytes()
+	vm.charge(int64(len(key) + len(msg)))
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg)
+	h := Bytes(mac.Sum(nil))
+	vm.chargeCreate(h)
+	vm.push(h)
+}
+
+func opKeyCommit(vm *VM) {
+	value := vm.popBytes()
+	key := vm.popBytes()
+	vm.charge(int64(len(key) + len(value)))
+	h := KeyCommitment(key, value)
+	vm.chargeCreate(Bytes(h[:]))
+	vm.push(Bytes(h[:]))
+}
+
+// KeyCommitment computes the value produced by the keycommit
+// instruction: the SHA-256 hash of key and value, each preceded by
+// its length as a uvarint, so that no two distinct pairs hash the
+// same input.
+func KeyCommitment(key, value []byte) [32]byte {
+	var buf [binary.MaxVarintLen64]byte
+	hasher := sha256.New()
+	hasher.Write(buf[:binary.PutUvarint(buf[:], uint64(len(key)))])
+	hasher.Write(key)
+	hasher.Write(buf[:binary.PutUvarint(buf[:], uint64(len(value)))])
+	hasher.Write(value)
+	var h [32]byte
+	hasher.Sum(h[:0])
+	return h
+}
+
 func opSHA3(vm *VM) {
 	a := vm.popBytes()
 	h := sha3.Sum256(a)
@@ -46,6 +111,53 @@ func opSHA3(vm *VM) {
 	vm.push(Bytes(h[:]))
 }
 
+func opMerkleVerify(vm *VM) {
+	root := vm.popBytes()
+	proof := vm.popTuple()
+	leaf := vm.popBytes()
+	if len(root) != 32 {
+		panic(errors.WithData(ErrFields, "root length", len(root)))
+	}
+	steps := make([]merkle.ProofStep, 0, len(proof))
+	for i, item := range proof {
+		t, ok := item.(Tuple)
+		if !ok || len(t) != 2 {
+			panic(errors.WithData(ErrFields, "proof step", i))
+		}
+		h, ok := t[0].(Bytes)
+		if !ok || len(h) != 32 {
+			panic(errors.WithData(ErrFields, "proof step", i))
+		}
+		left, ok := t[1].(Int)
+		if !ok {
+			panic(errors.WithData(ErrFields, "proof step", i))
+		}
+		step := merkle.ProofStep{Left: left != 0}
+		copy(step.Hash[:], h)
+		steps = append(steps, step)
+	}
+	vm.charge(merkleProofCost(int64(len(leaf)), int64(len(steps))))
+
+	var want [32]byte
+	copy(want[:], root)
+	if !merkle.VerifyProof(leaf, steps, want) {
+		panic(ErrMerkleProof)
+	}
+}
+
+func opHashToCurve(vm *VM) {
+	dst := vm.popBytes()
+	msg := vm.popBytes()
+	vm.charge(hashToCurveCost + int64(len(msg)))
+	p, err := ecmath.HashToCurve(msg, dst)
+	if err != nil {
+		panic(errors.WithData(ErrDSTSize, "got", len(dst)))
+	}
+	e := p.Encode()
+	vm.chargeCreate(Bytes(e[:]))
+	vm.push(Bytes(e[:]))
+}
+
 func opCheckSig(vm *VM) {
 	scheme := vm.popData() // for future expansion we allow arbitrary data types here, not just ints
 	sig := vm.popBytes()
@@ -59,7 +171,7 @@ func opCheckSig(vm *VM) {
 		vm.pushBool(false)
 		return
 	}
-	vm.charge(2048)
+	vm.charge(sigCheckCost)
 	// Ed25519 signatures have scheme Int(0).
 	if schemeint, ok := scheme.(Int); ok && schemeint == 0 {
 		checkEd25519(msg, pubkey, sig)
@@ -71,6 +183,138 @@ func opCheckSig(vm *VM) {
 	vm.pushBool(true)
 }
 
+func opCheckMultisig(vm *VM) {
+	quorum := vm.popInt()
+	pubkeys := vm.popTuple()
+	sigs := vm.popTuple()
+	msg := vm.popBytes()
+	if quorum < 1 || quorum > Int(len(pubkeys)) {
+		panic(errors.WithData(ErrRange, "quorum", quorum, "pubkeys", len(pubkeys)))
+	}
+	if len(sigs) != len(pubkeys) {
+		panic(errors.WithData(ErrFields, "signatures", len(sigs), "pubkeys", len(pubkeys)))
+	}
+	seen := make(map[string]bool, len(pubkeys))
+	for i, item := range pubkeys {
+		pubkey, ok := item.(Bytes)
+		if !ok {
+			panic(errors.WithData(ErrType, "pubkey", i, "want", "Bytes"))
+		}
+		if seen[string(pubkey)] {
+			panic(errors.WithData(ErrDupPubkey, "pubkey", []byte(pubkey)))
+		}
+		seen[string(pubkey)] = true
+	}
+
+	// Each signature is by the pubkey at the same position, so a key
+	// counts toward the quorum at most once. As with checksig, a
+	// non-empty signature must be valid. Signatures are checked one at
+	// a time rather than in a randomized batch: a batch check uses the
+	// cofactored equation, which accepts some signatures that
+	// ed25519.Verify rejects, and so would not agree with checksig.
+	var n Int
+	for i, item := range sigs {
+		sig, ok := item.(Bytes)
+		if !ok {
+			panic(errors.WithData(ErrType, "signature", i, "want", "Bytes"))
+		}
+		if len(sig) == 0 {
+			continue
+		}
+		vm.charge(sigCheckCost)
+		checkEd25519(msg, pubkeys[i].(Bytes), sig)
+		n++
+	}
+	if n < quorum {
+		panic(errors.WithData(ErrQuorum, "signatures", n, "quorum", quorum))
+	}
+}
+
+func opCheckAggSig(vm *VM) {
+	sig := vm.popBytes()
+	pubkeys := vm.popTuple()
+	msg := vm.popBytes()
+	if len(pubkeys) == 0 {
+		panic(errors.WithData(ErrFields, "pubkeys", 0))
+	}
+	keys := make([]ed25519.PublicKey, 0, len(pubkeys))
+	for i, item := range pubkeys {
+		pubkey, ok := item.(Bytes)
+		if !ok {
+			panic(errors.WithData(ErrType, "pubkey", i, "want", "Bytes"))
+		}
+		keys = append(keys, ed25519.PublicKey(pubkey))
+	}
+	// As with checksig, only an empty signature can return false.
+	if len(sig) == 0 {
+		vm.pushBool(false)
+		return
+	}
+	vm.charge(sigCheckCost + aggKeyCost*int64(len(keys)))
+	agg, _, err := AggregatePubkey(keys)
+	if err != nil {
+		panic(err)
+	}
+	checkEd25519(msg, Bytes(agg), sig)
+	vm.pushBool(true)
+}
+
+// AggregatePubkey computes the aggregate public key that the
+// checkaggsig instruction verifies a signature against, and the
+// coefficient of each of pubkeys in it. Each pubkey P_i has the
+// coefficient a_i = SHA-512(L || P_i), reduced mod the curve order,
+// where L = VMHash("AggPubkey", P_1 || ... || P_n), and the aggregate
+// key is the sum of the a_i·P_i.
+//
+// The aggregate depends on the order of pubkeys. It is an error for
+// pubkeys to be empty or to contain the same key twice.
+//
+// To make a signature valid under the aggregate, each signer i with
+// private scalar x_i picks a secret nonce r_i; the signers sum their
+// points R = Σ r_i·B, compute c = SHA-512(R || aggregate || msg)
+// reduced mod the curve order, and sum their responses
+// s = Σ (r_i + c·a_i·x_i). The signature is R || s, an ordinary
+// Ed25519 signature under the aggregate key.
+func AggregatePubkey(pubkeys []ed25519.PublicKey) (ed25519.PublicKey, []ecmath.Scalar, error) {
+	if len(pubkeys) == 0 {
+		return nil, nil, errors.WithData(ErrFields, "pubkeys", 0)
+	}
+	var all []byte
+	seen := make(map[string]bool, len(pubkeys))
+	for _, pubkey := range pubkeys {
+		if len(pubkey) != ed25519.PublicKeySize {
+			return nil, nil, errors.WithData(ErrPubSize, "got", len(pubkey), "want", ed25519.PublicKeySize)
+		}
+		if seen[string(pubkey)] {
+			return nil, nil, errors.WithData(ErrDupPubkey, "pubkey", []byte(pubkey))
+		}
+		seen[string(pubkey)] = true
+		all = append(all, pubkey...)
+	}
+	l := VMHash("AggPubkey", all)
+
+	coeffs := make([]ecmath.Scalar, len(pubkeys))
+	sum := ecmath.ZeroPoint
+	for i, pubkey := range pubkeys {
+		var enc [32]byte
+		copy(enc[:], pubkey)
+		var p ecmath.Point
+		if _, ok := p.Decode(enc); !ok {
+			return nil, nil, errors.WithData(ErrPubkey, "pubkey", []byte(pubkey))
+		}
+		var h [64]byte
+		hasher := sha512.New()
+		hasher.Write(l[:])
+		hasher.Write(pubkey)
+		hasher.Sum(h[:0])
+		coeffs[i].Reduce(&h)
+		p.ScMul(&p, &coeffs[i])
+		sum.Add(&sum, &p)
+	}
+	agg := sum.Encode()
+	return ed25519.PublicKey(agg[:]), coeffs, nil
+}
+
 func checkEd25519(msg, pubkey, sig Bytes) {
 	if len(sig) != ed25519.SignatureSize {
 		panic(errors.WithData(ErrSigSize, "got", len(sig), "want", ed25519.SignatureSize))
@@ -84,6 +328,31 @@ func checkEd25519(msg, pubkey, sig Bytes) {
 	}
 }
 
+func opCheckSigPH(vm *VM) {
+	sig := vm.popBytes()
+	pubkey := vm.popBytes()
+	prehash := vm.popBytes()
+	// As with checksig, only an empty signature can return false.
+	if len(sig) == 0 {
+		vm.pushBool(false)
+		return
+	}
+	vm.charge(sigCheckCost)
+	if len(sig) != ed25519.SignatureSize {
+		panic(errors.WithData(ErrSigSize, "got", len(sig), "want", ed25519.SignatureSize))
+	}
+	if len(pubkey) != ed25519.PublicKeySize {
+		panic(errors.WithData(ErrPubSize, "got", len(pubkey), "want", ed25519.PublicKeySize))
+	}
+	if len(prehash) != sha512.Size {
+		panic(errors.WithData(ErrPrehashSize, "got", len(prehash), "want", sha512.Size))
+	}
+	if !ed25519.VerifyPrehashed(ed25519.PublicKey(pubkey), prehash, sig) {
+		panic(errors.WithData(ErrSignature, "signature", []byte(sig), "prehash", []byte(prehash), "public key", []byte(pubkey)))
+	}
+	vm.pushBool(true)
+}
+
 // VMHash computes the hash of the "function" f applied to the byte string x.
 func VMHash(f string, x []byte) (hash [32]byte) {
 	sha3.CShakeSum128(hash[:], x, nil, []byte("ChainVM."+f))
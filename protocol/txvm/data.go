@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
 
 	"github.com/chain/txvm/errors"
 )
@@ -28,6 +29,29 @@ func opDrop(vm *VM) {
 	}
 }
 
+// opClear drops every item on the current contract's stack, as if by
+// repeated drop. The argument stack and other contracts' stacks are
+// unaffected.
+func opClear(vm *VM) {
+	n := vm.contract.stack.Len()
+	vm.charge(int64(n))
+	for i := 0; i < n; i++ {
+		opDrop(vm)
+	}
+}
+
+func opDropIf(vm *VM) {
+	cond := vm.popBool()
+	item := vm.peek()
+	if !cond {
+		return
+	}
+	if !item.isDroppable() {
+		panic(errors.WithData(ErrType, "want", "Data, zero Value", "got", fmt.Sprintf("%T", item)))
+	}
+	vm.pop()
+}
+
 func opEq(vm *VM) {
 	v1 := vm.popData()
 	v2 := vm.popData()
@@ -94,6 +118,33 @@ func opField(vm *VM) {
 	vm.push(t[n])
 }
 
+func opTypedField(vm *VM) {
+	code := vm.popBytes()
+	n := int64(vm.popInt())
+	t := vm.popTuple()
+	if len(code) != 1 || (code[0] != IntCode && code[0] != BytesCode && code[0] != TupleCode) {
+		panic(errors.WithData(ErrRange, "type code", []byte(code)))
+	}
+	if n < 0 || n >= int64(len(t)) {
+		panic(errors.Wrapf(errors.WithData(ErrRange, "len(tuple)", len(t)), "field %d", n))
+	}
+	if got := extractTypeCode(t[n].inspect()); got != code[0] {
+		panic(errors.Wrapf(errors.WithData(ErrType, "want", string(code), "got", string(got)), "field %d", n))
+	}
+	vm.chargeCopy(t[n])
+	vm.push(t[n])
+}
+
+func opTupleCat(vm *VM) {
+	b := vm.popTuple()
+	a := vm.popTuple()
+	t := make(Tuple, 0, len(a)+len(b))
+	t = append(t, a...)
+	t = append(t, b...)
+	vm.chargeCreate(t)
+	vm.push(t)
+}
+
 func opEncode(vm *VM) {
 	item := vm.popData()
 	s := Bytes(Encode(item))
@@ -101,6 +152,36 @@ func opEncode(vm *VM) {
 	vm.push(s)
 }
 
+func opIntBytes(vm *VM) {
+	width := int64(vm.popInt())
+	n := vm.popInt()
+	if width < 0 || width > 8 {
+		panic(errors.WithData(ErrRange, "width", width))
+	}
+	if n < 0 || (width < 8 && uint64(n)>>uint(8*width) != 0) {
+		panic(errors.Wrapf(ErrIntOverflow, "%d does not fit in %d bytes", n, width))
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	s := Bytes(buf[8-width:])
+	vm.chargeCreate(s)
+	vm.push(s)
+}
+
+func opBytesInt(vm *VM) {
+	s := vm.popBytes()
+	if len(s) > 8 {
+		panic(errors.WithData(ErrRange, "len(bytes)", len(s)))
+	}
+	var buf [8]byte
+	copy(buf[8-len(s):], s)
+	n := binary.BigEndian.Uint64(buf[:])
+	if n > math.MaxInt64 {
+		panic(errors.Wrapf(ErrIntOverflow, "%x does not fit in an int", []byte(s)))
+	}
+	vm.push(Int(n))
+}
+
 func opInt(vm *VM) {
 	a := vm.popBytes()
 	res, n := binary.Uvarint(a)
@@ -78,7 +78,7 @@ func (x *value) String() string {
 }
 
 func (vm *VM) createValue(amount int64, assetID, anchor []byte) *value {
-	vm.charge(128)
+	vm.charge(entryCost)
 	return &value{
 		amount:  amount,
 		assetID: assetID,
@@ -91,6 +91,12 @@ type contract struct {
 	seed     []byte
 	program  []byte
 	stack    stack
+
+	// input is true for a contract created by the input
+	// instruction, and inputIndex is then its zero-based position
+	// among the transaction's inputs.
+	input      bool
+	inputIndex int64
 }
 
 func (x *contract) isPortable() bool  { return x.typecode == WrappedContractCode }
@@ -151,7 +157,7 @@ func (x *contract) String() string {
 }
 
 func (vm *VM) createContract(prog []byte) *contract {
-	vm.charge(128)
+	vm.charge(entryCost)
 	seed := ContractSeed(prog)
 	return &contract{typecode: ContractCode, seed: seed[:], program: prog}
 }
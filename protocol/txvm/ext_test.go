@@ -0,0 +1,1810 @@
+package txvm_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/crypto/ed25519/ecmath"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/merkle"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/asm"
+)
+
+// Test vector from RFC 8032, section 7.3 (Ed25519ph, message "abc").
+// The prehash is SHA-512("abc").
+const (
+	phPrehash = "x'ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f'"
+	phPubkey  = "x'ec172b93ad5e563bf4932c70e1245034c35467ef2efd4d64ebf819683467e2bf'"
+	phSig     = "x'98a70222f0b8121aa9d30f813d683f809e462b469c7ff87639499bb94e6dae4131f85042463c2a355a2003d062adf5aaa10b8c61e636062aaad11c2a26083406'"
+	phBadSig  = "x'98a70222f0b8121aa9d30f813d683f809e462b469c7ff87639499bb94e6dae4131f85042463c2a355a2003d062adf5aaa10b8c61e636062aaad11c2a26083407'"
+)
+
+// Test vector from RFC 9380, appendix J.5.1 (edwards25519_XMD:SHA-512_ELL2_RO_,
+// message "abc"), with the point in its standard 32-byte encoding.
+const (
+	h2cDST   = "'QUUX-V01-CS02-with-edwards25519_XMD:SHA-512_ELL2_RO_'"
+	h2cPoint = "x'31558a26887f23fb8218f143e69d5f0af2e7831130bd5b432ef23883b895839a'"
+)
+
+// inputSeed is the seed of the contracts spent by the inputindex tests.
+const inputSeed = "cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"
+
+// merkleSrc returns assembly pushing the inclusion proof for items[i]
+// and the root of items, as consumed by merkleverify.
+func merkleSrc(items [][]byte, i int) string {
+	var steps []string
+	for _, step := range merkle.Proof(items, i) {
+		left := 0
+		if step.Left {
+			left = 1
+		}
+		steps = append(steps, fmt.Sprintf("{x'%x', %d}", step.Hash[:], left))
+	}
+	root := merkle.Root(items)
+	return fmt.Sprintf("{%s} x'%x'", strings.Join(steps, ", "), root[:])
+}
+
+func TestExt(t *testing.T) {
+	merkleItems := [][]byte{{1}, {2}, {3}, {4}, {5}}
+
+	const tokenContract = "[get uniquetoken put] contract call get"
+	tokenProg, err := asm.Assemble("get uniquetoken put")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenSeed := txvm.ContractSeed(tokenProg)
+	tokenA := txvm.UniqueToken(tokenSeed[:], []byte("a"))
+
+	cases := []struct {
+		name    string
+		src     string
+		version int64
+		opts    []txvm.Option
+		wantErr error
+	}{
+		{
+			name:    "unassigned ext, no extension flag",
+			src:     "60 ext",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "unassigned ext, extension flag",
+			src:     "60 ext",
+			version: txvm.ExtVersion,
+			opts:    []txvm.Option{txvm.EnableExtension},
+		},
+		{
+			name:    "extended instruction before ExtVersion",
+			src:     "blocktime",
+			version: 3,
+			opts:    []txvm.Option{txvm.BlockTime(1000)},
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "extended instruction before ExtVersion, extension flag",
+			src:     "blocktime",
+			version: 3,
+			opts:    []txvm.Option{txvm.BlockTime(1000), txvm.EnableExtension},
+		},
+		{
+			name:    "blocktime",
+			src:     "blocktime 1000 eq verify",
+			version: txvm.ExtVersion,
+			opts:    []txvm.Option{txvm.BlockTime(1000)},
+		},
+		{
+			name:    "blocktime bound",
+			src:     "blocktime 2000 lt verify",
+			version: txvm.ExtVersion,
+			opts:    []txvm.Option{txvm.BlockTime(3000)},
+			wantErr: txvm.ErrVerifyFail,
+		},
+		{
+			// A scheduled rotation: before time 2000 the argument
+			// must be 1, afterward it must be 2.
+			name:    "blocktime rotation",
+			src:     "2 blocktime 2000 lt jumpif:$before 2 eq verify jump:$end $before 1 eq verify $end",
+			version: txvm.ExtVersion,
+			opts:    []txvm.Option{txvm.BlockTime(3000)},
+		},
+		{
+			name:    "blocktime rotation, before",
+			src:     "2 blocktime 2000 lt jumpif:$before 2 eq verify jump:$end $before 1 eq verify $end",
+			version: txvm.ExtVersion,
+			opts:    []txvm.Option{txvm.BlockTime(1000)},
+			wantErr: txvm.ErrVerifyFail,
+		},
+		{
+			name:    "blocktime outside block context",
+			src:     "blocktime drop",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrBlockContext,
+		},
+		{
+			name:    "prevblock",
+			src:     "prevblock untuple 3 eq verify x'0102' eq verify 900 eq verify 7 eq verify",
+			version: txvm.ExtVersion,
+			opts:    []txvm.Option{txvm.BlockTime(1000), txvm.PrevBlock(7, 900, []byte{1, 2})},
+		},
+		{
+			// Blocks must be at least 500ms apart.
+			name:    "prevblock interval",
+			src:     "blocktime prevblock 1 field 499 add gt verify",
+			version: txvm.ExtVersion,
+			opts:    []txvm.Option{txvm.BlockTime(1500), txvm.PrevBlock(1, 1000, []byte{1})},
+		},
+		{
+			name:    "prevblock interval too short",
+			src:     "blocktime prevblock 1 field 499 add gt verify",
+			version: txvm.ExtVersion,
+			opts:    []txvm.Option{txvm.BlockTime(1499), txvm.PrevBlock(1, 1000, []byte{1})},
+			wantErr: txvm.ErrVerifyFail,
+		},
+		{
+			name:    "prevblock without previous block",
+			src:     "prevblock drop",
+			version: txvm.ExtVersion,
+			opts:    []txvm.Option{txvm.BlockTime(1000)},
+			wantErr: txvm.ErrBlockContext,
+		},
+		{
+			name:    "prevblock outside block context",
+			src:     "prevblock drop",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrBlockContext,
+		},
+		{
+			name:    "checksigph",
+			src:     phPrehash + " " + phPubkey + " " + phSig + " checksigph verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "checksigph empty signature",
+			src:     phPrehash + " " + phPubkey + " '' checksigph not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "checksigph bad signature",
+			src:     phPrehash + " " + phPubkey + " " + phBadSig + " checksigph verify",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrSignature,
+		},
+		{
+			name:    "checksigph short prehash",
+			src:     "'abc' " + phPubkey + " " + phSig + " checksigph verify",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrPrehashSize,
+		},
+		{
+			name:    "plain checksig rejects ed25519ph signature",
+			src:     phPrehash + " " + phPubkey + " " + phSig + " 0 checksig verify",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrSignature,
+		},
+		{
+			name:    "modexp",
+			src:     "x'04' x'0d' x'01f1' modexp x'01bd' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "modexp wide modulus",
+			src:     "x'deadbeef' x'010001' x'fffffffffffffffffffffffffffffff1' modexp x'45321b5d93c3fe6a02a858a5e25ab99d' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "modexp pads result to modulus width",
+			src:     "x'02' x'03' x'000100' modexp x'000008' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "modexp zero exponent",
+			src:     "x'07' '' x'0b' modexp x'01' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "modexp unit modulus",
+			src:     "x'07' x'05' x'01' modexp x'00' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "modexp zero modulus",
+			src:     "x'07' x'05' x'0000' modexp",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrModulus,
+		},
+		{
+			name:    "modexp oversize operand",
+			src:     "x'02' x'03' x'" + strings.Repeat("05", txvm.MaxModExpSize+1) + "' modexp",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrOperandSize,
+		},
+		{
+			name:    "modexp int operand",
+			src:     "4 13 497 modexp",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "finalized before finalize",
+			src:     "finalized not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "finalized after finalize",
+			src:     "x'" + strings.Repeat("00", 32) + "' 1000 nonce finalize finalized verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "finalized in called contract",
+			src:     "x'" + strings.Repeat("00", 32) + "' 1000 nonce finalize [finalized verify] contract call",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "intbytes",
+			src:     "258 8 intbytes x'0000000000000102' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "intbytes exact fit",
+			src:     "65535 2 intbytes x'ffff' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "intbytes overflow",
+			src:     "65536 2 intbytes",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrIntOverflow,
+		},
+		{
+			name:    "intbytes negative",
+			src:     "-1 8 intbytes",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrIntOverflow,
+		},
+		{
+			name:    "intbytes zero width",
+			src:     "0 0 intbytes '' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "intbytes zero width overflow",
+			src:     "1 0 intbytes",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrIntOverflow,
+		},
+		{
+			name:    "intbytes bad width",
+			src:     "1 9 intbytes",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrRange,
+		},
+		{
+			name:    "merkleverify",
+			src:     "x'03' " + merkleSrc(merkleItems, 2) + " merkleverify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "merkleverify last leaf",
+			src:     "x'05' " + merkleSrc(merkleItems, 4) + " merkleverify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "merkleverify single leaf",
+			src:     "x'01' " + merkleSrc(merkleItems[:1], 0) + " merkleverify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "merkleverify wrong leaf",
+			src:     "x'09' " + merkleSrc(merkleItems, 2) + " merkleverify",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrMerkleProof,
+		},
+		{
+			name:    "merkleverify wrong position",
+			src:     "x'03' " + merkleSrc(merkleItems, 3) + " merkleverify",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrMerkleProof,
+		},
+		{
+			name:    "merkleverify wrong root",
+			src:     "x'03' " + merkleSrc(merkleItems, 2) + " drop x'" + strings.Repeat("00", 32) + "' merkleverify",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrMerkleProof,
+		},
+		{
+			name:    "merkleverify malformed step",
+			src:     "x'01' {{x'01', 0}} x'" + strings.Repeat("00", 32) + "' merkleverify",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrFields,
+		},
+		{
+			name:    "uniquetoken",
+			src:     fmt.Sprintf("'a' put %s x'%x' eq verify", tokenContract, tokenA[:]),
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "uniquetoken same seed and tag collide",
+			src:     "'a' put " + tokenContract + " 'a' put " + tokenContract + " eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "uniquetoken different tags differ",
+			src:     "'a' put " + tokenContract + " 'b' put " + tokenContract + " eq not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "uniquetoken different seeds differ",
+			src:     "'a' put " + tokenContract + " 'a' put [get uniquetoken put 0 drop] contract call get eq not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "uniquetoken non-string tag",
+			src:     "7 uniquetoken",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "hashtocurve",
+			src:     "'abc' " + h2cDST + " hashtocurve " + h2cPoint + " eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "hashtocurve different message",
+			src:     "'abd' " + h2cDST + " hashtocurve " + h2cPoint + " eq not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "hashtocurve empty dst",
+			src:     "'abc' '' hashtocurve",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrDSTSize,
+		},
+		{
+			name:    "hashtocurve long dst",
+			src:     "'abc' x'" + strings.Repeat("00", 256) + "' hashtocurve",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrDSTSize,
+		},
+		{
+			name:    "typedfield int",
+			src:     "{7, 'a', {}} 0 'Z' typedfield 7 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "typedfield string",
+			src:     "{7, 'a', {}} 1 'S' typedfield 'a' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "typedfield tuple",
+			src:     "{7, 'a', {}} 2 'T' typedfield len 0 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "typedfield wrong type",
+			src:     "{7, 'a', {}} 1 'Z' typedfield",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "typedfield index out of range",
+			src:     "{7, 'a', {}} 3 'Z' typedfield",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrRange,
+		},
+		{
+			name:    "typedfield negative index",
+			src:     "{7, 'a', {}} -1 'Z' typedfield",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrRange,
+		},
+		{
+			name:    "typedfield bad type code",
+			src:     "{7, 'a', {}} 0 'V' typedfield",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrRange,
+		},
+		{
+			name:    "revbytes",
+			src:     "x'010203' revbytes x'030201' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "revbytes single byte",
+			src:     "x'07' revbytes x'07' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "revbytes empty",
+			src:     "'' revbytes '' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "revbytes twice",
+			src:     "'hello' revbytes revbytes 'hello' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "revbytes non-string",
+			src:     "7 revbytes",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "splitbytes",
+			src:     "'abcde' 2 splitbytes 'cde' eq verify 'ab' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "splitbytes at 0",
+			src:     "'abc' 0 splitbytes 'abc' eq verify '' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "splitbytes at len",
+			src:     "'abc' 3 splitbytes '' eq verify 'abc' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "splitbytes empty",
+			src:     "'' 0 splitbytes '' eq verify '' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "splitbytes out of range",
+			src:     "'abc' 4 splitbytes",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrSliceRange,
+		},
+		{
+			name:    "splitbytes negative",
+			src:     "'abc' -1 splitbytes",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrSliceRange,
+		},
+		{
+			// RFC 4231, test case 1.
+			name:    "hmacsha256",
+			src:     "x'" + strings.Repeat("0b", 20) + "' 'Hi There' hmacsha256 x'b0344c61d8db38535ca8afceaf0bf12b881dc200c9833da726e9376c2e32cff7' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			// RFC 4231, test case 2.
+			name:    "hmacsha256 short key",
+			src:     "'Jefe' 'what do ya want for nothing?' hmacsha256 x'5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			// RFC 4231, test case 6.
+			name:    "hmacsha256 long key",
+			src:     "x'" + strings.Repeat("aa", 131) + "' 'Test Using Larger Than Block-Size Key - Hash Key First' hmacsha256 x'60e431591ee0b67f0d8a26aacbf5b77f8e0bc6213728c5140546040f0ee37f54' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "hmacsha256 empty",
+			src:     "'' '' hmacsha256 x'b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "hmacsha256 non-string key",
+			src:     "1 'msg' hmacsha256",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "tuplecat",
+			src:     "{1, 'a'} {{2}} tuplecat {1, 'a', {2}} encode swap encode eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "tuplecat empty first",
+			src:     "{} {1, 2} tuplecat {1, 2} encode swap encode eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "tuplecat empty second",
+			src:     "{1, 2} {} tuplecat {1, 2} encode swap encode eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "tuplecat both empty",
+			src:     "{} {} tuplecat len 0 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "tuplecat non-tuple",
+			src:     "{1} 'a' tuplecat",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "tuplecat before ExtVersion",
+			src:     "{1} {2} tuplecat",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "inputindex first",
+			src:     "{'C', x'" + inputSeed + "', [inputindex 0 eq verify]} input call",
+			version: txvm.ExtVersion,
+		},
+		{
+			name: "inputindex subsequent",
+			src: "{'C', x'" + inputSeed + "', [inputindex 0 eq verify]} input call " +
+				"{'C', x'" + inputSeed + "', [inputindex 1 eq verify]} input call " +
+				"{'C', x'" + inputSeed + "', [inputindex 2 eq verify]} input call",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inputindex in exec",
+			src:     "{'C', x'" + inputSeed + "', [0 drop]} input call {'C', x'" + inputSeed + "', [[inputindex 1 eq verify] exec]} input call",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inputindex nested input",
+			src:     "{'C', x'" + inputSeed + "', [{'C', x'" + inputSeed + "', [inputindex 1 eq verify]} input call inputindex 0 eq verify]} input call",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inputindex in contract called by input",
+			src:     "{'C', x'" + inputSeed + "', [[inputindex drop] contract call]} input call",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrNotInput,
+		},
+		{
+			name:    "inputindex outside input",
+			src:     "inputindex",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrNotInput,
+		},
+		{
+			name:    "txnonce",
+			src:     "x'" + inputSeed + "' 1000 nonce finalize txnonce txid 'TxNonce' vmhash eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "txnonce before finalize",
+			src:     "txnonce",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrUnfinalized,
+		},
+		{
+			name:    "min",
+			src:     "3 7 min 3 eq verify 7 3 min 3 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "max",
+			src:     "3 7 max 7 eq verify 7 3 max 7 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "min max equal",
+			src:     "5 5 min 5 eq verify 5 5 max 5 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "min max negative",
+			src:     "2 neg 1 min 2 neg eq verify 2 neg 1 max 1 eq verify 2 neg 3 neg max 2 neg eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "min max extremes",
+			src:     "x'ffffffffffffffff7f' int x'80808080808080808001' int min x'80808080808080808001' int eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "min non-int",
+			src:     "1 'a' min",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "max underflow",
+			src:     "1 max",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrUnderflow,
+		},
+		{
+			name:    "all true",
+			src:     "{1, 2, 'a'} all verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "all mixed",
+			src:     "{1, 0, 1} all not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "all false",
+			src:     "{0, 0} all not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "all empty",
+			src:     "{} all verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "any true",
+			src:     "{1, {}} any verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "any mixed",
+			src:     "{0, 0, 1} any verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "any false",
+			src:     "{0, 0} any not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "any empty",
+			src:     "{} any not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "all non-tuple",
+			src:     "1 all",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "any before ExtVersion",
+			src:     "{1} any",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "checkmultisig before ExtVersion",
+			src:     "'msg' {} {} 1 checkmultisig",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "hasprefix",
+			src:     "'tag:value' 'tag:' hasprefix verify 'abc' 'abc' hasprefix verify 'abc' '' hasprefix verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "hasprefix mismatch",
+			src:     "'tag:value' 'value' hasprefix not verify '' 'a' hasprefix not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "hasprefix overlong",
+			src:     "'tag' 'tag:' hasprefix not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "hassuffix",
+			src:     "'tag:value' ':value' hassuffix verify 'abc' 'abc' hassuffix verify 'abc' '' hassuffix verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "hassuffix mismatch",
+			src:     "'tag:value' 'tag' hassuffix not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "hassuffix overlong",
+			src:     "'value' 'x:value' hassuffix not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "hasprefix non-string",
+			src:     "'abc' 1 hasprefix",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "hassuffix before ExtVersion",
+			src:     "'abc' 'c' hassuffix",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "dropif true",
+			src:     "'keep' 'drop' 1 dropif 'keep' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "dropif false",
+			src:     "'keep' 0 dropif 'keep' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "dropif contract",
+			src:     "[] contract 1 dropif",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "dropif underflow",
+			src:     "1 dropif",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrUnderflow,
+		},
+		{
+			name:    "dropif false underflow",
+			src:     "0 dropif",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrUnderflow,
+		},
+		{
+			name:    "dropif before ExtVersion",
+			src:     "'x' 1 dropif",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "finalanchor",
+			src:     "x'" + inputSeed + "' 1000 nonce anchor 1 roll finalize finalanchor eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "finalanchor before finalize",
+			src:     "finalanchor",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrUnfinalized,
+		},
+		{
+			name:    "finalanchor before ExtVersion",
+			src:     "x'" + inputSeed + "' 1000 nonce finalize finalanchor",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "bytesint",
+			src:     "x'07' bytesint 7 eq verify x'00000102' bytesint 258 eq verify x'7fffffffffffffff' bytesint 9223372036854775807 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "bytesint empty",
+			src:     "'' bytesint 0 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "bytesint inverts intbytes",
+			src:     "258 4 intbytes bytesint 258 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "bytesint overlong",
+			src:     "x'000000000000000001' bytesint",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrRange,
+		},
+		{
+			name:    "bytesint overflow",
+			src:     "x'8000000000000000' bytesint",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrIntOverflow,
+		},
+		{
+			name:    "bytesint before ExtVersion",
+			src:     "x'07' bytesint",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "verifydepth empty",
+			src:     "0 verifydepth",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "verifydepth",
+			src:     "'a' 'b' 2 verifydepth drop drop",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "verifydepth non-empty",
+			src:     "'a' 0 verifydepth",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrStackDepth,
+		},
+		{
+			name:    "verifydepth too shallow",
+			src:     "'a' 2 verifydepth",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrStackDepth,
+		},
+		{
+			name:    "verifydepth in contract",
+			src:     "'x' [0 verifydepth] contract call drop",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "verifydepth before ExtVersion",
+			src:     "0 verifydepth",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "keycommit",
+			src:     "'ab' 'c' keycommit x'c150b536a0d7450f5d040d8dac8f6924ce08e5f015c594e343e9e485463ef3bb' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "keycommit non-string",
+			src:     "'ab' 1 keycommit",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "keycommit before ExtVersion",
+			src:     "'ab' 'c' keycommit",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "checkaggsig empty signature",
+			src:     "'msg' {x'0000000000000000000000000000000000000000000000000000000000000000'} '' checkaggsig not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "checkaggsig no pubkeys",
+			src:     "'msg' {} '' checkaggsig",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrFields,
+		},
+		{
+			name:    "checkaggsig non-string pubkey",
+			src:     "'msg' {1} '' checkaggsig",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "checkaggsig before ExtVersion",
+			src:     "'msg' {} '' checkaggsig",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "rotl",
+			src:     "x'0102030405' 2 rotl x'0304050102' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "rotr",
+			src:     "x'0102030405' 2 rotr x'0405010203' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "rotl zero",
+			src:     "'abc' 0 rotl 'abc' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "rotl full length",
+			src:     "'abc' 3 rotl 'abc' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "rotr full length",
+			src:     "'abc' 3 rotr 'abc' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "rotl count greater than length",
+			src:     "'abcde' 12 rotl 'cdeab' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "rotr count greater than length",
+			src:     "'abcde' 12 rotr 'deabc' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "rotl then rotr",
+			src:     "'hello' 4 rotl 4 rotr 'hello' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "rotl empty",
+			src:     "'' 5 rotl '' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "rotr empty",
+			src:     "'' 5 rotr '' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "rotl negative count",
+			src:     "'abc' -1 rotl",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrRange,
+		},
+		{
+			name:    "rotr negative count",
+			src:     "'abc' -1 rotr",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrRange,
+		},
+		{
+			name:    "rotl non-string",
+			src:     "7 1 rotl",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "rotl before ExtVersion",
+			src:     "'abc' 1 rotl",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "rotr before ExtVersion",
+			src:     "'abc' 1 rotr",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "map",
+			src:     "{1, 2, 3} [10 mul] map {10, 20, 30} encode swap encode eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "map empty tuple",
+			src:     "{} [10 mul] map {} encode swap encode eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "map changing types",
+			src:     "{'a', 'bc', ''} [len] map {1, 2, 0} encode swap encode eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "map empty program",
+			src:     "{'a', 7} [] map {'a', 7} encode swap encode eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "map leaves items below",
+			src:     "5 {1, 2} [1 add] map {2, 3} encode swap encode eq verify 5 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "map cannot read items below",
+			src:     "5 {1, 2} [1 peek add] map",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrStackRange,
+		},
+		{
+			// The program would replace the 5 below its item with
+			// a copy of the item.
+			name:    "map cannot replace items below",
+			src:     "5 {1} [swap drop dup] map",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrStackRange,
+		},
+		{
+			name:    "map program yields",
+			src:     "{1, 2} [[] yield] map",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrMapUnwind,
+		},
+		{
+			name:    "map nested",
+			src:     "{{1, 2}, {3}} [[1 add] map] map {{2, 3}, {4}} encode swap encode eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "map program leaves nothing",
+			src:     "{1, 2} [drop] map",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrMapResult,
+		},
+		{
+			name:    "map program leaves two items",
+			src:     "{1, 2} [dup] map",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrMapResult,
+		},
+		{
+			name:    "map program fails",
+			src:     "{1, 0} [verify 1] map",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrVerifyFail,
+		},
+		{
+			name:    "map non-data result",
+			src:     "{1} [drop 0 1 nonce] map",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "map non-tuple",
+			src:     "7 [1 add] map",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "map before ExtVersion",
+			src:     "{1} [] map",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "inrange",
+			src:     "5 1 10 inrange verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inrange at lower bound",
+			src:     "1 1 10 inrange verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inrange at upper bound",
+			src:     "10 1 10 inrange verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inrange below lower bound",
+			src:     "0 1 10 inrange not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inrange above upper bound",
+			src:     "11 1 10 inrange not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inrange single value",
+			src:     "7 7 7 inrange verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inrange inverted bounds",
+			src:     "5 10 1 inrange not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inrange inverted bounds at either bound",
+			src:     "10 10 1 inrange not verify 1 10 1 inrange not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inrange negative",
+			src:     "-5 -10 -1 inrange verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inrange large bounds",
+			src:     "0 -1000000000 1000000000 inrange verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "inrange non-int",
+			src:     "'a' 1 10 inrange",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "inrange before ExtVersion",
+			src:     "5 1 10 inrange",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "popcount zero",
+			src:     "0 popcount 0 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "popcount all ones",
+			src:     "-1 popcount 64 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "popcount mask",
+			src:     "181 popcount 5 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "popcount power of two",
+			src:     "1024 popcount 1 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "popcount min int",
+			src:     "-9223372036854775808 popcount 1 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "popcount max int",
+			src:     "9223372036854775807 popcount 63 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "popcount non-int",
+			src:     "'a' popcount",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "popcount before ExtVersion",
+			src:     "1 popcount",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "isutf8 ascii",
+			src:     "'hello, world' isutf8 verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "isutf8 empty",
+			src:     "'' isutf8 verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "isutf8 multibyte",
+			src:     "x'c3a9e282acf09f9880' isutf8 verify", // é€😀
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "isutf8 invalid byte",
+			src:     "x'61ff62' isutf8 not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "isutf8 truncated sequence",
+			src:     "x'e282' isutf8 not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "isutf8 overlong encoding",
+			src:     "x'c0af' isutf8 not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "isutf8 surrogate",
+			src:     "x'eda080' isutf8 not verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "isutf8 non-string",
+			src:     "7 isutf8",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "isutf8 before ExtVersion",
+			src:     "'a' isutf8",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "padl",
+			src:     "x'0102' 5 0 padl x'0000000102' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "padr",
+			src:     "'ab' 4 32 padr 'ab  ' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "padl no padding needed",
+			src:     "'abcde' 3 0 padl 'abcde' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "padr exact length",
+			src:     "'abc' 3 0 padr 'abc' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "padl zero length",
+			src:     "'abc' 0 0 padl 'abc' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "padr empty string",
+			src:     "'' 3 255 padr x'ffffff' eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "padl negative length",
+			src:     "'abc' -1 0 padl",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrRange,
+		},
+		{
+			name:    "padr bad pad byte",
+			src:     "'abc' 5 256 padr",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrRange,
+		},
+		{
+			name:    "padl over runlimit",
+			src:     "'abc' 1000000 0 padl",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrRunlimit,
+		},
+		{
+			name:    "padl before ExtVersion",
+			src:     "'a' 2 0 padl",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "clear empty",
+			src:     "clear",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "clear deep",
+			src:     "1 2 3 'abc' {4, 5} 6 7 8 9 10 clear",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "clear then push",
+			src:     "1 2 3 clear 4 4 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "clear leaves argument stack",
+			src:     "7 put 1 2 clear get 7 eq verify",
+			version: txvm.ExtVersion,
+		},
+		{
+			name:    "clear contract",
+			src:     "1 x'' contract 2 clear",
+			version: txvm.ExtVersion,
+			wantErr: txvm.ErrType,
+		},
+		{
+			name:    "clear before ExtVersion",
+			src:     "1 clear",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+		{
+			name:    "min before ExtVersion",
+			src:     "1 2 min",
+			version: 3,
+			wantErr: txvm.ErrExt,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			prog, err := asm.Assemble(c.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = txvm.Validate(prog, c.version, 10000, c.opts...)
+			if errors.Root(err) != c.wantErr {
+				t.Errorf("got error %v, want %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckMultisig(t *testing.T) {
+	const msg = "message"
+	var (
+		pubs  []string
+		sigs  []string
+		other string
+	)
+	for i := 0; i < 4; i++ {
+		pub, prv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 3 {
+			// A signature by a key outside the set.
+			other = fmt.Sprintf("x'%x'", ed25519.Sign(prv, []byte(msg)))
+			break
+		}
+		pubs = append(pubs, fmt.Sprintf("x'%x'", pub))
+		sigs = append(sigs, fmt.Sprintf("x'%x'", ed25519.Sign(prv, []byte(msg))))
+	}
+	tuple := func(items ...string) string {
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	allPubs := tuple(pubs...)
+
+	cases := []struct {
+		name    string
+		sigs    string
+		pubkeys string
+		quorum  int
+		wantErr error
+	}{
+		{
+			name:    "exactly k",
+			sigs:    tuple(sigs[0], "''", sigs[2]),
+			pubkeys: allPubs,
+			quorum:  2,
+		},
+		{
+			name:    "more than k",
+			sigs:    tuple(sigs...),
+			pubkeys: allPubs,
+			quorum:  2,
+		},
+		{
+			name:    "below k",
+			sigs:    tuple("''", sigs[1], "''"),
+			pubkeys: allPubs,
+			quorum:  2,
+			wantErr: txvm.ErrQuorum,
+		},
+		{
+			name:    "no signatures",
+			sigs:    tuple("''", "''", "''"),
+			pubkeys: allPubs,
+			quorum:  1,
+			wantErr: txvm.ErrQuorum,
+		},
+		{
+			name:    "duplicate signature",
+			sigs:    tuple(sigs[0], sigs[0], "''"),
+			pubkeys: tuple(pubs[0], pubs[0], pubs[1]),
+			quorum:  2,
+			wantErr: txvm.ErrDupPubkey,
+		},
+		{
+			name:    "signature out of order",
+			sigs:    tuple(sigs[1], sigs[0], "''"),
+			pubkeys: allPubs,
+			quorum:  2,
+			wantErr: txvm.ErrSignature,
+		},
+		{
+			name:    "invalid extra signature",
+			sigs:    tuple(sigs[0], sigs[1], other),
+			pubkeys: allPubs,
+			quorum:  2,
+			wantErr: txvm.ErrSignature,
+		},
+		{
+			name:    "too few signatures",
+			sigs:    tuple(sigs[0], sigs[1]),
+			pubkeys: allPubs,
+			quorum:  2,
+			wantErr: txvm.ErrFields,
+		},
+		{
+			name:    "quorum too large",
+			sigs:    tuple(sigs...),
+			pubkeys: allPubs,
+			quorum:  4,
+			wantErr: txvm.ErrRange,
+		},
+		{
+			name:    "zero quorum",
+			sigs:    tuple(sigs...),
+			pubkeys: allPubs,
+			quorum:  0,
+			wantErr: txvm.ErrRange,
+		},
+		{
+			name:    "non-string pubkey",
+			sigs:    tuple("''", "''"),
+			pubkeys: tuple(pubs[0], "1"),
+			quorum:  1,
+			wantErr: txvm.ErrType,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			prog, err := asm.Assemble(fmt.Sprintf("'%s' %s %s %d checkmultisig", msg, c.sigs, c.pubkeys, c.quorum))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = txvm.Validate(prog, txvm.ExtVersion, 100000)
+			if errors.Root(err) != c.wantErr {
+				t.Errorf("got error %v, want %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+// TestCheckMultisigCofactorless checks that checkmultisig verifies
+// each signature exactly as checksig does, with the cofactorless
+// equation s·B = R + h·A. The signatures here are made with a public
+// key that has a small-order component T, so they satisfy the
+// cofactored equation 8·s·B = 8·R + 8·h·A, which a randomized batch
+// check may accept, but satisfy the exact one only when h·T is zero.
+func TestCheckMultisigCofactorless(t *testing.T) {
+	// A point of order 8.
+	var (
+		torsion    ecmath.Point
+		torsionEnc [32]byte
+	)
+	hex.Decode(torsionEnc[:], []byte("c7176a703d4dd84fba3c0b760d10670f2a2053fa2c39ccc64ec7fd7792ac037a"))
+	if _, ok := torsion.Decode(torsionEnc); !ok {
+		t.Fatal("cannot decode torsion point")
+	}
+
+	seed := sha512.Sum512([]byte("cofactorless"))
+	var a ecmath.Scalar
+	a.Reduce(&seed)
+	var pub ecmath.Point
+	pub.ScMulBase(&a)
+	pub.Add(&pub, &torsion)
+	pubBytes := pub.Encode()
+
+	// sign returns a signature of msg under pub, and whether h·T is
+	// zero, so that the signature is valid.
+	sign := func(msg []byte) ([]byte, bool) {
+		nonce := sha512.Sum512(append([]byte("nonce"), msg...))
+		var r ecmath.Scalar
+		r.Reduce(&nonce)
+		var rp ecmath.Point
+		rp.ScMulBase(&r)
+		rBytes := rp.Encode()
+
+		hash := sha512.New()
+		hash.Write(rBytes[:])
+		hash.Write(pubBytes[:])
+		hash.Write(msg)
+		var digest [64]byte
+		hash.Sum(digest[:0])
+		var h ecmath.Scalar
+		h.Reduce(&digest)
+
+		var s ecmath.Scalar
+		s.MulAdd(&h, &a, &r)
+		return append(rBytes[:], s[:]...), h[0]&7 == 0
+	}
+
+	var sawValid, sawInvalid bool
+	for i := 0; !sawValid || !sawInvalid; i++ {
+		msg := []byte(fmt.Sprintf("message %d", i))
+		sig, valid := sign(msg)
+		if (valid && sawValid) || (!valid && sawInvalid) {
+			continue
+		}
+		if valid {
+			sawValid = true
+		} else {
+			sawInvalid = true
+		}
+
+		prog, err := asm.Assemble(fmt.Sprintf("x'%x' {x'%x'} {x'%x'} 1 checkmultisig", msg, sig, pubBytes[:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = txvm.Validate(prog, txvm.ExtVersion, 100000)
+		if valid && err != nil {
+			t.Errorf("%s: got error %v, want nil", msg, err)
+		}
+		if !valid && errors.Root(err) != txvm.ErrSignature {
+			t.Errorf("%s: got error %v, want %v", msg, err, txvm.ErrSignature)
+		}
+		if got := ed25519.Verify(pubBytes[:], msg, sig); got != valid {
+			t.Errorf("%s: ed25519.Verify = %t, want %t", msg, got, valid)
+		}
+	}
+}
+
+// aggSign makes a signature of msg valid under the aggregate of
+// pubkeys, by the signers with the given private keys, following the
+// procedure in the doc of txvm.AggregatePubkey. Each signer's nonce is
+// derived from its key and msg, so signatures are deterministic.
+func aggSign(t *testing.T, pubkeys []ed25519.PublicKey, signers []ed25519.PrivateKey, msg []byte) []byte {
+	agg, coeffs, err := txvm.AggregatePubkey(pubkeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		rs   []ecmath.Scalar
+		rsum = ecmath.ZeroPoint
+	)
+	for _, prv := range signers {
+		h := sha512.Sum512(append(append([]byte("nonce"), prv[:32]...), msg...))
+		var r ecmath.Scalar
+		r.Reduce(&h)
+		var rp ecmath.Point
+		rp.ScMulBase(&r)
+		rsum.Add(&rsum, &rp)
+		rs = append(rs, r)
+	}
+	renc := rsum.Encode()
+
+	hasher := sha512.New()
+	hasher.Write(renc[:])
+	hasher.Write(agg)
+	hasher.Write(msg)
+	var digest [64]byte
+	hasher.Sum(digest[:0])
+	var c ecmath.Scalar
+	c.Reduce(&digest)
+
+	var s ecmath.Scalar
+	for i, prv := range signers {
+		h := sha512.Sum512(prv[:32])
+		var x ecmath.Scalar
+		copy(x[:], h[:32])
+		x.Prune()
+		var a ecmath.Scalar
+		for j, pubkey := range pubkeys {
+			if bytes.Equal(pubkey, prv[32:]) {
+				a = coeffs[j]
+			}
+		}
+		var cax ecmath.Scalar
+		cax.Mul(&c, &a)
+		s.Add(&s, cax.MulAdd(&cax, &x, &rs[i]))
+	}
+	return append(renc[:], s[:]...)
+}
+
+func TestCheckAggSig(t *testing.T) {
+	var (
+		prvs    []ed25519.PrivateKey
+		pubkeys []ed25519.PublicKey
+	)
+	for i := 0; i < 3; i++ {
+		seed := bytes.Repeat([]byte{byte(i + 1)}, 32)
+		pub, prv, err := ed25519.GenerateKey(bytes.NewReader(seed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		prvs = append(prvs, prv)
+		pubkeys = append(pubkeys, pub)
+	}
+
+	// Reference aggregates of the keys with seeds 0x0101..., 0x0202...,
+	// and 0x0303....
+	vectors := []struct {
+		order []int
+		want  string
+	}{
+		{[]int{0}, "1e679de874bdbd8c975dd2b45eee84b92e2ad8c04bc93aa3754d957e4d5a2b20"},
+		{[]int{0, 1}, "01a2f123b4a08a15cabeed811c438a44bfe9e99ab2ebf62add9349d41a74dda6"},
+		{[]int{1, 0}, "07c996f47e48142c63aad976ada6ac58997028b1f55f4949377333f1588a38c6"},
+		{[]int{0, 1, 2}, "a6c45851d41655fc8931c8a5462dd621620222ec891c8f98c8343562cab35aad"},
+	}
+	for _, v := range vectors {
+		var keys []ed25519.PublicKey
+		for _, i := range v.order {
+			keys = append(keys, pubkeys[i])
+		}
+		agg, _, err := txvm.AggregatePubkey(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%x", agg); got != v.want {
+			t.Errorf("aggregate of keys %v = %s, want %s", v.order, got, v.want)
+		}
+	}
+
+	msg := []byte("message")
+	tuple := func(keys []ed25519.PublicKey) string {
+		var items []string
+		for _, k := range keys {
+			items = append(items, fmt.Sprintf("x'%x'", k))
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	reversed := []ed25519.PublicKey{pubkeys[2], pubkeys[1], pubkeys[0]}
+	sig := aggSign(t, pubkeys, prvs, msg)
+	cases := []struct {
+		name    string
+		msg     []byte
+		pubkeys []ed25519.PublicKey
+		sig     []byte
+		wantErr error
+	}{
+		{
+			name:    "valid",
+			msg:     msg,
+			pubkeys: pubkeys,
+			sig:     sig,
+		},
+		{
+			name:    "valid, single key",
+			msg:     msg,
+			pubkeys: pubkeys[:1],
+			sig:     aggSign(t, pubkeys[:1], prvs[:1], msg),
+		},
+		{
+			name:    "valid, reversed keys",
+			msg:     msg,
+			pubkeys: reversed,
+			sig:     aggSign(t, reversed, prvs, msg),
+		},
+		{
+			name:    "keys out of order",
+			msg:     msg,
+			pubkeys: reversed,
+			sig:     sig,
+			wantErr: txvm.ErrSignature,
+		},
+		{
+			name:    "missing signer",
+			msg:     msg,
+			pubkeys: pubkeys,
+			sig:     aggSign(t, pubkeys, prvs[:2], msg),
+			wantErr: txvm.ErrSignature,
+		},
+		{
+			name:    "wrong message",
+			msg:     []byte("other"),
+			pubkeys: pubkeys,
+			sig:     sig,
+			wantErr: txvm.ErrSignature,
+		},
+		{
+			name:    "individual signature",
+			msg:     msg,
+			pubkeys: pubkeys[:1],
+			sig:     ed25519.Sign(prvs[0], msg),
+			wantErr: txvm.ErrSignature,
+		},
+		{
+			name:    "duplicate key",
+			msg:     msg,
+			pubkeys: []ed25519.PublicKey{pubkeys[0], pubkeys[0]},
+			sig:     sig,
+			wantErr: txvm.ErrDupPubkey,
+		},
+		{
+			name:    "short key",
+			msg:     msg,
+			pubkeys: []ed25519.PublicKey{pubkeys[0][:31]},
+			sig:     sig,
+			wantErr: txvm.ErrPubSize,
+		},
+		{
+			name:    "short signature",
+			msg:     msg,
+			pubkeys: pubkeys,
+			sig:     sig[:63],
+			wantErr: txvm.ErrSigSize,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			prog, err := asm.Assemble(fmt.Sprintf("x'%x' %s x'%x' checkaggsig verify", c.msg, tuple(c.pubkeys), c.sig))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = txvm.Validate(prog, txvm.ExtVersion, 100000)
+			if errors.Root(err) != c.wantErr {
+				t.Errorf("got error %v, want %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestProgramHash(t *testing.T) {
+	inner, err := asm.Assemble("programhash put")
+	if err != nil {
+		t.Fatal(err)
+	}
+	innerHash := sha256.Sum256(inner)
+
+	// A called contract hashes its own program, not the caller's.
+	prog, err := asm.Assemble(fmt.Sprintf("x'%x' contract call get x'%x' eq verify", inner, innerHash[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = txvm.Validate(prog, txvm.ExtVersion, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// At top level, the program is the transaction program.
+	prog, err = asm.Assemble("programhash drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	progHash := sha256.Sum256(prog)
+	var got []byte
+	_, err = txvm.Validate(prog, txvm.ExtVersion, 10000, txvm.AfterStep(func(vm *txvm.VM) {
+		if vm.StackLen() > 0 {
+			got = vm.StackItem(0).(txvm.Tuple)[1].(txvm.Bytes)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, progHash[:]) {
+		t.Errorf("programhash = %x, want %x", got, progHash[:])
+	}
+
+	prog, err = asm.Assemble("programhash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = txvm.Validate(prog, 3, 10000)
+	if errors.Root(err) != txvm.ErrExt {
+		t.Errorf("before ExtVersion: got error %v, want %v", err, txvm.ErrExt)
+	}
+}
+
+func TestTxNonce(t *testing.T) {
+	// run runs a transaction whose finalize anchor comes from a nonce
+	// with expiration exp, and returns the txnonce it computes.
+	run := func(exp int) (txid, nonce [32]byte) {
+		prog, err := asm.Assemble(fmt.Sprintf("x'%s' %d nonce finalize txnonce drop", inputSeed, exp))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vm, err := txvm.Validate(prog, txvm.ExtVersion, 10000, txvm.AfterStep(func(vm *txvm.VM) {
+			// After finalize, only txnonce leaves an item on the stack.
+			if vm.Finalized && vm.StackLen() > 0 {
+				copy(nonce[:], vm.StackItem(0).(txvm.Tuple)[1].(txvm.Bytes))
+			}
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vm.TxID, nonce
+	}
+
+	txid1, nonce1 := run(1000)
+	if nonce1 != txvm.TxNonce(txid1) {
+		t.Errorf("txnonce = %x, want %x", nonce1, txvm.TxNonce(txid1))
+	}
+	if nonce1 == txid1 {
+		t.Error("txnonce equals txid")
+	}
+	_, again := run(1000)
+	if again != nonce1 {
+		t.Errorf("same transaction: txnonce %x, then %x", nonce1, again)
+	}
+	_, nonce2 := run(2000)
+	if nonce2 == nonce1 {
+		t.Errorf("different transactions: both have txnonce %x", nonce1)
+	}
+}
+
+func TestKeyCommit(t *testing.T) {
+	// Pairs whose concatenations, or whose keys and values, coincide.
+	pairs := [][2]string{
+		{"ab", "c"},
+		{"a", "bc"},
+		{"abc", ""},
+		{"", "abc"},
+		{"", ""},
+		{"c", "ab"},
+		{"\x01a", "b"},
+		{"\x01", "ab"},
+		{"a", "\x01b"},
+	}
+	seen := make(map[[32]byte][2]string)
+	for _, p := range pairs {
+		key, value := []byte(p[0]), []byte(p[1])
+		prog, err := asm.Assemble(fmt.Sprintf("x'%x' x'%x' keycommit drop", key, value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []byte
+		_, err = txvm.Validate(prog, txvm.ExtVersion, 10000, txvm.AfterStep(func(vm *txvm.VM) {
+			if vm.StackLen() > 0 {
+				got = vm.StackItem(0).(txvm.Tuple)[1].(txvm.Bytes)
+			}
+		}))
+		if err != nil {
+			t.Fatalf("%q: %v", p, err)
+		}
+		want := txvm.KeyCommitment(key, value)
+		if !bytes.Equal(got, want[:]) {
+			t.Errorf("%q: keycommit = %x, KeyCommitment = %x", p, got, want[:])
+		}
+		if other, ok := seen[want]; ok {
+			t.Errorf("%q and %q have the same commitment %x", p, other, want[:])
+		}
+		seen[want] = p
+	}
+}
@@ -0,0 +1,82 @@
+package txvm
+
+import "github.com/chain/txvm/errors"
+
+// FailureSnapshot is a copy of the VM state taken immediately before
+// the execution of an instruction that failed. It is produced by the
+// WithFailureSnapshot option.
+type FailureSnapshot struct {
+	// PC is the position of the failing instruction in Prog.
+	PC int64
+
+	// Prog is the program containing the failing instruction.
+	Prog []byte
+
+	// Opcode is the opcode of the failing instruction.
+	Opcode byte
+
+	// Stack is the current contract stack, bottom first.
+	// Items that are not plain data appear in inspected form.
+	Stack []Data
+
+	// ArgStack is the argument stack, bottom first, in the same form
+	// as Stack.
+	ArgStack []Data
+
+	// RunStack is the stack of programs suspended by exec, call, and
+	// similar instructions, outermost first.
+	RunStack []RunFrame
+}
+
+// RunFrame is a suspended program and the position in it at which
+// execution will resume.
+type RunFrame struct {
+	PC   int64
+	Prog []byte
+}
+
+// Failure returns the FailureSnapshot carried by err, an error
+// returned by Validate with the WithFailureSnapshot option, or nil if
+// there is none.
+func Failure(err error) *FailureSnapshot {
+	s, _ := errors.Data(err)["failure"].(*FailureSnapshot)
+	return s
+}
+
+func (vm *VM) snapshot() *FailureSnapshot {
+	s := &FailureSnapshot{
+		PC:       vm.run.pc,
+		Prog:     vm.run.prog,
+		Opcode:   vm.opcode,
+		Stack:    copyStack(vm.contract.stack),
+		ArgStack: copyStack(vm.argstack),
+	}
+	for _, r := range vm.runstack {
+		s.RunStack = append(s.RunStack, RunFrame{PC: r.pc, Prog: r.prog})
+	}
+	return s
+}
+
+// recordFailure is deferred by step. If the step is panicking, and
+// no more deeply nested step has already recorded a failure, it
+// records s.
+func (vm *VM) recordFailure(s *FailureSnapshot) {
+	if r := recover(); r != nil {
+		if vm.failure == nil {
+			vm.failure = s
+		}
+		panic(r)
+	}
+}
+
+func copyStack(s stack) []Data {
+	res := make([]Data, 0, len(s))
+	for _, item := range s {
+		if d, ok := item.(Data); ok {
+			res = append(res, d)
+		} else {
+			res = append(res, item.inspect())
+		}
+	}
+	return res
+}
@@ -14,12 +14,13 @@ import (
 )
 
 func main() {
-	ops := getOps()
+	ops := getOps(0)
+	exts := getOps(1)
 	opgenName := "opgen.go"
 	out, err := os.Create(opgenName)
 	must(err)
 	fmt.Fprint(out, "// Auto-generated from op/op.go by gen.go\n\npackage txvm\n\n")
-	fmt.Fprintln(out, `import "chain/protocol/txvm/op"`)
+	fmt.Fprintln(out, `import "github.com/chain/txvm/protocol/txvm/op"`)
 
 	fmt.Fprint(out, "var opFuncs [256]func(*VM)\n\n")
 
@@ -27,6 +28,14 @@ func main() {
 	for _, op := range ops {
 		fmt.Fprintf(out, "\topFuncs[op.%s] = op%s\n", op, op)
 	}
+	fmt.Fprint(out, "}\n\n")
+
+	fmt.Fprint(out, "var extFuncs [256]func(*VM)\n\n")
+
+	fmt.Fprint(out, "func init() {\n")
+	for _, ext := range exts {
+		fmt.Fprintf(out, "\textFuncs[op.%s] = op%s\n", ext, ext)
+	}
 	fmt.Fprint(out, "}\n")
 
 	out.Close()
@@ -35,19 +44,24 @@ func main() {
 	must(cmd.Run())
 }
 
-func getOps() []string {
+// getOps returns the names in the nth top-level const block of
+// op/op.go.
+func getOps(n int) []string {
 	fset := token.NewFileSet()
 	f, err := parser.ParseFile(fset, "op/op.go", nil, 0)
 	must(err)
 	var constDecl *ast.GenDecl
 	for _, d := range f.Decls {
 		if gendecl, ok := d.(*ast.GenDecl); ok && gendecl.Tok == token.CONST {
-			constDecl = gendecl
-			break
+			if n == 0 {
+				constDecl = gendecl
+				break
+			}
+			n--
 		}
 	}
 	if constDecl == nil {
-		panic("op/op.go has no top-level const declaration")
+		panic("op/op.go has too few top-level const declarations")
 	}
 	var ops []string
 	for _, spec := range constDecl.Specs {
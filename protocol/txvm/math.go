@@ -1,6 +1,9 @@
 package txvm
 
 import (
+	"math/big"
+	"math/bits"
+
 	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/math/checked"
 	"github.com/chain/txvm/protocol/txvm/op"
@@ -33,8 +36,78 @@ func binOp(vm *VM, f func(a, b int64) (int64, bool)) {
 	vm.push(Int(res))
 }
 
+// MaxModExpSize is the maximum length, in bytes, of each operand of
+// the modexp instruction.
+const MaxModExpSize = 512
+
+var (
+	// ErrModulus is returned when modexp is called with a zero
+	// modulus.
+	ErrModulus = errorf("zero modulus")
+
+	// ErrOperandSize is returned when modexp is called with an
+	// operand longer than MaxModExpSize.
+	ErrOperandSize = errorf("operand too large")
+)
+
+func opModExp(vm *VM) {
+	m := vm.popBytes()
+	e := vm.popBytes()
+	b := vm.popBytes()
+	for _, x := range []Bytes{b, e, m} {
+		if len(x) > MaxModExpSize {
+			panic(errors.WithData(ErrOperandSize, "got", len(x), "max", MaxModExpSize))
+		}
+	}
+	mod := new(big.Int).SetBytes(m)
+	if mod.Sign() == 0 {
+		panic(ErrModulus)
+	}
+	exp := new(big.Int).SetBytes(e)
+	vm.charge(modExpCost(int64(len(m)), int64(exp.BitLen())))
+
+	res := new(big.Int).Exp(new(big.Int).SetBytes(b), exp, mod)
+
+	// The result is as wide as the modulus, left-padded with zeroes.
+	out := make(Bytes, len(m))
+	resBytes := res.Bytes()
+	copy(out[len(out)-len(resBytes):], resBytes)
+	vm.chargeCreate(out)
+	vm.push(out)
+}
+
 func opGT(vm *VM) {
 	b := vm.popInt()
 	a := vm.popInt()
 	vm.pushBool(a > b)
 }
+
+func opMin(vm *VM) {
+	b := vm.popInt()
+	a := vm.popInt()
+	if b < a {
+		a = b
+	}
+	vm.push(a)
+}
+
+func opMax(vm *VM) {
+	b := vm.popInt()
+	a := vm.popInt()
+	if b > a {
+		a = b
+	}
+	vm.push(a)
+}
+
+func opInRange(vm *VM) {
+	upper := vm.popInt()
+	lower := vm.popInt()
+	x := vm.popInt()
+	vm.pushBool(lower <= x && x <= upper)
+}
+
+func opPopCount(vm *VM) {
+	a := vm.popInt()
+	vm.push(Int(bits.OnesCount64(uint64(a))))
+}
@@ -0,0 +1,50 @@
+package op
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Canonicalize parses prog and returns its canonical encoding, in
+// which every instruction's opcode (which for pushdata instructions
+// includes the data length) is a minimal-length varint. Programs
+// that differ only in the encoding of their instructions have the
+// same canonical form, so indexers can group contracts by it.
+//
+// Jump offsets count bytes, so a program's behavior can depend on
+// the length of its encoding. Canonicalize therefore rejects a
+// program containing a jumpif instruction unless it is already
+// canonical. It also rejects malformed programs.
+func Canonicalize(prog []byte) ([]byte, error) {
+	var (
+		buf     bytes.Buffer
+		varint  [binary.MaxVarintLen64]byte
+		changed bool
+		jumps   bool
+	)
+	for pc := 0; pc < len(prog); {
+		opcode, data, n, err := DecodeInst(prog[pc:])
+		if err != nil {
+			return nil, fmt.Errorf("at pc %d: %s", pc, err)
+		}
+		v := uint64(opcode)
+		if IsPushdataOp(opcode) {
+			v += uint64(len(data))
+		}
+		m := binary.PutUvarint(varint[:], v)
+		buf.Write(varint[:m])
+		buf.Write(data)
+		if int64(m+len(data)) != n {
+			changed = true
+		}
+		if opcode == JumpIf {
+			jumps = true
+		}
+		pc += int(n)
+	}
+	if changed && jumps {
+		return nil, fmt.Errorf("non-canonical program contains jumpif")
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+package op
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	canonical := []byte{MinSmallInt + 5, MinPushdata + 2, 'h', 'i', Drop, Verify}
+
+	equivalent := [][]byte{
+		canonical,
+		// Non-minimal small int.
+		{0x80 | (MinSmallInt + 5), 0x00, MinPushdata + 2, 'h', 'i', Drop, Verify},
+		// Non-minimal pushdata.
+		{MinSmallInt + 5, 0x80 | (MinPushdata + 2), 0x80, 0x00, 'h', 'i', Drop, Verify},
+		// Non-minimal ordinary opcodes.
+		{MinSmallInt + 5, MinPushdata + 2, 'h', 'i', 0x80 | Drop, 0x00, 0x80 | Verify, 0x80, 0x00},
+	}
+	for i, prog := range equivalent {
+		got, err := Canonicalize(prog)
+		if err != nil {
+			t.Errorf("case %d: unexpected error %s", i, err)
+			continue
+		}
+		if !bytes.Equal(got, canonical) {
+			t.Errorf("case %d: Canonicalize(%x) = %x, want %x", i, prog, got, canonical)
+		}
+	}
+
+	// Long pushdata needs a multibyte opcode.
+	long := append([]byte{0x80 | (MinPushdata + 100 - 0x80), 0x01}, make([]byte, 100)...)
+	got, err := Canonicalize(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, long) {
+		t.Errorf("Canonicalize changed canonical long pushdata")
+	}
+
+	// Canonical programs with jumps are accepted as is.
+	jump := []byte{MinSmallInt + 1, MinSmallInt + 1, JumpIf, Drop}
+	got, err = Canonicalize(jump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, jump) {
+		t.Errorf("Canonicalize(%x) = %x, want unchanged", jump, got)
+	}
+
+	bad := [][]byte{
+		// Non-canonical program with a jump.
+		{MinSmallInt + 1, 0x80 | (MinSmallInt + 1), 0x00, JumpIf, Drop},
+		// Truncated pushdata.
+		{MinPushdata + 3, 'a', 'b'},
+		// Truncated varint.
+		{Drop, 0x80},
+	}
+	for i, prog := range bad {
+		_, err := Canonicalize(prog)
+		if err == nil {
+			t.Errorf("bad case %d: Canonicalize(%x) succeeded, want error", i, prog)
+		}
+	}
+}
@@ -15,7 +15,8 @@ import (
 )
 
 func main() {
-	ops := getOps()
+	ops := getOps(0)
+	exts := getOps(1)
 	w, err := os.Create("opgen.go")
 	must(err)
 	fmt.Fprint(w, "// Auto-generated from op.go by gen.go.\n\n")
@@ -33,23 +34,39 @@ func main() {
 	}
 	fmt.Fprintln(w, "}")
 
+	fmt.Fprintln(w, "var extName = [...]string{")
+	for _, ext := range exts {
+		fmt.Fprintf(w, "%s: %q,\n", ext, strings.ToLower(ext))
+	}
+	fmt.Fprintln(w, "}")
+
+	fmt.Fprintln(w, "var extCode = map[string]int64{")
+	for _, ext := range exts {
+		fmt.Fprintf(w, "%q: %s,\n", strings.ToLower(ext), ext)
+	}
+	fmt.Fprintln(w, "}")
+
 	must(w.Close())
 	must(exec.Command("gofmt", "-w", "opgen.go").Run())
 }
 
-func getOps() []string {
+// getOps returns the names in the nth top-level const block of op.go.
+func getOps(n int) []string {
 	fset := token.NewFileSet()
 	f, err := parser.ParseFile(fset, "op.go", nil, 0)
 	must(err)
 	var constDecl *ast.GenDecl
 	for _, d := range f.Decls {
 		if gendecl, ok := d.(*ast.GenDecl); ok && gendecl.Tok == token.CONST {
-			constDecl = gendecl
-			break
+			if n == 0 {
+				constDecl = gendecl
+				break
+			}
+			n--
 		}
 	}
 	if constDecl == nil {
-		panic("op.go has no top-level const declaration")
+		panic("op.go has too few top-level const declarations")
 	}
 	var ops []string
 	for _, spec := range constDecl.Specs {
@@ -8,8 +8,8 @@ import (
 
 //go:generate go run gen.go
 //
-// gen.go looks for the first const block in this file
-// and produces opgen.go from it.
+// gen.go looks for the first two const blocks in this file
+// and produces opgen.go from them.
 
 // Names for txvm opcodes.
 // (These symbols use Go-style capitalization.
@@ -88,6 +88,58 @@ const (
 	BitXor  = 0x5e
 )
 
+// Names for txvm extended instructions.
+// An extended instruction is invoked as "x ext",
+// where x is its code.
+// Codes are assigned from the small-integer range first,
+// so that "x ext" is a compact two-byte instruction.
+// Extended instructions are defined only in transaction versions
+// that support them;
+// see txvm.ExtVersion.
+// (The string mnemonics handled by functions ExtCode and ExtName
+// are all-lowercase, as for ordinary opcodes.)
+const (
+	BlockTime     = 0x00
+	CheckSigPH    = 0x01
+	ModExp        = 0x02
+	Finalized     = 0x03
+	IntBytes      = 0x04
+	MerkleVerify  = 0x05
+	UniqueToken   = 0x06
+	HashToCurve   = 0x07
+	TypedField    = 0x08
+	PrevBlock     = 0x09
+	RevBytes      = 0x0a
+	SplitBytes    = 0x0b
+	HMACSHA256    = 0x0c
+	TupleCat      = 0x0d
+	InputIndex    = 0x0e
+	TxNonce       = 0x0f
+	Min           = 0x10
+	Max           = 0x11
+	All           = 0x12
+	Any           = 0x13
+	CheckMultisig = 0x14
+	HasPrefix     = 0x15
+	HasSuffix     = 0x16
+	ProgramHash   = 0x17
+	DropIf        = 0x18
+	FinalAnchor   = 0x19
+	BytesInt      = 0x1a
+	VerifyDepth   = 0x1b
+	KeyCommit     = 0x1c
+	CheckAggSig   = 0x1d
+	RotL          = 0x1e
+	RotR          = 0x1f
+	Map           = 0x20
+	InRange       = 0x21
+	PopCount      = 0x22
+	IsUTF8        = 0x23
+	PadL          = 0x24
+	PadR          = 0x25
+	Clear         = 0x26
+)
+
 // The first few integers can be represented with dedicated
 // opcodes. Outside of this range it's necessary to push the encoding
 // of an integer as a byte string, then convert it to an integer with
@@ -124,6 +176,22 @@ func Code(name string) (byte, bool) {
 	return v, ok
 }
 
+// ExtName returns the name of the extended instruction with the
+// given code, or the empty string if code is unassigned.
+func ExtName(code int64) string {
+	if code < 0 || code >= int64(len(extName)) {
+		return ""
+	}
+	return extName[code]
+}
+
+// ExtCode returns the extended-instruction code for the given name,
+// or false if name is unknown.
+func ExtCode(name string) (int64, bool) {
+	v, ok := extCode[name]
+	return v, ok
+}
+
 // IsSmallIntOp tells whether the given opcode is one of the
 // small-integer-encoding instructions.
 func IsSmallIntOp(o byte) bool {
@@ -76,6 +76,56 @@ func TestOpcodeVals(t *testing.T) {
 			t.Errorf("%s: %d is not %d\n", name[c.symbolic], c.symbolic, c.numeric)
 		}
 	}
+
+	extCases := []struct {
+		symbolic, numeric int
+	}{
+		{BlockTime, 0x00},
+		{CheckSigPH, 0x01},
+		{ModExp, 0x02},
+		{Finalized, 0x03},
+		{IntBytes, 0x04},
+		{MerkleVerify, 0x05},
+		{UniqueToken, 0x06},
+		{HashToCurve, 0x07},
+		{TypedField, 0x08},
+		{PrevBlock, 0x09},
+		{RevBytes, 0x0a},
+		{SplitBytes, 0x0b},
+		{HMACSHA256, 0x0c},
+		{TupleCat, 0x0d},
+		{InputIndex, 0x0e},
+		{TxNonce, 0x0f},
+		{Min, 0x10},
+		{Max, 0x11},
+		{All, 0x12},
+		{Any, 0x13},
+		{CheckMultisig, 0x14},
+		{HasPrefix, 0x15},
+		{HasSuffix, 0x16},
+		{ProgramHash, 0x17},
+		{DropIf, 0x18},
+		{FinalAnchor, 0x19},
+		{BytesInt, 0x1a},
+		{VerifyDepth, 0x1b},
+		{KeyCommit, 0x1c},
+		{CheckAggSig, 0x1d},
+		{RotL, 0x1e},
+		{RotR, 0x1f},
+		{Map, 0x20},
+		{InRange, 0x21},
+		{PopCount, 0x22},
+		{IsUTF8, 0x23},
+		{PadL, 0x24},
+		{PadR, 0x25},
+		{Clear, 0x26},
+	}
+	for _, c := range extCases {
+		if c.symbolic != c.numeric {
+			t.Errorf("%s: %d is not %d\n", extName[c.symbolic], c.symbolic, c.numeric)
+		}
+	}
+
 	if MaxSmallInt != 0x1f {
 		t.Errorf("MaxSmallInt is %d, want %d\n", MaxSmallInt, 0x1f)
 	}
@@ -132,3 +132,85 @@ var code = map[string]byte{
 	"bitor":           BitOr,
 	"bitxor":          BitXor,
 }
+var extName = [...]string{
+	BlockTime:     "blocktime",
+	CheckSigPH:    "checksigph",
+	ModExp:        "modexp",
+	Finalized:     "finalized",
+	IntBytes:      "intbytes",
+	MerkleVerify:  "merkleverify",
+	UniqueToken:   "uniquetoken",
+	HashToCurve:   "hashtocurve",
+	TypedField:    "typedfield",
+	PrevBlock:     "prevblock",
+	RevBytes:      "revbytes",
+	SplitBytes:    "splitbytes",
+	HMACSHA256:    "hmacsha256",
+	TupleCat:      "tuplecat",
+	InputIndex:    "inputindex",
+	TxNonce:       "txnonce",
+	Min:           "min",
+	Max:           "max",
+	All:           "all",
+	Any:           "any",
+	CheckMultisig: "checkmultisig",
+	HasPrefix:     "hasprefix",
+	HasSuffix:     "hassuffix",
+	ProgramHash:   "programhash",
+	DropIf:        "dropif",
+	FinalAnchor:   "finalanchor",
+	BytesInt:      "bytesint",
+	VerifyDepth:   "verifydepth",
+	KeyCommit:     "keycommit",
+	CheckAggSig:   "checkaggsig",
+	RotL:          "rotl",
+	RotR:          "rotr",
+	Map:           "map",
+	InRange:       "inrange",
+	PopCount:      "popcount",
+	IsUTF8:        "isutf8",
+	PadL:          "padl",
+	PadR:          "padr",
+	Clear:         "clear",
+}
+var extCode = map[string]int64{
+	"blocktime":     BlockTime,
+	"checksigph":    CheckSigPH,
+	"modexp":        ModExp,
+	"finalized":     Finalized,
+	"intbytes":      IntBytes,
+	"merkleverify":  MerkleVerify,
+	"uniquetoken":   UniqueToken,
+	"hashtocurve":   HashToCurve,
+	"typedfield":    TypedField,
+	"prevblock":     PrevBlock,
+	"revbytes":      RevBytes,
+	"splitbytes":    SplitBytes,
+	"hmacsha256":    HMACSHA256,
+	"tuplecat":      TupleCat,
+	"inputindex":    InputIndex,
+	"txnonce":       TxNonce,
+	"min":           Min,
+	"max":           Max,
+	"all":           All,
+	"any":           Any,
+	"checkmultisig": CheckMultisig,
+	"hasprefix":     HasPrefix,
+	"hassuffix":     HasSuffix,
+	"programhash":   ProgramHash,
+	"dropif":        DropIf,
+	"finalanchor":   FinalAnchor,
+	"bytesint":      BytesInt,
+	"verifydepth":   VerifyDepth,
+	"keycommit":     KeyCommit,
+	"checkaggsig":   CheckAggSig,
+	"rotl":          RotL,
+	"rotr":          RotR,
+	"map":           Map,
+	"inrange":       InRange,
+	"popcount":      PopCount,
+	"isutf8":        IsUTF8,
+	"padl":          PadL,
+	"padr":          PadR,
+	"clear":         Clear,
+}
@@ -71,3 +71,47 @@ func init() {
 	opFuncs[op.BitOr] = opBitOr
 	opFuncs[op.BitXor] = opBitXor
 }
+
+var extFuncs [256]func(*VM)
+
+func init() {
+	extFuncs[op.BlockTime] = opBlockTime
+	extFuncs[op.CheckSigPH] = opCheckSigPH
+	extFuncs[op.ModExp] = opModExp
+	extFuncs[op.Finalized] = opFinalized
+	extFuncs[op.IntBytes] = opIntBytes
+	extFuncs[op.MerkleVerify] = opMerkleVerify
+	extFuncs[op.UniqueToken] = opUniqueToken
+	extFuncs[op.HashToCurve] = opHashToCurve
+	extFuncs[op.TypedField] = opTypedField
+	extFuncs[op.PrevBlock] = opPrevBlock
+	extFuncs[op.RevBytes] = opRevBytes
+	extFuncs[op.SplitBytes] = opSplitBytes
+	extFuncs[op.HMACSHA256] = opHMACSHA256
+	extFuncs[op.TupleCat] = opTupleCat
+	extFuncs[op.InputIndex] = opInputIndex
+	extFuncs[op.TxNonce] = opTxNonce
+	extFuncs[op.Min] = opMin
+	extFuncs[op.Max] = opMax
+	extFuncs[op.All] = opAll
+	extFuncs[op.Any] = opAny
+	extFuncs[op.CheckMultisig] = opCheckMultisig
+	extFuncs[op.HasPrefix] = opHasPrefix
+	extFuncs[op.HasSuffix] = opHasSuffix
+	extFuncs[op.ProgramHash] = opProgramHash
+	extFuncs[op.DropIf] = opDropIf
+	extFuncs[op.FinalAnchor] = opFinalAnchor
+	extFuncs[op.BytesInt] = opBytesInt
+	extFuncs[op.VerifyDepth] = opVerifyDepth
+	extFuncs[op.KeyCommit] = opKeyCommit
+	extFuncs[op.CheckAggSig] = opCheckAggSig
+	extFuncs[op.RotL] = opRotL
+	extFuncs[op.RotR] = opRotR
+	extFuncs[op.Map] = opMap
+	extFuncs[op.InRange] = opInRange
+	extFuncs[op.PopCount] = opPopCount
+	extFuncs[op.IsUTF8] = opIsUTF8
+	extFuncs[op.PadL] = opPadL
+	extFuncs[op.PadR] = opPadR
+	extFuncs[op.Clear] = opClear
+}
@@ -3,6 +3,7 @@ package txvm
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/chain/txvm/protocol/txvm/op"
 )
@@ -59,6 +60,125 @@ func EnableExtension(vm *VM) {
 	vm.extension = true
 }
 
+// BlockTime can be passed as an option to Validate when evaluating a
+// block predicate. It makes the timestamp, in milliseconds, of the
+// block being validated available to the blocktime extended
+// instruction. Outside of block-predicate evaluation, blocktime
+// fails.
+func BlockTime(timestampMS uint64) Option {
+	return func(vm *VM) {
+		if vm.block == nil {
+			vm.block = new(blockContext)
+		}
+		vm.block.timestampMS = int64(timestampMS)
+	}
+}
+
+// PrevBlock can be passed as an option to Validate when evaluating a
+// block predicate. It makes the height, timestamp (in milliseconds),
+// and ID of the block preceding the one being validated available to
+// the prevblock extended instruction. Outside of block-predicate
+// evaluation, prevblock fails.
+func PrevBlock(height, timestampMS uint64, id []byte) Option {
+	return func(vm *VM) {
+		if vm.block == nil {
+			vm.block = new(blockContext)
+		}
+		vm.block.prev = Tuple{Int(height), Int(timestampMS), Bytes(id)}
+	}
+}
+
+// WithClock can be passed as an option to Validate. It fixes the
+// VM's notion of the current time, in milliseconds, to now, for
+// reproducible simulation of time-dependent contracts. Each time
+// range logged (by timerange or nonce) must then contain now, or
+// execution fails with ErrTimeRange; and the blocktime extended
+// instruction produces now, even outside of block-predicate
+// evaluation.
+//
+// Without this option, time ranges are checked only later, against
+// the timestamp of the block containing the transaction.
+func WithClock(now int64) Option {
+	return func(vm *VM) {
+		vm.clock = &now
+	}
+}
+
+// WithFailureSnapshot can be passed as an option to Validate. When an
+// instruction fails, it causes the error returned by Validate to
+// carry a FailureSnapshot of the VM state, retrieved with Failure.
+// It copies the stacks before every instruction, in case that
+// instruction fails, so each step costs time proportional to the
+// size of the stacks. It is meant for debugging, not validation.
+func WithFailureSnapshot(vm *VM) {
+	vm.snapshotOnFailure = true
+}
+
+// WithMaxProgramLen can be passed as an option to Validate. It causes
+// Validate to fail with ErrProgramLen, before executing anything, if
+// the program is longer than n bytes. This is a cheap guard against
+// oversized programs, independent of the runlimit. A limit of zero or
+// less has no effect.
+func WithMaxProgramLen(n int) Option {
+	return func(vm *VM) {
+		vm.maxProgramLen = n
+	}
+}
+
+// WithMaxCallDepth can be passed as an option to Validate. It causes
+// execution to fail with ErrCallDepth when exec and call instructions
+// nest more than n deep, replacing the default (DefaultMaxCallDepth
+// for transaction versions ExtVersion and later, none before). A
+// limit of zero or less removes the bound.
+func WithMaxCallDepth(n int) Option {
+	return func(vm *VM) {
+		vm.maxCallDepth = n
+	}
+}
+
+// WithPeakStackDepth can be passed as an option to Validate. It
+// causes f to be called on exit with the greatest combined depth of
+// the stacks observed after any instruction: the number of items on
+// the argument stack and on the stacks of the running contract and
+// of each contract suspended by call, and the items map sets aside
+// while it runs its program. Items inside a contract on a stack
+// count once, as the contract.
+func WithPeakStackDepth(f func(peak int)) Option {
+	return func(vm *VM) {
+		var (
+			peak      int
+			suspended int   // items on the stacks of suspended contracts
+			pending   []int // items each unfinished instruction suspended
+		)
+		vm.beforeStep = append(vm.beforeStep, func(vm *VM) {
+			var n int
+			switch {
+			case vm.opcode == op.Call:
+				// The caller's stack, less the contract being called.
+				n = len(vm.contract.stack) - 1
+			case vm.opcode == op.Ext && vm.txVersion >= ExtVersion && vm.contract.stack.Len() >= 3:
+				// Map sets aside the stack below its tuple,
+				// program, and instruction code.
+				if code, ok := vm.peek().(Int); ok && code == op.Map {
+					n = len(vm.contract.stack) - 3
+				}
+			}
+			suspended += n
+			pending = append(pending, n)
+		})
+		vm.afterStep = append(vm.afterStep, func(vm *VM) {
+			suspended -= pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if d := suspended + len(vm.contract.stack) + len(vm.argstack); d > peak {
+				peak = d
+			}
+		})
+		vm.onExit = append(vm.onExit, func(*VM) {
+			f(peak)
+		})
+	}
+}
+
 // GetRunlimit causes the vm to write its ending runlimit to the given
 // pointer on exit.
 func GetRunlimit(runlimit *int64) Option {
@@ -126,3 +246,162 @@ func Trace(w io.Writer) Option {
 		})
 	}
 }
+
+// debugLogStackItems is the number of items, from the top of the
+// contract stack, shown by WithDebugLog.
+const debugLogStackItems = 4
+
+// WithDebugLog can be passed as an option to Validate. It causes
+// each executed instruction to be written to w, one per line, in
+// assembly-language form, indented by contract call depth and
+// followed by a summary of the contract stack after it executes: the
+// number of items and the topmost few. It is a more compact
+// alternative to Trace.
+func WithDebugLog(w io.Writer) Option {
+	return func(vm *VM) {
+		// Instructions such as call run others before they finish,
+		// so keep the pending instructions on a stack.
+		type pending struct {
+			pc   int64
+			inst string
+		}
+		var insts []pending
+		vm.beforeStep = append(vm.beforeStep, func(vm *VM) {
+			var inst string
+			switch {
+			case op.IsSmallIntOp(vm.opcode):
+				inst = fmt.Sprintf("%d", vm.opcode-op.MinSmallInt)
+			case op.IsPushdataOp(vm.opcode):
+				inst = Bytes(vm.data).String()
+			default:
+				inst = op.Name(vm.opcode)
+			}
+			insts = append(insts, pending{vm.run.pc, inst})
+		})
+		vm.afterStep = append(vm.afterStep, func(vm *VM) {
+			p := insts[len(insts)-1]
+			insts = insts[:len(insts)-1]
+
+			stack := vm.contract.stack
+			var items []string
+			if len(stack) > debugLogStackItems {
+				items = append(items, "...")
+			}
+			for i := len(stack) - debugLogStackItems; i < len(stack); i++ {
+				if i >= 0 {
+					items = append(items, stack[i].String())
+				}
+			}
+			indent := strings.Repeat("  ", len(insts))
+			fmt.Fprintf(w, "%s%d: %s\t(%d) [%s]\n", indent, p.pc, p.inst, len(stack), strings.Join(items, " "))
+		})
+	}
+}
+
+// AnchorEvent describes a value-flow instruction, as reported by
+// TraceAnchors.
+type AnchorEvent struct {
+	// Op is the instruction's opcode: op.Nonce, op.Issue, op.Split,
+	// op.Merge, op.Retire, or op.Finalize.
+	Op byte
+
+	// Consumed and Created are the labels of the anchors of the
+	// values the instruction took from and left on the contract
+	// stack, from the top of the stack down.
+	Consumed, Created []string
+}
+
+// TraceAnchors can be passed as an option to Validate. It causes f to
+// be called after each nonce, issue, split, merge, retire, and
+// finalize instruction with an AnchorEvent naming the anchors involved, so
+// that the flow of value through a program can be followed.
+//
+// An anchor is named by its label in labels, if it has one. Otherwise
+// an anchor made by split or merge is named after the anchors it was
+// made from, as split1(a), split2(a), or merge(a,b); an issued value
+// keeps the anchor, and so the label, of the value it was issued
+// from; and any other anchor, such as one made by nonce or brought in
+// by input, is named by the hex encoding of its first 4 bytes. The
+// labels map is not modified.
+func TraceAnchors(labels map[[32]byte]string, f func(AnchorEvent)) Option {
+	return func(vm *VM) {
+		names := make(map[[32]byte]string, len(labels))
+		for anchor, label := range labels {
+			names[anchor] = label
+		}
+		name := func(anchor []byte) string {
+			var a [32]byte
+			copy(a[:], anchor)
+			if label, ok := names[a]; ok {
+				return label
+			}
+			return fmt.Sprintf("%x", anchor[:4])
+		}
+		// topValues returns the anchors of the n values starting
+		// skip items below the top of the contract stack.
+		topValues := func(vm *VM, skip, n int) [][]byte {
+			var anchors [][]byte
+			for i := 0; i < n; i++ {
+				v, ok := vm.contract.stack.peek(int64(skip + i))
+				if !ok {
+					return nil
+				}
+				val, ok := v.(*value)
+				if !ok {
+					return nil
+				}
+				anchors = append(anchors, val.anchor)
+			}
+			return anchors
+		}
+
+		var consumed [][]byte
+		vm.beforeStep = append(vm.beforeStep, func(vm *VM) {
+			switch vm.opcode {
+			case op.Issue:
+				consumed = topValues(vm, 2, 1)
+			case op.Split:
+				consumed = topValues(vm, 1, 1)
+			case op.Merge:
+				consumed = topValues(vm, 0, 2)
+			case op.Retire, op.Finalize:
+				consumed = topValues(vm, 0, 1)
+			default:
+				consumed = nil
+			}
+		})
+		vm.afterStep = append(vm.afterStep, func(vm *VM) {
+			var created [][]byte
+			switch vm.opcode {
+			case op.Nonce, op.Issue, op.Merge:
+				created = topValues(vm, 0, 1)
+			case op.Split:
+				created = topValues(vm, 0, 2)
+			case op.Retire, op.Finalize:
+			default:
+				return
+			}
+
+			ev := AnchorEvent{Op: vm.opcode}
+			for _, anchor := range consumed {
+				ev.Consumed = append(ev.Consumed, name(anchor))
+			}
+			for i, anchor := range created {
+				var a [32]byte
+				copy(a[:], anchor)
+				if _, ok := names[a]; !ok {
+					switch vm.opcode {
+					case op.Split:
+						// The remainder, made with Split1, is below the
+						// split-off value, made with Split2.
+						names[a] = fmt.Sprintf("split%d(%s)", 2-i, ev.Consumed[0])
+					case op.Merge:
+						names[a] = fmt.Sprintf("merge(%s,%s)", ev.Consumed[0], ev.Consumed[1])
+					}
+				}
+				ev.Created = append(ev.Created, name(anchor))
+			}
+			f(ev)
+		})
+	}
+}
@@ -994,6 +994,24 @@ func TestSimpleOpcodes(t *testing.T) {
 			opcode:  op.Tuple,
 			wanterr: ErrUnderflow,
 		},
+		{
+			name:   "empty tuple",
+			pre:    stack{Bytes("hi"), Int(0)},
+			opcode: op.Tuple,
+			post:   stack{Bytes("hi"), Tuple{}},
+		},
+		{
+			name:    "tuple fail count exceeds stack",
+			pre:     stack{Bytes("hi"), Int(7), Int(3)},
+			opcode:  op.Tuple,
+			wanterr: ErrUnderflow,
+		},
+		{
+			name:    "tuple fail negative count",
+			pre:     stack{Bytes("hi"), Int(-1)},
+			opcode:  op.Tuple,
+			wanterr: ErrUnderflow,
+		},
 		{
 			name:   "untuple ints",
 			pre:    stack{Tuple{Int(1000), Int(3), Int(7)}},
@@ -1006,6 +1024,24 @@ func TestSimpleOpcodes(t *testing.T) {
 			opcode: op.Untuple,
 			post:   stack{Bytes("hi"), Bytes("bye"), Int(2)},
 		},
+		{
+			name:   "untuple nested",
+			pre:    stack{Tuple{Int(1), Tuple{Bytes("a"), Int(2)}, Tuple{}}},
+			opcode: op.Untuple,
+			post:   stack{Int(1), Tuple{Bytes("a"), Int(2)}, Tuple{}, Int(3)},
+		},
+		{
+			name:   "untuple empty",
+			pre:    stack{Tuple{}},
+			opcode: op.Untuple,
+			post:   stack{Int(0)},
+		},
+		{
+			name:    "untuple fail type",
+			pre:     stack{Bytes("hi")},
+			opcode:  op.Untuple,
+			wanterr: ErrType,
+		},
 		{
 			name:    "untuple fail",
 			pre:     stack{},
@@ -1024,6 +1060,30 @@ func TestSimpleOpcodes(t *testing.T) {
 			opcode: op.Len,
 			post:   stack{Int(2)},
 		},
+		{
+			name:   "len empty bytes",
+			pre:    stack{Bytes{}},
+			opcode: op.Len,
+			post:   stack{Int(0)},
+		},
+		{
+			name:   "len empty tuple",
+			pre:    stack{Tuple{}},
+			opcode: op.Len,
+			post:   stack{Int(0)},
+		},
+		{
+			name:   "len nested tuple",
+			pre:    stack{Tuple{Tuple{Int(1), Int(2)}, Tuple{}, Int(3)}},
+			opcode: op.Len,
+			post:   stack{Int(3)},
+		},
+		{
+			name:    "len int fail",
+			pre:     stack{Int(7)},
+			opcode:  op.Len,
+			wanterr: ErrType,
+		},
 		{
 			name:    "len fail",
 			pre:     stack{},
@@ -1318,3 +1378,103 @@ func mustDecodeHex(s string) []byte {
 	}
 	return out
 }
+
+func TestLenCost(t *testing.T) {
+	cost := func(item Item) int64 {
+		prog := []byte{op.Len}
+		vm := &VM{
+			txVersion: 3,
+			runlimit:  int64(1000000),
+			contract:  &contract{seed: make([]byte, 32), program: prog, stack: stack{item}},
+		}
+		err := vm.recoverExec(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return 1000000 - vm.runlimit
+	}
+
+	small := cost(Tuple{Int(1)})
+	big := cost(make(Tuple, 1000))
+	if small != big {
+		t.Errorf("len of 1000-tuple costs %d, len of 1-tuple costs %d", big, small)
+	}
+}
+
+func TestUntupleCost(t *testing.T) {
+	cost := func(item Item) int64 {
+		prog := []byte{op.Untuple}
+		vm := &VM{
+			txVersion: 3,
+			runlimit:  int64(1000000),
+			contract:  &contract{seed: make([]byte, 32), program: prog, stack: stack{item}},
+		}
+		err := vm.recoverExec(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return 1000000 - vm.runlimit
+	}
+
+	small := cost(Tuple{Int(1)})
+	big := cost(make(Tuple, 1001))
+	if big-small != 1000 {
+		t.Errorf("untuple of 1001-tuple costs %d, of 1-tuple %d; want a difference of 1000", big, small)
+	}
+	nested := cost(Tuple{make(Tuple, 1000)})
+	if nested != small {
+		t.Errorf("untuple of 1-tuple holding a 1000-tuple costs %d, want %d", nested, small)
+	}
+}
+
+func TestAllAnyCost(t *testing.T) {
+	cost := func(code byte, item Item) int64 {
+		prog := []byte{code, op.Ext}
+		vm := &VM{
+			txVersion: ExtVersion,
+			runlimit:  int64(1000000),
+			contract:  &contract{seed: make([]byte, 32), program: prog, stack: stack{item}},
+		}
+		err := vm.recoverExec(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return 1000000 - vm.runlimit
+	}
+
+	for _, code := range []byte{op.All, op.Any} {
+		small := cost(code, Tuple{Int(1)})
+		big := cost(code, make(Tuple, 1001))
+		if big-small != 1000 {
+			t.Errorf("%s of 1001-tuple costs %d, of 1-tuple %d; want a difference of 1000", op.ExtName(int64(code)), big, small)
+		}
+	}
+}
+
+func TestHasPrefixCost(t *testing.T) {
+	cost := func(code byte, str, candidate Bytes) int64 {
+		prog := []byte{code, op.Ext}
+		vm := &VM{
+			txVersion: ExtVersion,
+			runlimit:  int64(1000000),
+			contract:  &contract{seed: make([]byte, 32), program: prog, stack: stack{str, candidate}},
+		}
+		err := vm.recoverExec(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return 1000000 - vm.runlimit
+	}
+
+	str := make(Bytes, 2000)
+	for _, code := range []byte{op.HasPrefix, op.HasSuffix} {
+		small := cost(code, str, make(Bytes, 1))
+		big := cost(code, str, make(Bytes, 1001))
+		if big-small != 1000 {
+			t.Errorf("%s with 1001-byte candidate costs %d, with 1-byte %d; want a difference of 1000", op.ExtName(int64(code)), big, small)
+		}
+		if c := cost(code, str[:1], make(Bytes, 1001)); c != big {
+			t.Errorf("%s with overlong candidate costs %d, want %d", op.ExtName(int64(code)), c, big)
+		}
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"github.com/chain/txvm/errors"
 )
 
+// ErrStackDepth is returned by verifydepth when the contract stack
+// does not have the expected number of items.
+var ErrStackDepth = errorf("unexpected contract stack depth")
+
 type stack []Item
 
 func (s stack) String() string {
@@ -127,3 +131,10 @@ func opPeek(vm *VM) {
 	vm.chargeCopy(item)
 	vm.push(item)
 }
+
+func opVerifyDepth(vm *VM) {
+	n := int64(vm.popInt())
+	if depth := int64(vm.contract.stack.Len()); depth != n {
+		panic(errors.WithData(ErrStackDepth, "want", n, "got", depth))
+	}
+}
@@ -1,6 +1,11 @@
 package txvm
 
-import "github.com/chain/txvm/errors"
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/chain/txvm/errors"
+)
 
 // ErrSliceRange is returned when slice is called with
 // a range that is invalid.
@@ -15,6 +20,110 @@ func opCat(vm *VM) {
 	vm.push(c)
 }
 
+func opSplitBytes(vm *VM) {
+	i := int64(vm.popInt())
+	str := vm.popBytes()
+	if i < 0 || i > int64(len(str)) {
+		panic(errors.WithData(ErrSliceRange, "index", i, "len(bytes)", len(str)))
+	}
+	head := append(Bytes{}, str[:i]...)
+	tail := append(Bytes{}, str[i:]...)
+	vm.chargeCreate(head)
+	vm.chargeCreate(tail)
+	vm.push(head)
+	vm.push(tail)
+}
+
+func opRevBytes(vm *VM) {
+	a := vm.popBytes()
+	b := make(Bytes, len(a))
+	for i, c := range a {
+		b[len(a)-1-i] = c
+	}
+	vm.chargeCreate(b)
+	vm.push(b)
+}
+
+func opIsUTF8(vm *VM) {
+	str := vm.popBytes()
+	vm.charge(int64(len(str)))
+	vm.pushBool(utf8.Valid(str))
+}
+
+func opRotL(vm *VM) {
+	vm.rotate(false)
+}
+
+func opRotR(vm *VM) {
+	vm.rotate(true)
+}
+
+// rotate implements rotl and rotr: it pops a count n and a string,
+// and pushes a copy of the string rotated by n bytes, modulo its
+// length.
+func (vm *VM) rotate(right bool) {
+	n := int64(vm.popInt())
+	str := vm.popBytes()
+	if n < 0 {
+		panic(errors.WithData(ErrRange, "count", n))
+	}
+	b := make(Bytes, 0, len(str))
+	if len(str) > 0 {
+		i := n % int64(len(str))
+		if right && i > 0 {
+			i = int64(len(str)) - i
+		}
+		b = append(append(b, str[i:]...), str[:i]...)
+	}
+	vm.chargeCreate(b)
+	vm.push(b)
+}
+
+func opPadL(vm *VM) {
+	vm.pad(true)
+}
+
+func opPadR(vm *VM) {
+	vm.pad(false)
+}
+
+// pad implements padl and padr: it pops a pad byte, a length n, and
+// a string, and pushes a copy of the string extended to n bytes with
+// copies of the pad byte, on the left or the right. A string already
+// at least n bytes long is unchanged.
+func (vm *VM) pad(left bool) {
+	c := int64(vm.popInt())
+	n := int64(vm.popInt())
+	str := vm.popBytes()
+	if c < 0 || c > 255 {
+		panic(errors.WithData(ErrRange, "pad byte", c))
+	}
+	if n < 0 {
+		panic(errors.WithData(ErrRange, "length", n))
+	}
+	if n < int64(len(str)) {
+		n = int64(len(str))
+	}
+
+	// Charge for the result before allocating it, so that a large n
+	// fails on the runlimit rather than exhausting memory.
+	cost, ok := stringCost(n)
+	if !ok {
+		panic(errors.Wrap(ErrIntOverflow, "charging create cost"))
+	}
+	vm.charge(cost)
+
+	b := make(Bytes, 0, n)
+	if left {
+		b = append(b, bytes.Repeat([]byte{byte(c)}, int(n)-len(str))...)
+	}
+	b = append(b, str...)
+	if !left {
+		b = append(b, bytes.Repeat([]byte{byte(c)}, int(n)-len(str))...)
+	}
+	vm.push(b)
+}
+
 func opSlice(vm *VM) {
 	end := int64(vm.popInt())
 	start := int64(vm.popInt())
@@ -26,3 +135,17 @@ func opSlice(vm *VM) {
 	vm.chargeCreate(str2)
 	vm.push(str2)
 }
+
+func opHasPrefix(vm *VM) {
+	prefix := vm.popBytes()
+	str := vm.popBytes()
+	vm.charge(int64(len(prefix)))
+	vm.pushBool(bytes.HasPrefix(str, prefix))
+}
+
+func opHasSuffix(vm *VM) {
+	suffix := vm.popBytes()
+	str := vm.popBytes()
+	vm.charge(int64(len(suffix)))
+	vm.pushBool(bytes.HasSuffix(str, suffix))
+}
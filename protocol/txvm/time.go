@@ -1,7 +1,62 @@
 package txvm
 
+import "github.com/chain/txvm/errors"
+
+var (
+	// ErrBlockContext is returned when a block-context instruction
+	// such as blocktime is executed outside of block-predicate
+	// evaluation.
+	ErrBlockContext = errorf("no block context")
+
+	// ErrTimeRange is returned when a time range is logged that
+	// excludes the time fixed with the WithClock option.
+	ErrTimeRange = errorf("time range excludes current time")
+)
+
+// blockContext holds information about the block whose predicate is
+// being evaluated.
+type blockContext struct {
+	timestampMS int64
+
+	// prev is {height, timestampMS, id} for the preceding block, or
+	// nil if unknown.
+	prev Tuple
+}
+
 func opTimeRange(vm *VM) {
 	max := vm.popInt()
 	min := vm.popInt()
 	vm.logTimeRange(min, max)
 }
+
+func opBlockTime(vm *VM) {
+	if vm.clock != nil {
+		vm.push(Int(*vm.clock))
+		return
+	}
+	if vm.block == nil {
+		panic(ErrBlockContext)
+	}
+	vm.push(Int(vm.block.timestampMS))
+}
+
+func opPrevBlock(vm *VM) {
+	if vm.block == nil || vm.block.prev == nil {
+		panic(errors.Wrap(ErrBlockContext, "no previous block"))
+	}
+	vm.chargeCreate(vm.block.prev)
+	vm.push(vm.block.prev)
+}
+
+// checkClock fails if vm has a fixed clock outside the time range
+// [mintime, maxtime]. As in block validation, a bound of zero is
+// no bound.
+func (vm *VM) checkClock(mintime, maxtime Int) {
+	if vm.clock == nil {
+		return
+	}
+	now := Int(*vm.clock)
+	if (mintime > 0 && now < mintime) || (maxtime > 0 && now > maxtime) {
+		panic(errors.WithData(ErrTimeRange, "now", now, "min", mintime, "max", maxtime))
+	}
+}
@@ -5,7 +5,8 @@ import (
 	"github.com/chain/txvm/protocol/merkle"
 )
 
-// ErrUnfinalized is returned when txid is called before finalize.
+// ErrUnfinalized is returned when txid, txnonce, or finalanchor is
+// called before finalize.
 var ErrUnfinalized = errorf("cannot be called until after finalize")
 
 func opFinalize(vm *VM) {
@@ -24,6 +25,10 @@ func opFinalize(vm *VM) {
 	vm.runHooks(vm.onFinalize)
 }
 
+func opFinalized(vm *VM) {
+	vm.pushBool(vm.Finalized)
+}
+
 func opTxID(vm *VM) {
 	if !vm.Finalized {
 		panic(errors.Wrap(ErrUnfinalized, "txid"))
@@ -31,3 +36,30 @@ func opTxID(vm *VM) {
 	vm.chargeCopy(Bytes(vm.TxID[:]))
 	vm.push(Bytes(vm.TxID[:]))
 }
+
+func opFinalAnchor(vm *VM) {
+	if !vm.Finalized {
+		panic(errors.Wrap(ErrUnfinalized, "finalanchor"))
+	}
+	// Nothing can be logged after finalize, so its log entry is the
+	// last one.
+	entry := vm.Log[len(vm.Log)-1]
+	anchor := entry[3].(Bytes)
+	vm.chargeCopy(anchor)
+	vm.push(anchor)
+}
+
+func opTxNonce(vm *VM) {
+	if !vm.Finalized {
+		panic(errors.Wrap(ErrUnfinalized, "txnonce"))
+	}
+	n := TxNonce(vm.TxID)
+	vm.chargeCreate(Bytes(n[:]))
+	vm.push(Bytes(n[:]))
+}
+
+// TxNonce computes the value produced by the txnonce instruction in
+// the transaction with the given ID.
+func TxNonce(txid [32]byte) [32]byte {
+	return VMHash("TxNonce", txid[:])
+}
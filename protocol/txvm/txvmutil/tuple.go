@@ -0,0 +1,153 @@
+package txvmutil
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+// ErrDecode is returned by Decode and DecodeTuple when a program is
+// not the encoding of a single data item.
+var ErrDecode = errors.New("invalid data encoding")
+
+// PushdataData writes instructions to b pushing d onto the stack,
+// in the form produced by txvm.Encode.
+func (b *Builder) PushdataData(d txvm.Data) *Builder {
+	b.buf.Write(txvm.Encode(d))
+	return b
+}
+
+// PushdataData writes instructions to b pushing d onto the stack,
+// in the form produced by txvm.Encode.
+func (tb *TupleBuilder) PushdataData(d txvm.Data) *TupleBuilder {
+	tb.b.PushdataData(d)
+	tb.count++
+	return tb
+}
+
+// MakeTuple converts vals to a txvm tuple.
+// Each value may be an int, int64, uint64, []byte, string,
+// txvm.Data, or []interface{} (which becomes a nested tuple
+// by the same rules).
+func MakeTuple(vals ...interface{}) (txvm.Tuple, error) {
+	t := make(txvm.Tuple, 0, len(vals))
+	for i, v := range vals {
+		var d txvm.Data
+		switch v := v.(type) {
+		case int:
+			d = txvm.Int(v)
+		case int64:
+			d = txvm.Int(v)
+		case uint64:
+			if v > math.MaxInt64 {
+				return nil, errors.WithDetailf(txvm.ErrIntOverflow, "item %d: %d does not fit in int64", i, v)
+			}
+			d = txvm.Int(v)
+		case []byte:
+			d = txvm.Bytes(v)
+		case string:
+			d = txvm.Bytes(v)
+		case txvm.Data:
+			d = v
+		case []interface{}:
+			inner, err := MakeTuple(v...)
+			if err != nil {
+				return nil, errors.Wrapf(err, "item %d", i)
+			}
+			d = inner
+		default:
+			return nil, errors.WithDetailf(txvm.ErrType, "item %d: cannot convert %T", i, v)
+		}
+		t = append(t, d)
+	}
+	return t, nil
+}
+
+// EncodeTuple converts vals to a txvm tuple, as with MakeTuple, and
+// returns its encoding: a program that, when executed, pushes the
+// tuple.
+func EncodeTuple(vals ...interface{}) ([]byte, error) {
+	t, err := MakeTuple(vals...)
+	if err != nil {
+		return nil, err
+	}
+	return txvm.Encode(t), nil
+}
+
+// Decode parses prog as the encoding of a single data item and
+// returns that item. It accepts the output of txvm.Encode and of the
+// Builder pushdata and Tuple operations.
+func Decode(prog []byte) (txvm.Data, error) {
+	var stack []txvm.Data
+	for len(prog) > 0 {
+		opcode, data, n, err := op.DecodeInst(prog)
+		if err != nil {
+			return nil, errors.Sub(ErrDecode, err)
+		}
+		prog = prog[n:]
+
+		switch {
+		case op.IsSmallIntOp(opcode):
+			stack = append(stack, txvm.Int(opcode-op.MinSmallInt))
+		case op.IsPushdataOp(opcode):
+			stack = append(stack, txvm.Bytes(data))
+		case opcode == op.Int:
+			if len(stack) == 0 {
+				return nil, errors.WithDetail(ErrDecode, "int: stack underflow")
+			}
+			b, ok := stack[len(stack)-1].(txvm.Bytes)
+			if !ok {
+				return nil, errors.WithDetail(ErrDecode, "int: want bytes")
+			}
+			v, m := binary.Uvarint(b)
+			if m <= 0 || m != len(b) {
+				return nil, errors.WithDetailf(ErrDecode, "int: invalid varint %x", []byte(b))
+			}
+			stack[len(stack)-1] = txvm.Int(v)
+		case opcode == op.Neg:
+			if len(stack) == 0 {
+				return nil, errors.WithDetail(ErrDecode, "neg: stack underflow")
+			}
+			v, ok := stack[len(stack)-1].(txvm.Int)
+			if !ok || v == math.MinInt64 {
+				return nil, errors.WithDetail(ErrDecode, "neg: want negatable int")
+			}
+			stack[len(stack)-1] = -v
+		case opcode == op.Tuple:
+			if len(stack) == 0 {
+				return nil, errors.WithDetail(ErrDecode, "tuple: stack underflow")
+			}
+			size, ok := stack[len(stack)-1].(txvm.Int)
+			if !ok || size < 0 || int64(size) >= int64(len(stack)) {
+				return nil, errors.WithDetail(ErrDecode, "tuple: invalid size")
+			}
+			stack = stack[:len(stack)-1]
+			t := make(txvm.Tuple, size)
+			copy(t, stack[len(stack)-int(size):])
+			stack = append(stack[:len(stack)-int(size)], t)
+		default:
+			return nil, errors.WithDetailf(ErrDecode, "unexpected instruction %s", op.Name(opcode))
+		}
+	}
+	if len(stack) != 1 {
+		return nil, errors.WithDetailf(ErrDecode, "program produces %d items, want 1", len(stack))
+	}
+	return stack[0], nil
+}
+
+// DecodeTuple parses prog as the encoding of a single tuple and
+// returns that tuple.
+func DecodeTuple(prog []byte) (txvm.Tuple, error) {
+	d, err := Decode(prog)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := d.(txvm.Tuple)
+	if !ok {
+		return nil, errors.WithDetail(ErrDecode, "not a tuple")
+	}
+	return t, nil
+}
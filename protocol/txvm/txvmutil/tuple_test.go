@@ -0,0 +1,128 @@
+package txvmutil
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+func TestTupleRoundTrip(t *testing.T) {
+	cases := []struct {
+		vals []interface{}
+		want txvm.Tuple
+	}{
+		{
+			vals: nil,
+			want: txvm.Tuple{},
+		},
+		{
+			vals: []interface{}{0, int64(31), int64(32), int64(-1), int64(math.MinInt64), uint64(math.MaxInt64)},
+			want: txvm.Tuple{txvm.Int(0), txvm.Int(31), txvm.Int(32), txvm.Int(-1), txvm.Int(math.MinInt64), txvm.Int(math.MaxInt64)},
+		},
+		{
+			vals: []interface{}{"O", []byte{}, []byte{0xff, 0x00}},
+			want: txvm.Tuple{txvm.Bytes("O"), txvm.Bytes{}, txvm.Bytes{0xff, 0x00}},
+		},
+		{
+			vals: []interface{}{
+				"V",
+				int64(10),
+				[]interface{}{},
+				[]interface{}{int64(7), "a", []interface{}{"deep", int64(-300)}},
+				txvm.Tuple{txvm.Bytes("x")},
+			},
+			want: txvm.Tuple{
+				txvm.Bytes("V"),
+				txvm.Int(10),
+				txvm.Tuple{},
+				txvm.Tuple{txvm.Int(7), txvm.Bytes("a"), txvm.Tuple{txvm.Bytes("deep"), txvm.Int(-300)}},
+				txvm.Tuple{txvm.Bytes("x")},
+			},
+		},
+	}
+
+	for i, c := range cases {
+		enc, err := EncodeTuple(c.vals...)
+		if err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+		if want := txvm.Encode(c.want); !bytes.Equal(enc, want) {
+			t.Errorf("case %d: encoding %x, want %x", i, enc, want)
+		}
+		got, err := DecodeTuple(enc)
+		if err != nil {
+			t.Fatalf("case %d: decoding: %s", i, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: decoded %s, want %s", i, got, c.want)
+		}
+
+		// The encoding must also be a valid program.
+		_, err = txvm.Validate(append(enc, op.Drop), 3, 100000)
+		if err != nil {
+			t.Errorf("case %d: executing encoding: %s", i, err)
+		}
+	}
+}
+
+func TestDecodeBuilder(t *testing.T) {
+	prog := newBuilder().Tuple(func(tb *TupleBuilder) {
+		tb.PushdataInt64(-5)
+		tb.PushdataBytes([]byte("abc"))
+		tb.Tuple(func(tb *TupleBuilder) {
+			tb.PushdataByte(txvm.IntCode)
+			tb.PushdataData(txvm.Tuple{txvm.Int(1000)})
+		})
+	}).Build()
+
+	got, err := DecodeTuple(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := txvm.Tuple{
+		txvm.Int(-5),
+		txvm.Bytes("abc"),
+		txvm.Tuple{txvm.Bytes{txvm.IntCode}, txvm.Tuple{txvm.Int(1000)}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := [][]byte{
+		{},
+		{1, 2},
+		{op.Dup},
+		{op.Int},
+		{1, op.Int},
+		{op.MinPushdata + 2, 0x80, 0x80, op.Int},
+		{1, 5, op.Tuple},
+		{op.MinPushdata, op.Tuple},
+	}
+	for _, c := range cases {
+		_, err := Decode(c)
+		if errors.Root(err) != ErrDecode {
+			t.Errorf("Decode(%x) = %v, want %v", c, err, ErrDecode)
+		}
+	}
+
+	_, err := DecodeTuple([]byte{1})
+	if errors.Root(err) != ErrDecode {
+		t.Errorf("DecodeTuple(non-tuple) = %v, want %v", err, ErrDecode)
+	}
+
+	_, err = MakeTuple(uint64(math.MaxUint64))
+	if errors.Root(err) != txvm.ErrIntOverflow {
+		t.Errorf("MakeTuple(MaxUint64) = %v, want %v", err, txvm.ErrIntOverflow)
+	}
+	_, err = MakeTuple(3.5)
+	if errors.Root(err) != txvm.ErrType {
+		t.Errorf("MakeTuple(float) = %v, want %v", err, txvm.ErrType)
+	}
+}
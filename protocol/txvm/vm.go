@@ -21,6 +21,11 @@ type VM struct {
 	runlimit          int64
 	extension         bool
 	stopAfterFinalize bool
+	block             *blockContext
+	clock             *int64
+	snapshotOnFailure bool
+	maxProgramLen     int
+	maxCallDepth      int
 	onFinalize        []func(*VM)
 	onLog             []func(*VM)
 	beforeStep        []func(*VM)
@@ -32,10 +37,12 @@ type VM struct {
 	run       run // TODO(bobg): move run/runstack into txvmutil.
 	runstack  []run
 	unwinding bool
+	failure   *FailureSnapshot
 	contract  *contract
 	caller    []byte
 	data      []byte
 	opcode    byte
+	inputs    int64 // number of input instructions executed
 
 	// Results
 
@@ -90,9 +97,31 @@ var (
 	// and the extension flag is false.
 	ErrExt = errorf("extension flag is false")
 
+	// ErrProgramLen is returned by Validate, without running the
+	// program, when the program is longer than the limit set with
+	// WithMaxProgramLen.
+	ErrProgramLen = errorf("program too long")
+
+	// ErrCallDepth is returned when exec and call instructions nest
+	// more deeply than allowed. See WithMaxCallDepth.
+	ErrCallDepth = errorf("call depth exceeded")
+
 	emptySeed = make([]byte, 32)
 )
 
+// ExtVersion is the earliest transaction version in which extended
+// instructions (invoked as "x ext", see package op) are defined.
+// In earlier versions, ext behaves as an unassigned extension.
+const ExtVersion = 4
+
+// DefaultMaxCallDepth is the deepest that exec and call instructions
+// may nest in Validate for transactions of version ExtVersion or
+// later, unless changed with WithMaxCallDepth. It bounds the Go stack
+// used by validation, which the runlimit alone does not do tightly
+// enough. Earlier versions have no default bound, so that their
+// validity is unchanged.
+const DefaultMaxCallDepth = 1024
+
 // Validate is the main entrypoint to txvm. It runs the given program,
 // producing its transaction ID if it gets as far as a "finalize"
 // instruction. Other runtmie information can be inspected via
@@ -109,12 +138,23 @@ func Validate(prog []byte, txVersion, runlimit int64, o ...Option) (*VM, error)
 		contract:  con,
 		caller:    emptySeed,
 	}
+	if txVersion >= ExtVersion {
+		vm.maxCallDepth = DefaultMaxCallDepth
+	}
 
 	for _, o := range o {
 		o(vm)
 	}
 
-	err := vm.validate(prog)
+	var err error
+	if vm.maxProgramLen > 0 && len(prog) > vm.maxProgramLen {
+		err = errors.WithData(ErrProgramLen, "len(prog)", len(prog), "max", vm.maxProgramLen)
+	} else {
+		err = vm.validate(prog)
+		if err != nil && vm.failure != nil {
+			err = errors.WithData(err, "failure", vm.failure)
+		}
+	}
 	vm.runHooks(vm.onExit)
 	return vm, err
 }
@@ -136,6 +176,9 @@ func (vm *VM) validate(txprog []byte) (err error) {
 
 func (vm *VM) exec(prog []byte) {
 	if len(vm.run.prog) > 0 {
+		if vm.maxCallDepth > 0 && len(vm.runstack) >= vm.maxCallDepth {
+			panic(errors.WithData(ErrCallDepth, "max", vm.maxCallDepth))
+		}
 		vm.runstack = append(vm.runstack, vm.run)
 		defer func() {
 			vm.run = vm.runstack[len(vm.runstack)-1]
@@ -162,6 +205,9 @@ func (vm *VM) step() {
 	}
 	vm.opcode = opcode
 	vm.data = data
+	if vm.snapshotOnFailure {
+		defer vm.recordFailure(vm.snapshot())
+	}
 	vm.runHooks(vm.beforeStep)
 	vm.charge(1)
 	vm.run.pc += n
@@ -217,11 +263,7 @@ func (vm *VM) popData() Data {
 }
 
 func (vm *VM) popBool() bool {
-	v := vm.popData()
-	if n, ok := v.(Int); ok {
-		return n != 0
-	}
-	return true
+	return isTrue(vm.popData())
 }
 
 func (vm *VM) popBytes() Bytes {
@@ -272,11 +314,11 @@ func (vm *VM) chargeCreate(v Item) {
 
 	switch val := v.(type) {
 	case Entry:
-		cost = 128
+		cost = entryCost
 	case Bytes:
-		cost, ok = checked.AddInt64(1, int64(len(val)))
+		cost, ok = stringCost(int64(len(val)))
 	case Tuple:
-		cost, ok = checked.AddInt64(1, int64(len(val)))
+		cost, ok = tupleCost(int64(len(val)))
 	}
 	if !ok {
 		panic(errors.Wrap(ErrIntOverflow, "charging create cost"))
@@ -292,9 +334,9 @@ func (vm *VM) chargeCopy(v Data) {
 
 	switch val := v.(type) {
 	case Bytes:
-		cost, ok = checked.AddInt64(1, int64(len(val)))
+		cost, ok = stringCost(int64(len(val)))
 	case Tuple:
-		cost, ok = checked.AddInt64(1, int64(len(val)))
+		cost, ok = tupleCost(int64(len(val)))
 	}
 	if !ok {
 		panic(errors.Wrap(ErrIntOverflow, "charging copy cost"))
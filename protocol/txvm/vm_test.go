@@ -2,6 +2,9 @@ package txvm_test
 
 import (
 	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"testing/quick"
 
@@ -240,8 +243,319 @@ func TestOptions(t *testing.T) {
 	}
 }
 
+func TestFailureSnapshot(t *testing.T) {
+	inner, err := asm.Assemble("4 'x' add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer, err := asm.Assemble("5 put 3 [4 'x' add] exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = txvm.Validate(outer, 3, 10000, txvm.WithFailureSnapshot)
+	if errors.Root(err) != txvm.ErrType {
+		t.Fatalf("got error %v, want %v", err, txvm.ErrType)
+	}
+	snap := txvm.Failure(err)
+	if snap == nil {
+		t.Fatalf("no FailureSnapshot in error %v", err)
+	}
+
+	want := &txvm.FailureSnapshot{
+		PC:       3,
+		Prog:     inner,
+		Opcode:   op.Add,
+		Stack:    []txvm.Data{txvm.Int(3), txvm.Int(4), txvm.Bytes("x")},
+		ArgStack: []txvm.Data{txvm.Int(5)},
+		RunStack: []txvm.RunFrame{{PC: int64(len(outer)), Prog: outer}},
+	}
+	if !reflect.DeepEqual(snap, want) {
+		t.Errorf("got snapshot %+v, want %+v", snap, want)
+	}
+	if txvm.Failure(errors.Wrap(err, "validating")) != snap {
+		t.Error("FailureSnapshot lost by wrapping")
+	}
+
+	// Without the option, there is no snapshot.
+	_, err = txvm.Validate(outer, 3, 10000)
+	if txvm.Failure(err) != nil {
+		t.Errorf("unexpected FailureSnapshot in error %v", err)
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	// A contract that may only run between times 1000 and 2000.
+	timelock, err := asm.Assemble("[1000 2000 timerange] contract call")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A nonce expiring at time 1500.
+	nonce, err := asm.Assemble("x'" + strings.Repeat("00", 32) + "' 1500 nonce drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		prog    []byte
+		opts    []txvm.Option
+		wantErr error
+	}{
+		{"timelock, no clock", timelock, nil, nil},
+		{"timelock, too early", timelock, []txvm.Option{txvm.WithClock(999)}, txvm.ErrTimeRange},
+		{"timelock, at min", timelock, []txvm.Option{txvm.WithClock(1000)}, nil},
+		{"timelock, at max", timelock, []txvm.Option{txvm.WithClock(2000)}, nil},
+		{"timelock, too late", timelock, []txvm.Option{txvm.WithClock(2001)}, txvm.ErrTimeRange},
+		{"nonce, unexpired", nonce, []txvm.Option{txvm.WithClock(1500)}, nil},
+		{"nonce, expired", nonce, []txvm.Option{txvm.WithClock(1501)}, txvm.ErrTimeRange},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := txvm.Validate(c.prog, 3, 10000, c.opts...)
+			if errors.Root(err) != c.wantErr {
+				t.Errorf("got error %v, want %v", err, c.wantErr)
+			}
+		})
+	}
+
+	// The clock also drives blocktime, in place of any block context.
+	prog, err := asm.Assemble("blocktime 1234 eq verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = txvm.Validate(prog, txvm.ExtVersion, 10000, txvm.BlockTime(1), txvm.WithClock(1234))
+	if err != nil {
+		t.Errorf("blocktime with clock: %v", err)
+	}
+}
+
+func TestWithMaxProgramLen(t *testing.T) {
+	prog, err := asm.Assemble("1 2 add 3 eq verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		max     int
+		wantErr error
+	}{
+		{0, nil},
+		{-1, nil},
+		{len(prog) + 1, nil},
+		{len(prog), nil},
+		{len(prog) - 1, txvm.ErrProgramLen},
+		{1, txvm.ErrProgramLen},
+	}
+	for _, c := range cases {
+		var runlimit int64
+		_, err := txvm.Validate(prog, 3, 10000, txvm.WithMaxProgramLen(c.max), txvm.GetRunlimit(&runlimit))
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("max %d: got error %v, want %v", c.max, err, c.wantErr)
+		}
+		if c.wantErr != nil && runlimit != 10000 {
+			t.Errorf("max %d: program ran, using runlimit %d", c.max, 10000-runlimit)
+		}
+	}
+}
+
+func TestWithPeakStackDepth(t *testing.T) {
+	cases := []struct {
+		src     string
+		want    int
+		wantErr error
+	}{
+		{"", 0, nil},
+		{"1 2 add 3 eq verify", 2, nil},
+		{"1 2 3 drop drop drop 4 5 drop drop", 3, nil},
+		{"1 2 put put 3 get get drop drop drop", 3, nil},
+		// The caller's two items count while the callee pushes three.
+		{"1 2 [3 4 5 drop drop drop] contract call drop drop", 5, nil},
+		{"1 2 [3 put [4 5 6 drop drop drop] contract call get drop] contract call drop drop", 6, nil},
+		// The items below map's tuple count while its program runs.
+		{"1 2 {3} [4 5 6 drop drop drop] map drop drop drop", 6, nil},
+		// A failing program reports the peak before it failed.
+		{"1 2 3 4 add 0 verify", 4, txvm.ErrVerifyFail},
+	}
+	for _, c := range cases {
+		prog, err := asm.Assemble(c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := -1
+		_, err = txvm.Validate(prog, txvm.ExtVersion, 10000, txvm.WithPeakStackDepth(func(peak int) { got = peak }))
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("%s: got error %v, want %v", c.src, err, c.wantErr)
+		}
+		if got != c.want {
+			t.Errorf("%s: peak %d, want %d", c.src, got, c.want)
+		}
+	}
+}
+
+func TestWithMaxCallDepth(t *testing.T) {
+	// nested returns a program whose exec instructions nest depth
+	// deep, with a call innermost.
+	nested := func(depth int) []byte {
+		src := "[] contract call"
+		for i := 1; i < depth; i++ {
+			src = "[" + src + "] exec"
+		}
+		prog, err := asm.Assemble(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return prog
+	}
+
+	const n = 5
+	_, err := txvm.Validate(nested(n), 3, 10000, txvm.WithMaxCallDepth(n))
+	if err != nil {
+		t.Errorf("nesting %d deep: %v", n, err)
+	}
+	_, err = txvm.Validate(nested(n+1), 3, 10000, txvm.WithMaxCallDepth(n))
+	if errors.Root(err) != txvm.ErrCallDepth {
+		t.Errorf("nesting %d deep: got error %v, want %v", n+1, err, txvm.ErrCallDepth)
+	}
+
+	// From ExtVersion, unbounded recursion stops at the default
+	// depth, well before exhausting the runlimit, unless the bound is
+	// removed. Earlier versions have no default bound.
+	recurse, err := asm.Assemble("[dup exec] dup exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = txvm.Validate(recurse, txvm.ExtVersion, 1000000)
+	if errors.Root(err) != txvm.ErrCallDepth {
+		t.Errorf("unbounded recursion: got error %v, want %v", err, txvm.ErrCallDepth)
+	}
+	_, err = txvm.Validate(recurse, txvm.ExtVersion, 1000000, txvm.WithMaxCallDepth(0))
+	if errors.Root(err) != txvm.ErrRunlimit {
+		t.Errorf("unbounded recursion without limit: got error %v, want %v", err, txvm.ErrRunlimit)
+	}
+	_, err = txvm.Validate(recurse, 3, 1000000)
+	if errors.Root(err) != txvm.ErrRunlimit {
+		t.Errorf("unbounded recursion at version 3: got error %v, want %v", err, txvm.ErrRunlimit)
+	}
+	_, err = txvm.Validate(nested(txvm.DefaultMaxCallDepth+1), 3, 100000000)
+	if err != nil {
+		t.Errorf("nesting %d deep at version 3: %v", txvm.DefaultMaxCallDepth+1, err)
+	}
+}
+
+func TestWithDebugLog(t *testing.T) {
+	prog, err := asm.Assemble("2 3 add 'ab' 1 2 3 4 drop drop drop drop [7 drop] contract call drop drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	_, err = txvm.Validate(prog, 3, 10000, txvm.WithDebugLog(&b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each line is "[indent]pc: instruction\t(depth) [top items]".
+	want := []string{
+		"0: 2\t(1) [2]",
+		"1: 3\t(2) [2 3]",
+		"2: add\t(1) [5]",
+		"3: 'ab'\t(2) [5 'ab']",
+		"6: 1\t(3) [5 'ab' 1]",
+		"7: 2\t(4) [5 'ab' 1 2]",
+		"8: 3\t(5) [... 'ab' 1 2 3]",
+		"9: 4\t(6) [... 1 2 3 4]",
+		"10: drop\t(5) [... 'ab' 1 2 3]",
+		"11: drop\t(4) [5 'ab' 1 2]",
+		"12: drop\t(3) [5 'ab' 1]",
+		"13: drop\t(2) [5 'ab']",
+		"14: x'0752'\t(3) [5 'ab' x'0752']",
+		"17: contract\t(3) [5 'ab' contract{",
+		"  0: 7\t(1) [7]",
+		"  1: drop\t(0) []",
+		"18: call\t(2) [5 'ab']",
+		"19: drop\t(1) [5]",
+		"20: drop\t(0) []",
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), b.String())
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, want[i]) {
+			t.Errorf("line %d = %q, want prefix %q", i, line, want[i])
+		}
+	}
+}
+
 func compareItems(t *testing.T, stackItem, testItem string) {
 	if stackItem != testItem {
 		t.Fatalf("Item on top of stack does not match expected item. Got %v, wanted %v", stackItem, testItem)
 	}
 }
+
+func TestTraceAnchors(t *testing.T) {
+	prog, err := asm.Assemble(`
+		x'0000000000000000000000000000000000000000000000000000000000000000' 100 nonce
+		0 split
+		10 'tag' issue
+		3 split
+		merge
+		retire
+		finalize`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Find the nonce anchor, to label it.
+	var nonceAnchor [32]byte
+	_, err = txvm.Validate(prog, 3, 10000, txvm.StopAfterFinalize, txvm.AfterStep(func(vm *txvm.VM) {
+		if vm.OpCode() == op.Nonce {
+			copy(nonceAnchor[:], vm.StackItem(0).(txvm.Tuple)[3].(txvm.Bytes))
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []txvm.AnchorEvent
+	labels := map[[32]byte]string{nonceAnchor: "N"}
+	_, err = txvm.Validate(prog, 3, 10000, txvm.StopAfterFinalize, txvm.TraceAnchors(labels, func(ev txvm.AnchorEvent) {
+		got = append(got, ev)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		s1 = "split1(N)"
+		s2 = "split2(N)"
+		m  = "merge(split2(split2(N)),split1(split2(N)))"
+	)
+	want := []txvm.AnchorEvent{
+		{Op: op.Nonce, Created: []string{"N"}},
+		{Op: op.Split, Consumed: []string{"N"}, Created: []string{s2, s1}},
+		{Op: op.Issue, Consumed: []string{s2}, Created: []string{s2}},
+		{Op: op.Split, Consumed: []string{s2}, Created: []string{"split2(" + s2 + ")", "split1(" + s2 + ")"}},
+		{Op: op.Merge, Consumed: []string{"split2(" + s2 + ")", "split1(" + s2 + ")"}, Created: []string{m}},
+		{Op: op.Retire, Consumed: []string{m}},
+		{Op: op.Finalize, Consumed: []string{s1}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events:\n%v\nwant:\n%v", got, want)
+	}
+	if len(labels) != 1 {
+		t.Errorf("labels map modified: %v", labels)
+	}
+
+	// Without a label, the nonce anchor is named in hex.
+	got = nil
+	_, err = txvm.Validate(prog, 3, 10000, txvm.StopAfterFinalize, txvm.TraceAnchors(nil, func(ev txvm.AnchorEvent) {
+		got = append(got, ev)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hex := fmt.Sprintf("%x", nonceAnchor[:4])
+	if len(got) == 0 || !reflect.DeepEqual(got[0].Created, []string{hex}) {
+		t.Errorf("unlabeled nonce event %v, want anchor %s", got, hex)
+	}
+}
@@ -0,0 +1,76 @@
+package validation
+
+import (
+	"context"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/state"
+)
+
+var (
+	// ErrTxID is returned by ValidateTx when a transaction's program
+	// does not produce the transaction's ID.
+	ErrTxID = errors.New("transaction program does not match transaction ID")
+
+	// ErrMissingInput is returned by ValidateTx and CheckTxState
+	// when a transaction spends an output that is not in the state.
+	ErrMissingInput = errors.New("transaction input not in state")
+
+	// ErrNonceReuse is returned by ValidateTx and CheckTxState when
+	// a transaction uses a nonce already in the state.
+	ErrNonceReuse = errors.New("transaction nonce already used")
+)
+
+// ValidateTx checks tx on its own, outside of any block, as for
+// admission to a pool of pending transactions. It runs tx's program
+// with the given version and runlimit, which must produce tx's ID,
+// and checks the resulting inputs and nonces against snapshot: each
+// input must spend an output in snapshot, and no nonce may already be
+// in it. It then checks that tx could be applied to snapshot, which
+// is left unchanged.
+//
+// Since it does not know the block tx will go into, ValidateTx does
+// not check tx's time ranges, or its version and runlimit against a
+// block's.
+func ValidateTx(ctx context.Context, tx *bc.Tx, snapshot *state.Snapshot, version, runlimit int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	vtx, err := bc.NewTx(tx.WitnessProg, version, runlimit)
+	if err != nil {
+		return errors.Wrap(err, "running transaction program")
+	}
+	if vtx.ID != tx.ID {
+		return errors.WithDetailf(ErrTxID, "program produces ID %x, want %x", vtx.ID.Bytes(), tx.ID.Bytes())
+	}
+
+	err = CheckTxState(vtx, snapshot)
+	if err != nil {
+		return err
+	}
+
+	err = state.Copy(snapshot).ApplyTx(vtx)
+	return errors.Wrap(err, "applying transaction")
+}
+
+// CheckTxState checks the inputs and nonces of tx, which must
+// already have passed ValidateTx, against snapshot, without running
+// its program: each input must spend an output in snapshot, and no
+// nonce may already be in it. It is for rechecking pending
+// transactions cheaply once a new block changes the state, which may
+// spend their inputs or use their nonces.
+func CheckTxState(tx *bc.Tx, snapshot *state.Snapshot) error {
+	for _, con := range tx.Contracts {
+		if con.Type == bc.InputType && !snapshot.ContractsTree.Contains(con.ID.Bytes()) {
+			return errors.WithDetailf(ErrMissingInput, "output %x", con.ID.Bytes())
+		}
+	}
+	for _, n := range tx.Nonces {
+		if snapshot.NonceTree.Contains(state.NonceCommitment(n.ID, n.ExpMS)) {
+			return errors.WithDetailf(ErrNonceReuse, "nonce %x", n.ID.Bytes())
+		}
+	}
+	return nil
+}
@@ -5,24 +5,46 @@ Chain Protocol spec.
 package validation
 
 import (
+	"bytes"
+	"sort"
+
 	"github.com/chain/txvm/crypto/ed25519"
 	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/bc"
 )
 
 var (
-	errMismatchedBlock       = errors.New("mismatched block")
-	errMismatchedMerkleRoot  = errors.New("mismatched merkle root")
-	errMisorderedBlockHeight = errors.New("misordered block height")
-	errMisorderedBlockTime   = errors.New("misordered block time")
-	errNoPrevBlock           = errors.New("no previous block")
-	errTxVersion             = errors.New("invalid transaction version")
-	errVersionRegression     = errors.New("version regression")
-	errBadPredicate          = errors.New("invalid block predicate")
-	errBadArguments          = errors.New("invalid block arguments for predicate")
-	errRunlimit              = errors.New("block runlimit not sufficient for transactions")
-	errRefsCount             = errors.New("refscount greater than allowed by previous block")
-	errExtraFields           = errors.New("unknown field(s) in blockheader")
+	// ErrMismatchedBlock is returned when a block's previous block ID
+	// is not the hash of the block it should follow.
+	ErrMismatchedBlock = errors.New("mismatched block")
+
+	// ErrMisorderedBlockHeight is returned when a block's height is
+	// not one more than that of the block it should follow.
+	ErrMisorderedBlockHeight = errors.New("misordered block height")
+
+	// ErrMisorderedBlockTime is returned when a block's timestamp is
+	// not later than that of the block it should follow.
+	ErrMisorderedBlockTime = errors.New("misordered block time")
+
+	// ErrCheckpoint is returned by Checkpoint when the header at the
+	// checkpoint height does not have the trusted hash, or is missing.
+	ErrCheckpoint = errors.New("checkpoint mismatch")
+
+	// ErrTxOrder is returned by TxOrder when a block's transactions
+	// are not in canonical order.
+	ErrTxOrder = errors.New("transactions not in canonical order")
+)
+
+var (
+	errMismatchedMerkleRoot = errors.New("mismatched merkle root")
+	errNoPrevBlock          = errors.New("no previous block")
+	errTxVersion            = errors.New("invalid transaction version")
+	errVersionRegression    = errors.New("version regression")
+	errBadPredicate         = errors.New("invalid block predicate")
+	errBadArguments         = errors.New("invalid block arguments for predicate")
+	errRunlimit             = errors.New("block runlimit not sufficient for transactions")
+	errRefsCount            = errors.New("refscount greater than allowed by previous block")
+	errExtraFields          = errors.New("unknown field(s) in blockheader")
 )
 
 // BlockSig checks the predicate against b.
@@ -130,17 +152,93 @@ func BlockPrev(b *bc.Block, prev *bc.BlockHeader) error {
 	if b.Version < prev.Version {
 		return errors.WithDetailf(errVersionRegression, "previous block verson %d, current block version %d", prev.Version, b.Version)
 	}
-	if b.Height != prev.Height+1 {
-		return errors.WithDetailf(errMisorderedBlockHeight, "previous block height %d, current block height %d", prev.Height, b.Height)
-	}
-	if prev.Hash() != *b.PreviousBlockId {
-		return errors.WithDetailf(errMismatchedBlock, "previous block ID %x, current block wants %x", prev.Hash().Bytes(), b.PreviousBlockId.Bytes())
-	}
-	if b.TimestampMs <= prev.TimestampMs {
-		return errors.WithDetailf(errMisorderedBlockTime, "previous block time %d, current block time %d", prev.TimestampMs, b.TimestampMs)
+	err := link(prev, b.BlockHeader)
+	if err != nil {
+		return err
 	}
 	if b.RefsCount > prev.RefsCount+1 {
 		return errors.WithDetailf(errRefsCount, "previous block prevblocks %d, current block %d", prev.RefsCount, b.RefsCount)
 	}
 	return nil
 }
+
+// TxOrder checks that b's transactions are in canonical order, as
+// produced by SortTxs: strictly increasing by ID, compared as byte
+// strings. Canonical order is not required of every block, but a
+// network may require it so that a set of transactions makes exactly
+// one block.
+func TxOrder(b *bc.Block) error {
+	for i := 1; i < len(b.Transactions); i++ {
+		prev, tx := b.Transactions[i-1].ID, b.Transactions[i].ID
+		if bytes.Compare(prev.Bytes(), tx.Bytes()) >= 0 {
+			return errors.WithDetailf(ErrTxOrder, "transaction %d (%x) follows %x", i, tx.Bytes(), prev.Bytes())
+		}
+	}
+	return nil
+}
+
+// SortTxs sorts txs into canonical order (see TxOrder). Since a
+// transaction spending the output of another must follow it in a
+// block, such pairs may not both fit in a canonically ordered block.
+func SortTxs(txs []*bc.Tx) {
+	sort.Slice(txs, func(i, j int) bool {
+		return bytes.Compare(txs[i].ID.Bytes(), txs[j].ID.Bytes()) < 0
+	})
+}
+
+// LinkOK checks that child can directly follow parent: its previous
+// block ID is parent's hash, its height is one more than parent's,
+// and its timestamp is later than parent's. It is a cheap structural
+// check, not a substitute for Block.
+func LinkOK(parent, child *bc.Block) error {
+	return link(parent.BlockHeader, child.BlockHeader)
+}
+
+// Checkpoint checks that headers form a contiguous chain, each
+// following the one before it as with LinkOK and without a version
+// regression, and that the header at height checkpointHeight is among
+// them and has the trusted hash checkpoint. It checks only the
+// headers' linkage, not predicates or transactions, so that a node
+// syncing from a trusted checkpoint can defer full validation of
+// later blocks.
+func Checkpoint(headers []*bc.BlockHeader, checkpointHeight uint64, checkpoint bc.Hash) error {
+	found := false
+	for i, h := range headers {
+		if i > 0 {
+			prev := headers[i-1]
+			if h.Version < prev.Version {
+				return errors.WithDetailf(errVersionRegression, "height %d: previous block version %d, current block version %d", h.Height, prev.Version, h.Version)
+			}
+			err := link(prev, h)
+			if err != nil {
+				return err
+			}
+		}
+		if h.Height == checkpointHeight {
+			if got := h.Hash(); got != checkpoint {
+				return errors.WithDetailf(ErrCheckpoint, "block %d has hash %x, checkpoint wants %x", h.Height, got.Bytes(), checkpoint.Bytes())
+			}
+			found = true
+		}
+	}
+	if !found {
+		return errors.WithDetailf(ErrCheckpoint, "no header at checkpoint height %d", checkpointHeight)
+	}
+	return nil
+}
+
+func link(parent, child *bc.BlockHeader) error {
+	if child.Height != parent.Height+1 {
+		return errors.WithDetailf(ErrMisorderedBlockHeight, "previous block height %d, current block height %d", parent.Height, child.Height)
+	}
+	if child.PreviousBlockId == nil {
+		return errors.WithDetailf(ErrMismatchedBlock, "previous block ID %x, current block has none", parent.Hash().Bytes())
+	}
+	if parent.Hash() != *child.PreviousBlockId {
+		return errors.WithDetailf(ErrMismatchedBlock, "previous block ID %x, current block wants %x", parent.Hash().Bytes(), child.PreviousBlockId.Bytes())
+	}
+	if child.TimestampMs <= parent.TimestampMs {
+		return errors.WithDetailf(ErrMisorderedBlockTime, "previous block time %d, current block time %d", parent.TimestampMs, child.TimestampMs)
+	}
+	return nil
+}
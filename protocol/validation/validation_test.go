@@ -1,13 +1,19 @@
 package validation
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/chain/txvm/crypto/ed25519"
 	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/bc/bctest"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/protocol/txvm/asm"
 )
 
 func TestBlock(t *testing.T) {
@@ -231,7 +237,7 @@ func TestBlockPrev(t *testing.T) {
 			RefsCount:       6,
 			PreviousBlockId: &prevHash,
 		},
-		wantErr: errMisorderedBlockHeight,
+		wantErr: ErrMisorderedBlockHeight,
 	}, {
 		current: &bc.BlockHeader{
 			Version:         3,
@@ -240,7 +246,7 @@ func TestBlockPrev(t *testing.T) {
 			RefsCount:       6,
 			PreviousBlockId: &bc.Hash{},
 		},
-		wantErr: errMismatchedBlock,
+		wantErr: ErrMismatchedBlock,
 	}, {
 		current: &bc.BlockHeader{
 			Version:         3,
@@ -249,7 +255,7 @@ func TestBlockPrev(t *testing.T) {
 			RefsCount:       6,
 			PreviousBlockId: &prevHash,
 		},
-		wantErr: errMisorderedBlockTime,
+		wantErr: ErrMisorderedBlockTime,
 	}, {
 		current: &bc.BlockHeader{
 			Version:         3,
@@ -258,7 +264,7 @@ func TestBlockPrev(t *testing.T) {
 			RefsCount:       6,
 			PreviousBlockId: &prevHash,
 		},
-		wantErr: errMisorderedBlockTime,
+		wantErr: ErrMisorderedBlockTime,
 	}, {
 		current: &bc.BlockHeader{
 			Version:         3,
@@ -278,6 +284,273 @@ func TestBlockPrev(t *testing.T) {
 	}
 }
 
+func TestLinkOK(t *testing.T) {
+	cases := []struct {
+		f       func(child *bc.Block)
+		wantErr error
+	}{{
+		f:       func(*bc.Block) {},
+		wantErr: nil,
+	}, {
+		f:       func(child *bc.Block) { child.PreviousBlockId = &bc.Hash{} },
+		wantErr: ErrMismatchedBlock,
+	}, {
+		f:       func(child *bc.Block) { child.PreviousBlockId = nil },
+		wantErr: ErrMismatchedBlock,
+	}, {
+		f:       func(child *bc.Block) { child.Height++ },
+		wantErr: ErrMisorderedBlockHeight,
+	}, {
+		f:       func(child *bc.Block) { child.Height = 1 },
+		wantErr: ErrMisorderedBlockHeight,
+	}, {
+		f:       func(child *bc.Block) { child.TimestampMs-- },
+		wantErr: ErrMisorderedBlockTime,
+	}, {
+		f:       func(child *bc.Block) { child.TimestampMs = 0 },
+		wantErr: ErrMisorderedBlockTime,
+	}}
+
+	for i, c := range cases {
+		parent := newInitialBlock(t)
+		child := generate(t, parent)
+		c.f(child)
+		gotErr := LinkOK(parent, child)
+		if errors.Root(gotErr) != c.wantErr {
+			t.Errorf("LinkOK(%d) = %v want %v", i, gotErr, c.wantErr)
+		}
+	}
+}
+
+func TestTxOrder(t *testing.T) {
+	mk := func(ids ...byte) *bc.Block {
+		b := &bc.Block{BlockHeader: &bc.BlockHeader{}}
+		for _, id := range ids {
+			b.Transactions = append(b.Transactions, &bc.Tx{ID: bc.NewHash([32]byte{id})})
+		}
+		return b
+	}
+	cases := []struct {
+		ids     []byte
+		wantErr error
+	}{
+		{nil, nil},
+		{[]byte{1}, nil},
+		{[]byte{1, 2, 3}, nil},
+		{[]byte{1, 3, 2}, ErrTxOrder},
+		{[]byte{2, 2}, ErrTxOrder},
+	}
+	for _, c := range cases {
+		err := TxOrder(mk(c.ids...))
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("TxOrder(%v) = %v, want %v", c.ids, err, c.wantErr)
+		}
+	}
+
+	b := mk(3, 1, 2)
+	SortTxs(b.Transactions)
+	if err := TxOrder(b); err != nil {
+		t.Errorf("after SortTxs: %v", err)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	blocks := []*bc.Block{newInitialBlock(t)}
+	for i := 0; i < 4; i++ {
+		blocks = append(blocks, generate(t, blocks[len(blocks)-1]))
+	}
+	var headers []*bc.BlockHeader
+	for _, b := range blocks {
+		headers = append(headers, b.BlockHeader)
+	}
+	checkpoint := blocks[3].Hash()
+
+	cases := []struct {
+		name    string
+		headers []*bc.BlockHeader
+		height  uint64
+		hash    bc.Hash
+		wantErr error
+	}{
+		{"matching checkpoint", headers, 4, checkpoint, nil},
+		{"checkpoint at start", headers[3:], 4, checkpoint, nil},
+		{"mismatched checkpoint", headers, 4, blocks[2].Hash(), ErrCheckpoint},
+		{"checkpoint height wrong", headers, 3, checkpoint, ErrCheckpoint},
+		{"checkpoint not in headers", headers[:3], 4, checkpoint, ErrCheckpoint},
+		{"no headers", nil, 4, checkpoint, ErrCheckpoint},
+		{"gap", []*bc.BlockHeader{headers[0], headers[1], headers[3]}, 4, checkpoint, ErrMisorderedBlockHeight},
+	}
+	for _, c := range cases {
+		err := Checkpoint(c.headers, c.height, c.hash)
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("%s: got error %v, want %v", c.name, err, c.wantErr)
+		}
+	}
+
+	// A substituted header breaks the linkage after it.
+	forged := *headers[1]
+	forged.TimestampMs++
+	forgedHeaders := []*bc.BlockHeader{headers[0], &forged, headers[2], headers[3]}
+	err := Checkpoint(forgedHeaders, 4, checkpoint)
+	if errors.Root(err) != ErrMismatchedBlock {
+		t.Errorf("forged header: got error %v, want %v", err, ErrMismatchedBlock)
+	}
+}
+
+func TestValidateTx(t *testing.T) {
+	ctx := context.Background()
+
+	b1 := newInitialBlock(t)
+	snapshot := state.Empty()
+	err := snapshot.ApplyBlock(b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour)
+
+	// A transaction issuing a nonce is valid once.
+	tx := bctest.EmptyTx(t, b1.Hash(), exp)
+	err = ValidateTx(ctx, tx, snapshot, 3, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := state.Copy(snapshot)
+	err = replay.ApplyTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidateTx(ctx, tx, replay, 3, 10000)
+	if errors.Root(err) != ErrNonceReuse {
+		t.Errorf("replayed nonce: got error %v, want %v", err, ErrNonceReuse)
+	}
+
+	// A transaction spending an output must find it in the state.
+	prog, err := asm.Assemble(fmt.Sprintf(`
+		[1 drop x'%x' %d nonce put] contract call
+		{'C', x'%x', []} input call
+		get finalize
+	`, b1.Hash().Bytes(), bc.Millis(exp), make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend, err := bc.NewTx(prog, 3, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidateTx(ctx, spend, snapshot, 3, 10000)
+	if errors.Root(err) != ErrMissingInput {
+		t.Errorf("missing input: got error %v, want %v", err, ErrMissingInput)
+	}
+	withOutput := state.Copy(snapshot)
+	err = withOutput.ContractsTree.Insert(spend.Inputs[0].ID.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidateTx(ctx, spend, withOutput, 3, 10000)
+	if err != nil {
+		t.Errorf("spend of existing output: %v", err)
+	}
+	if !withOutput.ContractsTree.Contains(spend.Inputs[0].ID.Bytes()) {
+		t.Error("ValidateTx changed the snapshot")
+	}
+
+	// The program must produce the transaction.
+	forged := *tx
+	forged.ID = bc.NewHash([32]byte{1})
+	err = ValidateTx(ctx, &forged, snapshot, 3, 10000)
+	if errors.Root(err) != ErrTxID {
+		t.Errorf("forged ID: got error %v, want %v", err, ErrTxID)
+	}
+
+	// So must the runlimit.
+	err = ValidateTx(ctx, tx, snapshot, 3, 10)
+	if err == nil {
+		t.Error("insufficient runlimit: got nil error")
+	}
+}
+
+func TestCheckTxState(t *testing.T) {
+	ctx := context.Background()
+
+	b1 := newInitialBlock(t)
+	snapshot := state.Empty()
+	err := snapshot.ApplyBlock(b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour)
+
+	// spendTx spends the output with the given contract seed, under a
+	// fresh nonce.
+	spendTx := func(nonce int, seed byte) *bc.Tx {
+		prog, err := asm.Assemble(fmt.Sprintf(`
+			[%d drop x'%x' %d nonce put] contract call
+			{'C', x'%x', []} input call
+			get finalize
+		`, nonce, b1.Hash().Bytes(), bc.Millis(exp), bytes.Repeat([]byte{seed}, 32)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := bc.NewTx(prog, 3, 10000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	pending := spendTx(1, 1)
+	other := spendTx(2, 2)
+	rival := spendTx(3, 1) // spends the same output as pending
+	if rival.Inputs[0].ID != pending.Inputs[0].ID {
+		t.Fatal("rival spends a different output")
+	}
+	for _, tx := range []*bc.Tx{pending, other} {
+		err = snapshot.ContractsTree.Insert(tx.Inputs[0].ID.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tx := range []*bc.Tx{pending, other, rival} {
+		err = ValidateTx(ctx, tx, snapshot, 3, 10000)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Committing rival spends pending's input; other is unaffected.
+	next := state.Copy(snapshot)
+	err = next.ApplyTx(rival)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckTxState(pending, next)
+	if errors.Root(err) != ErrMissingInput {
+		t.Errorf("pending spend after rival: got error %v, want %v", err, ErrMissingInput)
+	}
+	err = CheckTxState(other, next)
+	if err != nil {
+		t.Errorf("unrelated spend after rival: %v", err)
+	}
+	err = CheckTxState(rival, next)
+	if errors.Root(err) != ErrMissingInput {
+		t.Errorf("committed tx: got error %v, want %v", err, ErrMissingInput)
+	}
+
+	// Committing a transaction uses its nonce.
+	nonceTx := bctest.EmptyTx(t, b1.Hash(), exp)
+	err = CheckTxState(nonceTx, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = next.ApplyTx(nonceTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckTxState(nonceTx, next)
+	if errors.Root(err) != ErrNonceReuse {
+		t.Errorf("committed nonce: got error %v, want %v", err, ErrNonceReuse)
+	}
+}
+
 func newInitialBlock(tb testing.TB) *bc.Block {
 	root := bc.TxMerkleRoot(nil) // calculate the zero value of the tx merkle root
 
@@ -0,0 +1,76 @@
+package standard
+
+import (
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// Batch builds an ordered batch of transactions in which later
+// transactions may spend the outputs of earlier ones, before any of
+// them is confirmed. A transaction refers to an earlier one's output
+// by the Payment handle returned when the output was added.
+type Batch struct {
+	version, runlimit int64
+	txs               []*TxBuilder
+}
+
+// NewBatch returns an empty Batch of transactions with the given
+// version, whose programs must each run to finalize within runlimit.
+func NewBatch(version, runlimit int64) *Batch {
+	return &Batch{version: version, runlimit: runlimit}
+}
+
+// NewTx adds a transaction to the end of the batch and returns its
+// builder. Its inputs may spend, with SpendPayment, the payments of
+// transactions added before it.
+func (bt *Batch) NewTx() *TxBuilder {
+	tb := NewTxBuilder(bt.version, bt.runlimit)
+	bt.txs = append(bt.txs, tb)
+	return tb
+}
+
+// Build builds the batch's transactions in order, resolving each
+// spent payment to the output of the earlier transaction that made
+// it. It returns the transactions' unsigned programs and the
+// transactions resulting from them, in order; see TxBuilder.Build. If
+// a transaction spends a payment not made by an earlier transaction
+// in the batch, Build fails with ErrUnbuiltPayment.
+//
+// Build may be called again after changing the batch. Payments are
+// resolved afresh each time.
+func (bt *Batch) Build() ([][]byte, []*bc.Tx, error) {
+	var (
+		progs   [][]byte
+		txs     []*bc.Tx
+		outputs = make(map[*Payment]*Output)
+	)
+	for i, tb := range bt.txs {
+		inputs := make([]*Output, 0, len(tb.inputs))
+		for j, in := range tb.inputs {
+			out := in.output
+			if in.payment != nil {
+				out = outputs[in.payment]
+				if out == nil {
+					return nil, nil, errors.WithDetailf(ErrUnbuiltPayment, "transaction %d input %d", i, j)
+				}
+			}
+			inputs = append(inputs, out)
+		}
+		if len(inputs) == 0 {
+			return nil, nil, errors.Wrapf(ErrNoInputs, "building transaction %d", i)
+		}
+		prog, tx, err := tb.build(inputs)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "building transaction %d", i)
+		}
+		for k, p := range tb.payments {
+			outputs[p], err = TxOutput(tx, k)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "building transaction %d", i)
+			}
+		}
+		progs = append(progs, prog)
+		txs = append(txs, tx)
+	}
+	return progs, txs, nil
+}
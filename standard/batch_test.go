@@ -0,0 +1,102 @@
+package standard
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/testutil"
+)
+
+func TestBatch(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	keys := []ed25519.PublicKey{pub}
+	assetID := bc.NewHash([32]byte{1})
+
+	// Tx1 splits a value in two, and tx2 spends both parts before
+	// tx1 is confirmed.
+	batch := NewBatch(3, 100000)
+	tx1 := batch.NewTx()
+	tx1.Spend(&Output{Quorum: 1, Pubkeys: keys, Amount: 10, AssetID: assetID, Anchor: bytes.Repeat([]byte{1}, 32)}, nil)
+	pay := tx1.Pay(7, assetID, 1, keys)
+	change := tx1.Pay(3, assetID, 1, keys)
+	tx2 := batch.NewTx()
+	tx2.SpendPayment(pay, nil).SpendPayment(change, nil)
+	tx2.Pay(10, assetID, 1, []ed25519.PublicKey{testutil.TestPub})
+
+	progs, txs, err := batch.Build()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(progs) != 2 || len(txs) != 2 {
+		t.Fatalf("got %d programs and %d transactions, want 2", len(progs), len(txs))
+	}
+	for i := 0; i < 2; i++ {
+		if txs[1].Inputs[i].ID != txs[0].Outputs[i].ID {
+			t.Errorf("tx2 input %d spends %x, want tx1 output %x", i, txs[1].Inputs[i].ID.Bytes(), txs[0].Outputs[i].ID.Bytes())
+		}
+	}
+
+	// Each transaction is valid once signed.
+	for i, prog := range progs {
+		_, err := bc.NewTx(signAll(t, prog, txs[i], priv), 3, 100000)
+		if err != nil {
+			t.Fatalf("transaction %d: %v", i, err)
+		}
+	}
+
+	// Building again gives the same batch.
+	_, again, err := batch.Build()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	for i := range txs {
+		if again[i].ID != txs[i].ID {
+			t.Errorf("rebuilt transaction %d has ID %x, want %x", i, again[i].ID.Bytes(), txs[i].ID.Bytes())
+		}
+	}
+}
+
+func TestBatchOrder(t *testing.T) {
+	keys := []ed25519.PublicKey{testutil.TestPub}
+	out := &Output{Quorum: 1, Pubkeys: keys, Amount: 1, Anchor: make([]byte, 32)}
+
+	// A transaction cannot spend a payment of a later one.
+	batch := NewBatch(3, 100000)
+	tx1 := batch.NewTx()
+	tx2 := batch.NewTx()
+	tx2.Spend(out, nil)
+	p := tx2.Pay(1, bc.Hash{}, 1, keys)
+	tx1.SpendPayment(p, nil).Pay(1, bc.Hash{}, 1, keys)
+	_, _, err := batch.Build()
+	if errors.Root(err) != ErrUnbuiltPayment {
+		t.Errorf("got error %v, want %v", err, ErrUnbuiltPayment)
+	}
+
+	// Nor a payment of another batch, even one already built.
+	other := NewBatch(3, 100000)
+	p = other.NewTx().Spend(out, nil).Pay(1, bc.Hash{}, 1, keys)
+	_, _, err = other.Build()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	batch = NewBatch(3, 100000)
+	batch.NewTx().SpendPayment(p, nil).Pay(1, bc.Hash{}, 1, keys)
+	_, _, err = batch.Build()
+	if errors.Root(err) != ErrUnbuiltPayment {
+		t.Errorf("got error %v, want %v", err, ErrUnbuiltPayment)
+	}
+
+	// Outside a batch, a payment cannot be spent at all.
+	tb := NewTxBuilder(3, 100000)
+	tb.SpendPayment(p, nil).Pay(1, bc.Hash{}, 1, keys)
+	_, _, err = tb.Build()
+	if errors.Root(err) != ErrUnbuiltPayment {
+		t.Errorf("got error %v, want %v", err, ErrUnbuiltPayment)
+	}
+}
@@ -0,0 +1,61 @@
+package standard
+
+import (
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/txvm"
+)
+
+// ErrNoSigningBytes is returned by SigningBytes when a transaction
+// input does not have the form of a standard multisig input.
+var ErrNoSigningBytes = errors.New("cannot compute signing bytes")
+
+// SigMessage returns the message that each signer of a standard
+// multisig contract signs when authorizing a transaction with the
+// given ID: the program VerifyTxID(txid) concatenated with the anchor
+// of the value being spent (see multisigProgCheckSrc). It depends only
+// on the transaction ID and the value, never on the transaction's
+// witness, so signatures cannot be used to malleate it.
+func SigMessage(txid [32]byte, anchor []byte) []byte {
+	return append(VerifyTxID(txid), anchor...)
+}
+
+// SigningBytes returns the message that the signers of tx's input
+// with the given index must sign, as with SigMessage. Tx must be
+// finalized, and the input must hold a single value, as do the
+// inputs produced by SpendMultisig.
+//
+// The result is the same for any witness producing the same
+// transaction ID, so an external signer can compute it from a
+// transaction run with txvm.StopAfterFinalize before any signatures
+// have been added.
+func SigningBytes(tx *bc.Tx, input int) ([]byte, error) {
+	if !tx.Finalized {
+		return nil, errors.WithDetail(ErrNoSigningBytes, "transaction not finalized")
+	}
+	if input < 0 || input >= len(tx.Inputs) {
+		return nil, errors.WithDetailf(ErrNoSigningBytes, "no input %d", input)
+	}
+	var anchor []byte
+	for _, item := range tx.Inputs[input].Stack {
+		t, ok := item.(txvm.Tuple)
+		if !ok || len(t) != 4 {
+			continue
+		}
+		if code, ok := t[0].(txvm.Bytes); !ok || len(code) != 1 || code[0] != txvm.ValueCode {
+			continue
+		}
+		if anchor != nil {
+			return nil, errors.WithDetailf(ErrNoSigningBytes, "input %d holds more than one value", input)
+		}
+		a, ok := t[3].(txvm.Bytes)
+		if !ok {
+			return nil, errors.WithDetailf(ErrNoSigningBytes, "input %d value has no anchor", input)
+		}
+		anchor = a
+	}
+	if anchor == nil {
+		return nil, errors.WithDetailf(ErrNoSigningBytes, "input %d holds no value", input)
+	}
+	return SigMessage(tx.ID.Byte32(), anchor), nil
+}
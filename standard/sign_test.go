@@ -0,0 +1,86 @@
+package standard
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/op"
+	"github.com/chain/txvm/protocol/txvm/txvmutil"
+	"github.com/chain/txvm/testutil"
+)
+
+func TestSigningBytes(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	anchor := bytes.Repeat([]byte{7}, 32)
+
+	// spend builds a transaction spending a zero value locked by a
+	// 1-of-1 multisig, using the value as the finalize anchor, and
+	// authorizing it with sig over txid.
+	spend := func(sig []byte, txid [32]byte) []byte {
+		var b txvmutil.Builder
+		b.PushdataBytes([]byte("refdata")).Op(op.Put)
+		SpendMultisig(&b, 1, []ed25519.PublicKey{pub}, 0, bc.Hash{}, anchor, PayToMultisigSeed1[:])
+		b.Op(op.Get).Op(op.Get).Op(op.Finalize)
+		b.PushdataBytes(sig).Op(op.Put)
+		b.PushdataBytes(VerifyTxID(txid)).Op(op.Put)
+		b.Op(op.Call)
+		return b.Build()
+	}
+
+	// Compute the txid and signing bytes before signing.
+	unsigned, err := bc.NewTx(spend(nil, [32]byte{}), 3, 100000, txvm.StopAfterFinalize)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	txid := unsigned.ID.Byte32()
+	msg, err := SigningBytes(unsigned, 0)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if want := SigMessage(txid, anchor); !bytes.Equal(msg, want) {
+		t.Errorf("SigningBytes = %x, want %x", msg, want)
+	}
+
+	// A signature over the signing bytes authorizes the spend.
+	sig := ed25519.Sign(priv, msg)
+	signed, err := bc.NewTx(spend(sig, txid), 3, 100000)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if signed.ID != unsigned.ID {
+		t.Fatalf("signed txid %x, unsigned txid %x", signed.ID.Bytes(), unsigned.ID.Bytes())
+	}
+
+	// The signing bytes do not depend on the witness.
+	for _, tx := range []*bc.Tx{signed, mustNewTx(t, spend([]byte("junk"), txid), 50000)} {
+		got, err := SigningBytes(tx, 0)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Errorf("SigningBytes changed with witness: got %x, want %x", got, msg)
+		}
+	}
+
+	_, err = SigningBytes(unsigned, 1)
+	if errors.Root(err) != ErrNoSigningBytes {
+		t.Errorf("SigningBytes(no such input): got error %v, want %v", err, ErrNoSigningBytes)
+	}
+}
+
+// mustNewTx runs prog up to finalize and returns the resulting
+// transaction.
+func mustNewTx(t *testing.T, prog []byte, runlimit int64) *bc.Tx {
+	tx, err := bc.NewTx(prog, 3, runlimit, txvm.StopAfterFinalize)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	return tx
+}
@@ -0,0 +1,175 @@
+package standard
+
+import (
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/math/checked"
+	"github.com/chain/txvm/protocol/txvm"
+)
+
+// ErrTransferTooLarge is returned by SplitTransfers when a transaction
+// making a single transfer does not run within the budget.
+var ErrTransferTooLarge = errors.New("transfer does not fit runlimit budget")
+
+// Transfer is a payment of Amount units to a pay-to-multisig
+// contract, one of a batch split by SplitTransfers. RefData is
+// attached to the transfer's output.
+type Transfer struct {
+	Amount  int64
+	Quorum  int
+	Pubkeys []ed25519.PublicKey
+	RefData []byte
+}
+
+// SplitTransfers makes a batch of transfers from funds, too large for
+// one transaction or block, in a chain of transactions that each run
+// within a runlimit of budget.
+//
+// Each transaction spends funds, or the change of the transaction
+// before it, makes the next transfers in order, and pays the
+// remainder back to funds' multisig contract as change. Only the
+// last transaction may omit the change, if there is none. Each gets
+// as many transfers as fit: the number is found by a binary search,
+// since a transaction making more transfers costs more.
+//
+// The transactions tried in the search are signed by placeholder keys
+// standing in for funds' public keys, so that they cost as much to
+// run as the real ones. Sign is called only for the transactions
+// kept, with the message to sign (see SigningBytes), and must return
+// a 64-byte signature for each of quorum of funds' public keys, in
+// order, and an empty one for the others.
+//
+// SplitTransfers returns the signed programs, in order. If the
+// transfers add up to more than funds, it fails with ErrUnbalanced,
+// and if a transaction making a single transfer exceeds the budget,
+// with ErrTransferTooLarge. If sign fails, or a transaction fails for
+// any reason but its runlimit, SplitTransfers returns that error.
+func SplitTransfers(funds *Output, transfers []Transfer, version, budget int64, sign func(msg []byte) ([][]byte, error)) ([][]byte, error) {
+	remaining := funds.Amount
+	for i, tr := range transfers {
+		var ok bool
+		remaining, ok = checked.SubInt64(remaining, tr.Amount)
+		if !ok || remaining < 0 {
+			return nil, errors.WithDetailf(ErrUnbalanced, "transfers through %d exceed funds of %d", i, funds.Amount)
+		}
+	}
+
+	var (
+		placeholderPubs  = make([]ed25519.PublicKey, len(funds.Pubkeys))
+		placeholderPrivs = make([]ed25519.PrivateKey, len(funds.Pubkeys))
+	)
+	for i := range funds.Pubkeys {
+		var err error
+		placeholderPubs[i], placeholderPrivs[i], err = ed25519.GenerateKey(nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "generating placeholder key")
+		}
+	}
+	placeholderSign := func(msg []byte) ([][]byte, error) {
+		sigs := make([][]byte, len(placeholderPrivs))
+		for i := 0; i < funds.Quorum && i < len(sigs); i++ {
+			sigs[i] = ed25519.Sign(placeholderPrivs[i], msg)
+		}
+		return sigs, nil
+	}
+
+	// build returns the signed program of a transaction spending
+	// from and making the transfers in batch, with its input and
+	// change locked by pubkeys and signed by sign, and its change
+	// output. It returns a nil program if the transaction exceeds the
+	// budget.
+	build := func(from *Output, batch []Transfer, last bool, pubkeys []ed25519.PublicKey, sign func([]byte) ([][]byte, error)) ([]byte, *Output, error) {
+		in := *from
+		in.Pubkeys = pubkeys
+		tb := NewTxBuilder(version, budget)
+		tb.Spend(&in, nil)
+		change := from.Amount
+		for _, tr := range batch {
+			tb.Pay(tr.Amount, funds.AssetID, tr.Quorum, tr.Pubkeys).AddReferenceData(tr.RefData)
+			change -= tr.Amount
+		}
+		payChange := change > 0 || !last
+		if payChange {
+			tb.Pay(change, funds.AssetID, funds.Quorum, pubkeys)
+		}
+		prog, tx, err := tb.Build()
+		if errors.Root(err) == txvm.ErrRunlimit {
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		msg, err := SigningBytes(tx, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		sigs, err := sign(msg)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "signing")
+		}
+		prog = AddSignatures(prog, tx.ID.Byte32(), [][][]byte{sigs})
+		_, err = txvm.Validate(prog, version, budget)
+		if errors.Root(err) == txvm.ErrRunlimit {
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if !payChange {
+			return prog, nil, nil
+		}
+		changeOut, err := TxOutput(tx, len(batch))
+		if err != nil {
+			return nil, nil, err
+		}
+		return prog, changeOut, nil
+	}
+
+	var (
+		progs [][]byte
+		from  = funds
+	)
+	for start := 0; start < len(transfers); {
+		// Find the largest n such that transfers[start:start+n] fit,
+		// first by doubling n, then by bisecting between the largest
+		// n found to fit and the smallest found not to.
+		fit, nofit := 0, len(transfers)-start+1
+		for n := 1; fit+1 < nofit; {
+			p, _, err := build(from, transfers[start:start+n], start+n == len(transfers), placeholderPubs, placeholderSign)
+			if err != nil {
+				return nil, errors.Wrapf(err, "building transaction for transfers %d through %d", start, start+n-1)
+			}
+			if p == nil {
+				nofit = n
+			} else {
+				fit = n
+			}
+			if nofit == len(transfers)-start+1 {
+				n *= 2
+				if n >= nofit {
+					n = nofit - 1
+				}
+			} else {
+				n = (fit + nofit) / 2
+			}
+		}
+		if fit == 0 {
+			return nil, errors.WithData(ErrTransferTooLarge, "transfer", start, "budget", budget)
+		}
+
+		end := start + fit
+		prog, next, err := build(from, transfers[start:end], end == len(transfers), funds.Pubkeys, sign)
+		if err != nil {
+			return nil, errors.Wrapf(err, "building transaction for transfers %d through %d", start, end-1)
+		}
+		if prog == nil {
+			// The signatures from sign cost more than the
+			// placeholders.
+			return nil, errors.Wrapf(txvm.ErrRunlimit, "signed transaction for transfers %d through %d", start, end-1)
+		}
+		progs = append(progs, prog)
+		from = next
+		start = end
+	}
+	return progs, nil
+}
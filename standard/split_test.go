@@ -0,0 +1,158 @@
+package standard
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/testutil"
+)
+
+// lockedValue returns the amount and anchor of the value, and the
+// first public key, in the stack of a standard pay-to-multisig
+// contract.
+func lockedValue(stack []txvm.Data) (amount int64, anchor []byte, pubkey ed25519.PublicKey) {
+	val := stack[len(stack)-1].(txvm.Tuple)
+	pubkeys := stack[len(stack)-2].(txvm.Tuple)[1].(txvm.Tuple)
+	return int64(val[1].(txvm.Int)), val[3].(txvm.Bytes), ed25519.PublicKey(pubkeys[0].(txvm.Bytes))
+}
+
+func TestSplitTransfers(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	funds := &Output{
+		Quorum:  1,
+		Pubkeys: []ed25519.PublicKey{pub},
+		Amount:  1000,
+		AssetID: bc.NewHash([32]byte{1}),
+		Anchor:  bytes.Repeat([]byte{1}, 32),
+	}
+	var signs int
+	sign := func(msg []byte) ([][]byte, error) {
+		signs++
+		return [][]byte{ed25519.Sign(priv, msg)}, nil
+	}
+
+	payee := []ed25519.PublicKey{testutil.TestPub}
+	var (
+		transfers []Transfer
+		total     int64
+	)
+	for i := 0; i < 20; i++ {
+		transfers = append(transfers, Transfer{
+			Amount:  int64(i + 1),
+			Quorum:  1,
+			Pubkeys: payee,
+			RefData: []byte{byte(i)},
+		})
+		total += int64(i + 1)
+	}
+
+	// cost returns the runlimit consumed by prog.
+	cost := func(prog []byte) int64 {
+		var left int64
+		_, err := txvm.Validate(prog, 3, 1e6, txvm.GetRunlimit(&left))
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		return 1e6 - left
+	}
+
+	// With room for everything, there is a single transaction.
+	progs, err := SplitTransfers(funds, transfers, 3, 1e6, sign)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(progs) != 1 {
+		t.Fatalf("with budget %d, got %d transactions, want 1", int64(1e6), len(progs))
+	}
+	whole := cost(progs[0])
+
+	budget := whole / 3
+	signs = 0
+	progs, err = SplitTransfers(funds, transfers, 3, budget, sign)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(progs) < 3 {
+		t.Errorf("got %d transactions, want at least 3", len(progs))
+	}
+	// Only the transactions kept are signed.
+	if signs != len(progs) {
+		t.Errorf("signed %d transactions, want %d", signs, len(progs))
+	}
+
+	// Each transaction validates under the budget and spends the
+	// change of the one before. Together they make every transfer,
+	// in order, and return the rest as change.
+	var (
+		txs  []*bc.Tx
+		i    int
+		from = funds
+	)
+	for j, prog := range progs {
+		tx, err := bc.NewTx(prog, 3, budget)
+		if err != nil {
+			t.Fatalf("transaction %d: %v", j, err)
+		}
+		txs = append(txs, tx)
+		if len(tx.Inputs) != 1 {
+			t.Fatalf("transaction %d has %d inputs, want 1", j, len(tx.Inputs))
+		}
+		spent, anchor, _ := lockedValue(tx.Inputs[0].Stack)
+		if !bytes.Equal(anchor, from.Anchor) {
+			t.Fatalf("transaction %d spends %x, want %x", j, anchor, from.Anchor)
+		}
+		n := len(tx.Outputs) - 1 // less the change
+		if n <= 0 || i+n > len(transfers) {
+			t.Fatalf("transaction %d has %d outputs, after %d of %d transfers", j, n+1, i, len(transfers))
+		}
+		for k, tr := range transfers[i : i+n] {
+			out := tx.Outputs[k]
+			amount, _, pubkey := lockedValue(out.Stack)
+			refdata := logData(tx.Log[out.LogPos-1])
+			if amount != tr.Amount || !bytes.Equal(pubkey, tr.Pubkeys[0]) || !bytes.Equal(refdata, tr.RefData) {
+				t.Errorf("transaction %d output %d: got %d to %x with refdata %x, want transfer %d", j, k, amount, pubkey, refdata, i+k)
+			}
+		}
+		i += n
+		change, anchor, pubkey := lockedValue(tx.Outputs[n].Stack)
+		if !bytes.Equal(pubkey, pub) {
+			t.Errorf("transaction %d change to %x, want %x", j, pubkey, pub)
+		}
+		from = &Output{Anchor: anchor}
+		total -= spent - change
+	}
+	if i != len(transfers) {
+		t.Errorf("got %d transfers, want %d", i, len(transfers))
+	}
+	if total != 0 {
+		t.Errorf("transactions pay %d less than the transfers", total)
+	}
+	err = state.CheckSpendOrder(txs)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// A transfer that cannot fit alone is an error.
+	progs, err = SplitTransfers(funds, transfers[:1], 3, 1e6, sign)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = SplitTransfers(funds, transfers, 3, cost(progs[0])-1, sign)
+	if errors.Root(err) != ErrTransferTooLarge {
+		t.Errorf("got error %v, want %v", err, ErrTransferTooLarge)
+	}
+
+	// So are transfers exceeding the funds.
+	_, err = SplitTransfers(funds, append(transfers, Transfer{Amount: 1000, Quorum: 1, Pubkeys: payee}), 3, 1e6, sign)
+	if errors.Root(err) != ErrUnbalanced {
+		t.Errorf("got error %v, want %v", err, ErrUnbalanced)
+	}
+}
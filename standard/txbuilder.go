@@ -0,0 +1,413 @@
+package standard
+
+import (
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/math/checked"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/op"
+	"github.com/chain/txvm/protocol/txvm/txvmutil"
+)
+
+// DefaultMaxRefDataSize is the largest reference data, in bytes, that
+// a TxBuilder accepts when its MaxRefDataSize is zero.
+const DefaultMaxRefDataSize = 1024
+
+var (
+	// ErrRefDataSize is returned by TxBuilder.Build when reference
+	// data exceeds the builder's limit.
+	ErrRefDataSize = errors.New("reference data too large")
+
+	// ErrInvalidPayment is returned by TxBuilder.Build for an input
+	// or payment with a negative amount, or with a quorum that its
+	// public keys cannot meet.
+	ErrInvalidPayment = errors.New("invalid payment")
+
+	// ErrUnbalanced is returned by TxBuilder.Build when the amounts
+	// of an asset spent differ from the amounts paid.
+	ErrUnbalanced = errors.New("unbalanced transaction")
+
+	// ErrUnbuiltPayment is returned when building a transaction that
+	// spends a Payment whose own transaction has not been built first
+	// in the same Batch.
+	ErrUnbuiltPayment = errors.New("payment not yet built")
+
+	// ErrNoInputs is returned by TxBuilder.Build for a transaction
+	// that spends nothing, which has no value to anchor it.
+	ErrNoInputs = errors.New("transaction has no inputs")
+
+	// ErrNonstandardOutput is returned by TxOutput for an output not
+	// locked by the standard pay-to-multisig contract.
+	ErrNonstandardOutput = errors.New("not a standard pay-to-multisig output")
+)
+
+// Output is a value locked by the standard pay-to-multisig contract
+// (PayToMultisigProg2), with what a TxBuilder needs to spend it.
+type Output struct {
+	Quorum  int
+	Pubkeys []ed25519.PublicKey
+	Amount  int64
+	AssetID bc.Hash
+	Anchor  []byte
+}
+
+// Payment is an output of a transaction being built by a TxBuilder,
+// as returned by TxBuilder.Pay.
+type Payment struct {
+	Quorum  int
+	Pubkeys []ed25519.PublicKey
+	Amount  int64
+	AssetID bc.Hash
+
+	refData []byte
+}
+
+// AddReferenceData attaches data to the payment, replacing any
+// attached before. The payment's contract logs it when it is created.
+func (p *Payment) AddReferenceData(data []byte) *Payment {
+	p.refData = data
+	return p
+}
+
+type txInput struct {
+	output  *Output
+	payment *Payment // set instead of output by SpendPayment
+	refData []byte
+}
+
+// TxBuilder builds the program of a transaction that spends values
+// locked by the standard pay-to-multisig contract and pays them to new
+// ones.
+//
+// Each asset spent must be paid out exactly, including any change. The
+// transaction is built without signatures: run it with
+// txvm.StopAfterFinalize to compute its ID and the messages to sign
+// (see SigningBytes), then add the signatures with AddSignatures.
+type TxBuilder struct {
+	// MaxRefDataSize limits the size of each piece of reference data
+	// in the transaction. If it is zero, DefaultMaxRefDataSize is
+	// used.
+	MaxRefDataSize int
+
+	version, runlimit int64
+
+	inputs   []txInput
+	payments []*Payment
+	refData  []byte
+}
+
+// NewTxBuilder returns a TxBuilder for transactions with the given
+// version, whose programs must run to finalize within runlimit.
+func NewTxBuilder(version, runlimit int64) *TxBuilder {
+	return &TxBuilder{version: version, runlimit: runlimit}
+}
+
+// AddReferenceData attaches data to the transaction, replacing any
+// attached before. It is logged just before the transaction is
+// finalized, where txresult finds it.
+func (tb *TxBuilder) AddReferenceData(data []byte) *TxBuilder {
+	tb.refData = data
+	return tb
+}
+
+// Spend adds an input spending out, logging refData with it.
+func (tb *TxBuilder) Spend(out *Output, refData []byte) *TxBuilder {
+	tb.inputs = append(tb.inputs, txInput{output: out, refData: refData})
+	return tb
+}
+
+// SpendPayment adds an input spending the output of p, a payment
+// made by another transaction, logging refData with it. The output
+// is known only once that transaction is built, so tb must be built
+// by a Batch holding both, after it; TxBuilder.Build fails with
+// ErrUnbuiltPayment.
+func (tb *TxBuilder) SpendPayment(p *Payment, refData []byte) *TxBuilder {
+	tb.inputs = append(tb.inputs, txInput{payment: p, refData: refData})
+	return tb
+}
+
+// Pay adds an output paying amount units of assetID to a
+// quorum-of-pubkeys multisig contract. Use the returned Payment to
+// attach reference data to the output. Once the transaction is
+// built, the output, ready to spend, is TxOutput of the payment's
+// position among the transaction's payments.
+func (tb *TxBuilder) Pay(amount int64, assetID bc.Hash, quorum int, pubkeys []ed25519.PublicKey) *Payment {
+	p := &Payment{
+		Quorum:  quorum,
+		Pubkeys: pubkeys,
+		Amount:  amount,
+		AssetID: assetID,
+	}
+	tb.payments = append(tb.payments, p)
+	return p
+}
+
+// Build returns the transaction's program, up to and including
+// finalize, and the transaction that results from running it. Before
+// building anything, it checks the sizes of reference data, the
+// amount and quorum of each input and payment, and the balance of
+// each asset.
+func (tb *TxBuilder) Build() ([]byte, *bc.Tx, error) {
+	if len(tb.inputs) == 0 {
+		return nil, nil, ErrNoInputs
+	}
+	inputs := make([]*Output, 0, len(tb.inputs))
+	for i, in := range tb.inputs {
+		if in.payment != nil {
+			return nil, nil, errors.WithDetailf(ErrUnbuiltPayment, "input %d", i)
+		}
+		inputs = append(inputs, in.output)
+	}
+	return tb.build(inputs)
+}
+
+// build is Build, with the outputs spent by tb's inputs.
+func (tb *TxBuilder) build(inputs []*Output) ([]byte, *bc.Tx, error) {
+	err := tb.check(inputs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Assets are kept in the order they are first spent, each with
+	// the balance of its inputs less its payments.
+	var (
+		assets   []bc.Hash
+		balances []int64
+	)
+	assetIndex := func(assetID bc.Hash) int {
+		for i, a := range assets {
+			if a == assetID {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, out := range inputs {
+		k := assetIndex(out.AssetID)
+		if k < 0 {
+			assets = append(assets, out.AssetID)
+			balances = append(balances, 0)
+			k = len(assets) - 1
+		}
+		var ok bool
+		balances[k], ok = checked.AddInt64(balances[k], out.Amount)
+		if !ok {
+			return nil, nil, errors.WithData(ErrUnbalanced, "assetid", out.AssetID)
+		}
+	}
+	for _, p := range tb.payments {
+		k := assetIndex(p.AssetID)
+		if k < 0 {
+			return nil, nil, errors.WithDetailf(ErrUnbalanced, "asset %x paid but not spent", p.AssetID.Bytes())
+		}
+		var ok bool
+		balances[k], ok = checked.SubInt64(balances[k], p.Amount)
+		if !ok {
+			return nil, nil, errors.WithData(ErrUnbalanced, "assetid", p.AssetID)
+		}
+	}
+	for k, bal := range balances {
+		if bal != 0 {
+			return nil, nil, errors.WithData(ErrUnbalanced, "assetid", assets[k], "excess", bal)
+		}
+	}
+
+	var (
+		b txvmutil.Builder
+		m int // the number of assets with a value on the contract stack
+	)
+	for i, out := range inputs {
+		b.PushdataBytes(tb.inputs[i].refData).Op(op.Put)
+		SpendMultisig(&b, out.Quorum, out.Pubkeys, out.Amount, out.AssetID, out.Anchor, PayToMultisigSeed2[:])
+
+		// Leave the deferred signature check on the argument stack,
+		// to be called after finalize, and keep one value per asset
+		// on the contract stack, in the order of assets.
+		b.Op(op.Get).Op(op.Get).PushdataInt64(1).Op(op.Roll).Op(op.Put)
+		k := assetIndex(out.AssetID)
+		if k == m {
+			m++
+			continue
+		}
+		depth := int64(m - k)
+		b.PushdataInt64(depth).Op(op.Roll).Op(op.Merge)
+		if depth > 1 {
+			b.PushdataInt64(depth - 1).Op(op.Bury)
+		}
+	}
+	for _, p := range tb.payments {
+		depth := int64(m - 1 - assetIndex(p.AssetID))
+		if depth > 0 {
+			b.PushdataInt64(depth).Op(op.Roll)
+		}
+		b.PushdataBytes(p.refData).Op(op.Put)
+		b.PushdataBytes(nil).Op(op.Put) // tags
+		b.PushdataInt64(p.Amount).Op(op.Split).Op(op.Put)
+		b.Tuple(func(tup *txvmutil.TupleBuilder) {
+			for _, pubkey := range p.Pubkeys {
+				tup.PushdataBytes(pubkey)
+			}
+		}).Op(op.Put)
+		b.PushdataInt64(int64(p.Quorum)).Op(op.Put)
+		b.PushdataBytes(PayToMultisigProg2).Op(op.Contract).Op(op.Call)
+		if depth > 0 {
+			b.PushdataInt64(depth).Op(op.Bury)
+		}
+	}
+	// Log the refdata even if empty, so that the entry before
+	// finalize is never an output's refdata.
+	b.PushdataBytes(tb.refData).Op(op.Log)
+	// Every value is now zero. The first anchors the transaction.
+	for i := 1; i < m; i++ {
+		b.Op(op.Drop)
+	}
+	b.Op(op.Finalize)
+	prog := b.Build()
+
+	tx, err := bc.NewTx(prog, tb.version, tb.runlimit, txvm.StopAfterFinalize)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "running transaction")
+	}
+	if len(tx.Outputs) != len(tb.payments) {
+		return nil, nil, errors.Wrapf(ErrNonstandardOutput, "transaction has %d outputs, want %d", len(tx.Outputs), len(tb.payments))
+	}
+	return prog, tx, nil
+}
+
+// check checks the reference data, amounts, and quorums of tb's
+// inputs, which spend inputs, and its payments.
+func (tb *TxBuilder) check(inputs []*Output) error {
+	max := tb.MaxRefDataSize
+	if max == 0 {
+		max = DefaultMaxRefDataSize
+	}
+	if len(tb.refData) > max {
+		return errors.WithData(ErrRefDataSize, "size", len(tb.refData), "max", max)
+	}
+	for i, in := range tb.inputs {
+		if len(in.refData) > max {
+			return errors.WithData(ErrRefDataSize, "input", i, "size", len(in.refData), "max", max)
+		}
+		err := checkMultisig(inputs[i].Amount, inputs[i].Quorum, len(inputs[i].Pubkeys))
+		if err != nil {
+			return errors.Wrapf(err, "input %d", i)
+		}
+	}
+	for i, p := range tb.payments {
+		if len(p.refData) > max {
+			return errors.WithData(ErrRefDataSize, "output", i, "size", len(p.refData), "max", max)
+		}
+		err := checkMultisig(p.Amount, p.Quorum, len(p.Pubkeys))
+		if err != nil {
+			return errors.Wrapf(err, "payment %d", i)
+		}
+	}
+	return nil
+}
+
+// checkMultisig checks that a value of amount can be locked by a
+// quorum-of-n multisig contract, as checkmultisig requires.
+func checkMultisig(amount int64, quorum, n int) error {
+	if amount < 0 {
+		return errors.WithDetailf(ErrInvalidPayment, "negative amount %d", amount)
+	}
+	if quorum < 1 || quorum > n {
+		return errors.WithDetailf(ErrInvalidPayment, "quorum %d of %d public keys", quorum, n)
+	}
+	return nil
+}
+
+// TxOutput returns the output of tx with the given index, which must
+// be locked by the standard pay-to-multisig contract, ready to be
+// spent by a TxBuilder. The outputs of a transaction built by a
+// TxBuilder are its payments, in order.
+func TxOutput(tx *bc.Tx, index int) (*Output, error) {
+	if index < 0 || index >= len(tx.Outputs) {
+		return nil, errors.WithDetailf(ErrNonstandardOutput, "no output %d", index)
+	}
+	out := tx.Outputs[index]
+	if out.Seed.Byte32() != PayToMultisigSeed2 || len(out.Stack) != 3 {
+		return nil, errors.WithDetailf(ErrNonstandardOutput, "output %d", index)
+	}
+
+	// The contract stack is [quorum {p1,...,p_n} value], each item
+	// in its inspected form.
+	quorum, ok := inspectedItem(out.Stack[0], txvm.IntCode)
+	if !ok {
+		return nil, errors.WithDetailf(ErrNonstandardOutput, "output %d quorum", index)
+	}
+	q, ok := quorum.(txvm.Int)
+	if !ok {
+		return nil, errors.WithDetailf(ErrNonstandardOutput, "output %d quorum", index)
+	}
+	keys, ok := inspectedItem(out.Stack[1], txvm.TupleCode)
+	if !ok {
+		return nil, errors.WithDetailf(ErrNonstandardOutput, "output %d pubkeys", index)
+	}
+	keyTuple, ok := keys.(txvm.Tuple)
+	if !ok {
+		return nil, errors.WithDetailf(ErrNonstandardOutput, "output %d pubkeys", index)
+	}
+	var pubkeys []ed25519.PublicKey
+	for _, k := range keyTuple {
+		pub, ok := k.(txvm.Bytes)
+		if !ok {
+			return nil, errors.WithDetailf(ErrNonstandardOutput, "output %d pubkeys", index)
+		}
+		pubkeys = append(pubkeys, ed25519.PublicKey(pub))
+	}
+	val, ok := out.Stack[2].(txvm.Tuple)
+	if !ok || len(val) != 4 {
+		return nil, errors.WithDetailf(ErrNonstandardOutput, "output %d value", index)
+	}
+	code, ok1 := val[0].(txvm.Bytes)
+	amount, ok2 := val[1].(txvm.Int)
+	assetID, ok3 := val[2].(txvm.Bytes)
+	anchor, ok4 := val[3].(txvm.Bytes)
+	if !ok1 || !ok2 || !ok3 || !ok4 || len(code) != 1 || code[0] != txvm.ValueCode || len(assetID) != 32 {
+		return nil, errors.WithDetailf(ErrNonstandardOutput, "output %d value", index)
+	}
+	return &Output{
+		Quorum:  int(q),
+		Pubkeys: pubkeys,
+		Amount:  int64(amount),
+		AssetID: bc.HashFromBytes(assetID),
+		Anchor:  anchor,
+	}, nil
+}
+
+// inspectedItem returns the item held by a stack item in its
+// inspected form, {code, item}, if it has the given type code.
+func inspectedItem(d txvm.Data, typeCode byte) (txvm.Data, bool) {
+	t, ok := d.(txvm.Tuple)
+	if !ok || len(t) != 2 {
+		return nil, false
+	}
+	code, ok := t[0].(txvm.Bytes)
+	if !ok || len(code) != 1 || code[0] != typeCode {
+		return nil, false
+	}
+	return t[1], true
+}
+
+// AddSignatures returns prog, the unsigned program of the transaction
+// with the given ID built by a TxBuilder, followed by the signatures
+// that authorize its inputs. Sigs holds, for each input in order, a
+// signature for each of its public keys in order, empty for keys not
+// signing. Each signature is of the input's SigningBytes.
+func AddSignatures(prog []byte, txid [32]byte, sigs [][][]byte) []byte {
+	b := new(txvmutil.Builder)
+	b.Concat(prog)
+	// The signature checks are on the argument stack, the last
+	// input's on top.
+	for i := len(sigs) - 1; i >= 0; i-- {
+		b.Op(op.Get)
+		for _, sig := range sigs[i] {
+			b.PushdataBytes(sig).Op(op.Put)
+		}
+		b.PushdataBytes(VerifyTxID(txid)).Op(op.Put)
+		b.Op(op.Call)
+	}
+	return b.Build()
+}
@@ -0,0 +1,213 @@
+package standard
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/testutil"
+)
+
+// logData returns the data of entry, a log entry made by the log
+// instruction, or nil if it is not one.
+func logData(entry txvm.Tuple) []byte {
+	if len(entry) != 3 {
+		return nil
+	}
+	if code, ok := entry[0].(txvm.Bytes); !ok || len(code) != 1 || code[0] != txvm.LogCode {
+		return nil
+	}
+	data, _ := entry[2].(txvm.Bytes)
+	return data
+}
+
+// signAll returns the signed program of tx, built by a TxBuilder as
+// prog, with each input signed by priv.
+func signAll(t *testing.T, prog []byte, tx *bc.Tx, priv ed25519.PrivateKey) []byte {
+	sigs := make([][][]byte, len(tx.Inputs))
+	for i := range tx.Inputs {
+		msg, err := SigningBytes(tx, i)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		sigs[i] = [][]byte{ed25519.Sign(priv, msg)}
+	}
+	return AddSignatures(prog, tx.ID.Byte32(), sigs)
+}
+
+func TestTxBuilder(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	keys := []ed25519.PublicKey{pub}
+	payee := []ed25519.PublicKey{testutil.TestPub}
+	assetA := bc.NewHash([32]byte{1})
+	assetB := bc.NewHash([32]byte{2})
+
+	tb := NewTxBuilder(3, 100000)
+	tb.Spend(&Output{Quorum: 1, Pubkeys: keys, Amount: 10, AssetID: assetA, Anchor: bytes.Repeat([]byte{1}, 32)}, nil)
+	tb.Spend(&Output{Quorum: 1, Pubkeys: keys, Amount: 5, AssetID: assetB, Anchor: bytes.Repeat([]byte{2}, 32)}, []byte("spend"))
+	tb.Spend(&Output{Quorum: 1, Pubkeys: keys, Amount: 3, AssetID: assetA, Anchor: bytes.Repeat([]byte{3}, 32)}, nil)
+	payments := []*Payment{
+		tb.Pay(4, assetA, 1, payee).AddReferenceData([]byte("first")),
+		tb.Pay(5, assetB, 1, payee),
+		tb.Pay(9, assetA, 1, keys).AddReferenceData([]byte("change")),
+	}
+	tb.AddReferenceData([]byte("memo"))
+
+	prog, tx, err := tb.Build()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(tx.Inputs) != 3 {
+		t.Errorf("got %d inputs, want 3", len(tx.Inputs))
+	}
+	if len(tx.Outputs) != len(payments) {
+		t.Fatalf("got %d outputs, want %d", len(tx.Outputs), len(payments))
+	}
+	for i, p := range payments {
+		out, err := TxOutput(tx, i)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if out.Amount != p.Amount || out.AssetID != p.AssetID || out.Quorum != p.Quorum || !bytes.Equal(out.Pubkeys[0], p.Pubkeys[0]) {
+			t.Errorf("payment %d: got output %+v, want %+v", i, out, p)
+		}
+		// The pay-to-multisig contract logs its refdata just before
+		// the output.
+		if got := logData(tx.Log[tx.Outputs[i].LogPos-1]); !bytes.Equal(got, p.refData) {
+			t.Errorf("payment %d: refdata %q, want %q", i, got, p.refData)
+		}
+	}
+	if got := logData(tx.Log[len(tx.Log)-2]); string(got) != "memo" {
+		t.Errorf("transaction refdata %q, want %q", got, "memo")
+	}
+
+	signed := signAll(t, prog, tx, priv)
+	full, err := bc.NewTx(signed, 3, 100000)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if full.ID != tx.ID {
+		t.Errorf("signed txid %x, unsigned txid %x", full.ID.Bytes(), tx.ID.Bytes())
+	}
+
+	// A payment's output can be spent in turn.
+	change, err := TxOutput(tx, 2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	next := NewTxBuilder(3, 100000)
+	next.Spend(change, nil)
+	next.Pay(9, assetA, 1, payee)
+	prog, next2, err := next.Build()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if next2.Inputs[0].ID != tx.Outputs[2].ID {
+		t.Errorf("spent %x, want %x", next2.Inputs[0].ID.Bytes(), tx.Outputs[2].ID.Bytes())
+	}
+	_, err = bc.NewTx(signAll(t, prog, next2, priv), 3, 100000)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Without refdata, the entry before finalize is empty refdata,
+	// not that of the last output.
+	if got := logData(next2.Log[len(next2.Log)-2]); got == nil || len(got) != 0 {
+		t.Errorf("transaction refdata %q, want empty", got)
+	}
+}
+
+func TestTxBuilderRefDataSize(t *testing.T) {
+	out := &Output{Quorum: 1, Pubkeys: []ed25519.PublicKey{testutil.TestPub}, Amount: 1, Anchor: make([]byte, 32)}
+
+	cases := []struct {
+		max               int
+		tx, input, output int
+		wantErr           error
+	}{
+		{4, 4, 4, 4, nil},
+		{4, 5, 0, 0, ErrRefDataSize},
+		{4, 0, 5, 0, ErrRefDataSize},
+		{4, 0, 0, 5, ErrRefDataSize},
+		{0, DefaultMaxRefDataSize, 0, 0, nil},
+		{0, DefaultMaxRefDataSize + 1, 0, 0, ErrRefDataSize},
+	}
+	for i, c := range cases {
+		tb := NewTxBuilder(3, 100000)
+		tb.MaxRefDataSize = c.max
+		tb.Spend(out, make([]byte, c.input))
+		tb.Pay(1, bc.Hash{}, 1, out.Pubkeys).AddReferenceData(make([]byte, c.output))
+		tb.AddReferenceData(make([]byte, c.tx))
+		_, _, err := tb.Build()
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("case %d: got error %v, want %v", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestTxBuilderErrors(t *testing.T) {
+	keys := []ed25519.PublicKey{testutil.TestPub}
+	out := &Output{Quorum: 1, Pubkeys: keys, Amount: 5, Anchor: make([]byte, 32)}
+
+	cases := []struct {
+		build   func(*TxBuilder)
+		wantErr error
+	}{
+		{func(tb *TxBuilder) { tb.Spend(out, nil).Pay(4, bc.Hash{}, 1, keys) }, ErrUnbalanced},
+		{func(tb *TxBuilder) { tb.Spend(out, nil).Pay(6, bc.Hash{}, 1, keys) }, ErrUnbalanced},
+		{func(tb *TxBuilder) {
+			tb.Spend(out, nil).Pay(5, bc.Hash{}, 1, keys)
+			tb.Pay(0, bc.NewHash([32]byte{1}), 1, keys)
+		}, ErrUnbalanced},
+		{func(tb *TxBuilder) {
+			tb.Spend(out, nil).Pay(6, bc.Hash{}, 1, keys)
+			tb.Pay(-1, bc.Hash{}, 1, keys)
+		}, ErrInvalidPayment},
+		{func(tb *TxBuilder) { tb.Spend(out, nil).Pay(5, bc.Hash{}, 0, keys) }, ErrInvalidPayment},
+		{func(tb *TxBuilder) { tb.Spend(out, nil).Pay(5, bc.Hash{}, 2, keys) }, ErrInvalidPayment},
+		{func(tb *TxBuilder) {
+			tb.Spend(&Output{Quorum: 2, Pubkeys: keys, Amount: 5, Anchor: make([]byte, 32)}, nil)
+			tb.Pay(5, bc.Hash{}, 1, keys)
+		}, ErrInvalidPayment},
+		{func(tb *TxBuilder) {}, ErrNoInputs},
+		{func(tb *TxBuilder) { tb.Spend(out, nil).Pay(5, bc.Hash{}, 1, keys) }, nil},
+	}
+	for i, c := range cases {
+		tb := NewTxBuilder(3, 100000)
+		c.build(tb)
+		_, _, err := tb.Build()
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("case %d: got error %v, want %v", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestTxOutput(t *testing.T) {
+	keys := []ed25519.PublicKey{testutil.TestPub}
+	tb := NewTxBuilder(3, 100000)
+	tb.Spend(&Output{Quorum: 1, Pubkeys: keys, Amount: 5, Anchor: make([]byte, 32)}, nil)
+	tb.Pay(5, bc.Hash{}, 1, keys)
+	_, tx, err := tb.Build()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	for _, index := range []int{-1, 1} {
+		_, err = TxOutput(tx, index)
+		if errors.Root(err) != ErrNonstandardOutput {
+			t.Errorf("TxOutput(%d): got error %v, want %v", index, err, ErrNonstandardOutput)
+		}
+	}
+
+	// An output of another contract is not standard.
+	tx.Outputs[0].Seed = bc.Hash{}
+	_, err = TxOutput(tx, 0)
+	if errors.Root(err) != ErrNonstandardOutput {
+		t.Errorf("got error %v, want %v", err, ErrNonstandardOutput)
+	}
+}
@@ -52,6 +52,7 @@ type Output struct {
 type Input struct {
 	OutputID bc.Hash
 	Value    *Value
+	Pubkeys  []ed25519.PublicKey
 	RefData  []byte
 }
 
@@ -137,6 +138,32 @@ func Results(txs []*bc.Tx) []*Result {
 	return res
 }
 
+// BalanceDelta returns the net change r's transaction makes to the
+// balances of the accounts for which owned returns true, given the
+// public keys locking an input or output: for each asset, the amounts
+// of owned outputs created less those of owned inputs spent. Assets
+// with no net change are omitted. Inputs and outputs whose values
+// could not be parsed from the log (see Value) are ignored.
+func (r *Result) BalanceDelta(owned func(pubkeys []ed25519.PublicKey) bool) map[bc.Hash]int64 {
+	delta := make(map[bc.Hash]int64)
+	for _, inp := range r.Inputs {
+		if inp.Value != nil && owned(inp.Pubkeys) {
+			delta[inp.Value.AssetID] -= int64(inp.Value.Amount)
+		}
+	}
+	for _, out := range r.Outputs {
+		if out.Value != nil && owned(out.Pubkeys) {
+			delta[out.Value.AssetID] += int64(out.Value.Amount)
+		}
+	}
+	for assetID, d := range delta {
+		if d == 0 {
+			delete(delta, assetID)
+		}
+	}
+	return delta
+}
+
 func addOutputMeta(out *Output, txOut bc.Output, tx *bc.Tx, logPos int) {
 	switch txOut.Seed.Byte32() {
 	case standard.PayToMultisigSeed1:
@@ -195,6 +222,10 @@ func addInputMeta(input *Input, txIn bc.Input, tx *bc.Tx, logPos int) {
 		AssetID: bc.HashFromBytes(val[2].(txvm.Bytes)),
 		Anchor:  val[3].(txvm.Bytes),
 	}
+	pubkeyBytes := txIn.Stack[len(txIn.Stack)-2].(txvm.Tuple)[1].(txvm.Tuple)
+	for _, pub := range pubkeyBytes {
+		input.Pubkeys = append(input.Pubkeys, ed25519.PublicKey(pub.(txvm.Bytes)))
+	}
 	input.RefData = spendRefdata
 }
 
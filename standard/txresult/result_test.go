@@ -0,0 +1,141 @@
+package txresult
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/op"
+	"github.com/chain/txvm/protocol/txvm/txvmutil"
+	"github.com/chain/txvm/standard"
+	"github.com/chain/txvm/testutil"
+)
+
+// coin is an amount of an asset locked by a 1-of-1 pay-to-multisig
+// contract.
+type coin struct {
+	pub     ed25519.PublicKey
+	amount  int64
+	assetID bc.Hash
+}
+
+// transfer spends in and pays its value out to the coins in outs,
+// which must have the same asset and add up to in's amount.
+type transfer struct {
+	in   coin
+	outs []coin
+}
+
+// buildTx builds a transaction performing transfers, running it only
+// up to finalize so that the spends need no signatures.
+func buildTx(t *testing.T, transfers ...transfer) *bc.Tx {
+	var b txvmutil.Builder
+	for i, tr := range transfers {
+		b.PushdataBytes([]byte("spendrefdata")).Op(op.Put)
+		anchor := bytes.Repeat([]byte{byte(i)}, 32)
+		standard.SpendMultisig(&b, 1, []ed25519.PublicKey{tr.in.pub}, tr.in.amount, tr.in.assetID, anchor, standard.PayToMultisigSeed2[:])
+		b.Op(op.Get).Op(op.Get) // contract stack: [... sigcheck value]
+		if i == 0 {
+			b.PushdataInt64(0).Op(op.Split).Op(op.Put) // finalize anchor
+		}
+		for j, out := range tr.outs {
+			if j < len(tr.outs)-1 {
+				b.PushdataInt64(out.amount).Op(op.Split)
+			}
+			b.PushdataBytes([]byte("refdata")).Op(op.Put)
+			b.PushdataBytes([]byte("tags")).Op(op.Put)
+			b.Op(op.Put) // the value
+			b.Tuple(func(tup *txvmutil.TupleBuilder) { tup.PushdataBytes(out.pub) }).Op(op.Put)
+			b.PushdataInt64(1).Op(op.Put)
+			b.PushdataBytes(standard.PayToMultisigProg2).Op(op.Contract).Op(op.Call)
+		}
+	}
+	b.Op(op.Get).Op(op.Finalize)
+
+	tx, err := bc.NewTx(b.Build(), 3, 100000, txvm.StopAfterFinalize)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !tx.Finalized {
+		t.Fatal("transaction not finalized")
+	}
+	return tx
+}
+
+func TestBalanceDelta(t *testing.T) {
+	var (
+		ours   = mustPubkey(t)
+		theirs = mustPubkey(t)
+		assetA = bc.NewHash([32]byte{0xa})
+		assetB = bc.NewHash([32]byte{0xb})
+	)
+	owned := func(pubkeys []ed25519.PublicKey) bool {
+		return len(pubkeys) == 1 && bytes.Equal(pubkeys[0], ours)
+	}
+
+	cases := []struct {
+		name      string
+		transfers []transfer
+		want      map[bc.Hash]int64
+	}{
+		{
+			name: "receive",
+			transfers: []transfer{{
+				in:   coin{theirs, 10, assetA},
+				outs: []coin{{ours, 4, assetA}, {theirs, 6, assetA}},
+			}},
+			want: map[bc.Hash]int64{assetA: 4},
+		},
+		{
+			name: "send with change",
+			transfers: []transfer{{
+				in:   coin{ours, 10, assetA},
+				outs: []coin{{theirs, 3, assetA}, {ours, 7, assetA}},
+			}},
+			want: map[bc.Hash]int64{assetA: -3},
+		},
+		{
+			name: "mixed assets",
+			transfers: []transfer{
+				{in: coin{ours, 5, assetA}, outs: []coin{{theirs, 5, assetA}}},
+				{in: coin{theirs, 8, assetB}, outs: []coin{{ours, 2, assetB}, {ours, 6, assetB}}},
+			},
+			want: map[bc.Hash]int64{assetA: -5, assetB: 8},
+		},
+		{
+			name: "self transfer",
+			transfers: []transfer{{
+				in:   coin{ours, 10, assetA},
+				outs: []coin{{ours, 1, assetA}, {ours, 9, assetA}},
+			}},
+			want: map[bc.Hash]int64{},
+		},
+		{
+			name: "unrelated",
+			transfers: []transfer{{
+				in:   coin{theirs, 10, assetA},
+				outs: []coin{{theirs, 10, assetA}},
+			}},
+			want: map[bc.Hash]int64{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := New(buildTx(t, c.transfers...))
+			got := res.BalanceDelta(owned)
+			if !testutil.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func mustPubkey(t *testing.T) ed25519.PublicKey {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	return pub
+}